@@ -3,21 +3,133 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Port     string // 服务端口
-	BaseURL  string // 基础 URL，用于生成完整的短链接
-	LogLevel string // 日志级别
+	Port          string // 服务端口
+	BaseURL       string // 基础 URL，用于生成完整的短链接
+	LogLevel      string // 日志级别
+	StorageDriver string // 存储后端：memory / sqlite / bolt / redis
+	DatabasePath  string // SQLite 数据库文件路径
+	BoltPath      string // bbolt 数据文件路径
+
+	// 短码生成
+	ShortCodeStrategy  string // 生成策略：sequential / random / hash
+	ShortCodeLength    int    // random 和 hash 策略的短码长度
+	ShortCodeSecret    string // sequential 策略的混淆密钥，为空时短码就是 ID 的 Base62 编码
+	ShortCodeMinLength int    // 混淆后短码的最小长度
+	ShortCodeCheckChar bool   // 是否在短码末尾追加校验字符，用于在查询存储前发现输错的短码
+
+	// 自定义别名规则
+	AliasCharset   string // 允许的字符
+	AliasMinLength int    // 最小长度
+	AliasMaxLength int    // 最大长度
+
+	// DenyListFile 屏蔽词文件，每行一个；包含屏蔽词的短码不会被生成，也不能用作别名
+	DenyListFile string
+
+	// Redis 连接配置
+	RedisAddr      string // 地址，host:port
+	RedisPassword  string // 密码
+	RedisDB        int    // 数据库编号
+	RedisKeyPrefix string // 键名前缀，用于多个服务共用一个 Redis
+
+	// 内存存储持久化，JournalDir 为空时不持久化
+	JournalDir          string        // 日志与快照目录
+	JournalSync         string        // 刷盘策略：always / interval / never
+	JournalSyncInterval time.Duration // interval 策略下的刷盘间隔
+	SnapshotInterval    time.Duration // 压缩快照间隔
+
+	// 异步点击记录，ClickQueueSize 为 0 时同步更新访问计数
+	ClickQueueSize     int           // 点击队列容量
+	ClickBatchSize     int           // 批量写入的点击数
+	ClickFlushInterval time.Duration // 最长写入间隔
+	ClickQueuePolicy   string        // 队列满时的策略：drop / block
+
+	// 读缓存，CacheSize 为 0 时不启用；内存存储不使用缓存
+	CacheSize        int           // 最多缓存的短码数量
+	CacheTTL         time.Duration // 记录的缓存有效期
+	CacheNegativeTTL time.Duration // 不存在的短码的缓存有效期
+
+	// 过期链接清理，ReaperInterval 为 0 时不启动后台清理，过期链接仍然返回 410
+	ReaperInterval     time.Duration // 清理间隔
+	ReaperBatchSize    int           // 每批读取的过期记录数
+	ExpiredArchivePath string        // 删除前归档过期记录的文件，为空时直接删除
+
+	// FallbackURL 链接不在生效时间窗口内且没有单独设置备用地址时跳转的地址，为空时返回错误
+	FallbackURL string
+
+	// 密码保护的链接
+	PasswordHashCost    int           // bcrypt 计算成本
+	UnlockSecret        string        // 访问凭证的签名密钥，为空时随机生成，重启后需要重新输入密码
+	UnlockTTL           time.Duration // 输入密码后免密访问的时长
+	UnlockMaxAttempts   int           // 每个短码在一个窗口内最多输错的次数
+	UnlockAttemptWindow time.Duration // 输错次数的统计窗口
+
+	// 重定向方式，链接没有单独设置时使用
+	DefaultRedirectType int           // 重定向状态码：301 / 302 / 307 / 308
+	RedirectMaxAge      time.Duration // 301 和 308 允许浏览器缓存的时长
+
+	// TrashRetention 删除的链接在回收站中保留的时长，之后由清理任务永久删除
+	TrashRetention time.Duration
+
+	// 按国家和大洲跳转，GeoIPPath 为空时地理位置条件都不匹配
+	GeoIPPath           string        // MaxMind 格式（.mmdb）的 IP 地址库文件
+	GeoIPCacheSize      int           // 最多缓存的 IP 查询结果数
+	GeoIPReloadInterval time.Duration // 检查地址库文件是否变化的间隔，为 0 时不自动重新加载
 }
 
 // LoadConfig 加载配置，支持环境变量覆盖默认值
 func LoadConfig() *Config {
 	config := &Config{
-		Port:     "8080",
-		BaseURL:  "http://localhost:8080",
-		LogLevel: "info",
+		Port:          "8080",
+		BaseURL:       "http://localhost:8080",
+		LogLevel:      "info",
+		StorageDriver: "memory",
+		DatabasePath:  "data/shortener.db",
+		BoltPath:      "data/shortener.bolt",
+
+		ShortCodeStrategy:  "sequential",
+		ShortCodeLength:    8,
+		ShortCodeMinLength: 11,
+
+		AliasCharset:   "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_",
+		AliasMinLength: 3,
+		AliasMaxLength: 32,
+
+		RedisAddr:      "localhost:6379",
+		RedisKeyPrefix: "shortener:",
+
+		JournalSync:         "interval",
+		JournalSyncInterval: time.Second,
+		SnapshotInterval:    5 * time.Minute,
+
+		ClickQueueSize:     10000,
+		ClickBatchSize:     500,
+		ClickFlushInterval: time.Second,
+		ClickQueuePolicy:   "drop",
+
+		CacheSize:        10000,
+		CacheTTL:         5 * time.Minute,
+		CacheNegativeTTL: 30 * time.Second,
+
+		ReaperInterval:  time.Minute,
+		ReaperBatchSize: 500,
+
+		PasswordHashCost:    10,
+		UnlockTTL:           10 * time.Minute,
+		UnlockMaxAttempts:   5,
+		UnlockAttemptWindow: 15 * time.Minute,
+
+		DefaultRedirectType: 301,
+		RedirectMaxAge:      time.Hour,
+
+		TrashRetention: 30 * 24 * time.Hour,
+
+		GeoIPCacheSize:      10000,
+		GeoIPReloadInterval: time.Minute,
 	}
 
 	// 从环境变量读取配置
@@ -33,6 +145,174 @@ func LoadConfig() *Config {
 		config.LogLevel = logLevel
 	}
 
+	if driver := os.Getenv("STORAGE_DRIVER"); driver != "" {
+		config.StorageDriver = driver
+	}
+
+	if dbPath := os.Getenv("DATABASE_PATH"); dbPath != "" {
+		config.DatabasePath = dbPath
+	}
+
+	if boltPath := os.Getenv("BOLT_PATH"); boltPath != "" {
+		config.BoltPath = boltPath
+	}
+
+	if strategy := os.Getenv("SHORT_CODE_STRATEGY"); strategy != "" {
+		config.ShortCodeStrategy = strategy
+	}
+
+	if length, err := strconv.Atoi(os.Getenv("SHORT_CODE_LENGTH")); err == nil {
+		config.ShortCodeLength = length
+	}
+
+	if secret := os.Getenv("SHORT_CODE_SECRET"); secret != "" {
+		config.ShortCodeSecret = secret
+	}
+
+	if length, err := strconv.Atoi(os.Getenv("SHORT_CODE_MIN_LENGTH")); err == nil {
+		config.ShortCodeMinLength = length
+	}
+
+	if checkChar, err := strconv.ParseBool(os.Getenv("SHORT_CODE_CHECK_CHAR")); err == nil {
+		config.ShortCodeCheckChar = checkChar
+	}
+
+	if charset := os.Getenv("ALIAS_CHARSET"); charset != "" {
+		config.AliasCharset = charset
+	}
+
+	if length, err := strconv.Atoi(os.Getenv("ALIAS_MIN_LENGTH")); err == nil {
+		config.AliasMinLength = length
+	}
+
+	if length, err := strconv.Atoi(os.Getenv("ALIAS_MAX_LENGTH")); err == nil {
+		config.AliasMaxLength = length
+	}
+
+	if denyList := os.Getenv("DENY_LIST_FILE"); denyList != "" {
+		config.DenyListFile = denyList
+	}
+
+	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+		config.RedisAddr = redisAddr
+	}
+
+	if redisPassword := os.Getenv("REDIS_PASSWORD"); redisPassword != "" {
+		config.RedisPassword = redisPassword
+	}
+
+	if redisDB, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		config.RedisDB = redisDB
+	}
+
+	if prefix := os.Getenv("REDIS_KEY_PREFIX"); prefix != "" {
+		config.RedisKeyPrefix = prefix
+	}
+
+	if journalDir := os.Getenv("JOURNAL_DIR"); journalDir != "" {
+		config.JournalDir = journalDir
+	}
+
+	if journalSync := os.Getenv("JOURNAL_SYNC"); journalSync != "" {
+		config.JournalSync = journalSync
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("JOURNAL_SYNC_INTERVAL")); err == nil {
+		config.JournalSyncInterval = interval
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("SNAPSHOT_INTERVAL")); err == nil {
+		config.SnapshotInterval = interval
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("CLICK_QUEUE_SIZE")); err == nil {
+		config.ClickQueueSize = size
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("CLICK_BATCH_SIZE")); err == nil {
+		config.ClickBatchSize = size
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("CLICK_FLUSH_INTERVAL")); err == nil {
+		config.ClickFlushInterval = interval
+	}
+
+	if policy := os.Getenv("CLICK_QUEUE_POLICY"); policy != "" {
+		config.ClickQueuePolicy = policy
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("CACHE_SIZE")); err == nil {
+		config.CacheSize = size
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil {
+		config.CacheTTL = ttl
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("CACHE_NEGATIVE_TTL")); err == nil {
+		config.CacheNegativeTTL = ttl
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("REAPER_INTERVAL")); err == nil {
+		config.ReaperInterval = interval
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("REAPER_BATCH_SIZE")); err == nil {
+		config.ReaperBatchSize = size
+	}
+
+	if archivePath := os.Getenv("EXPIRED_ARCHIVE_PATH"); archivePath != "" {
+		config.ExpiredArchivePath = archivePath
+	}
+
+	if fallbackURL := os.Getenv("FALLBACK_URL"); fallbackURL != "" {
+		config.FallbackURL = fallbackURL
+	}
+
+	if cost, err := strconv.Atoi(os.Getenv("PASSWORD_HASH_COST")); err == nil {
+		config.PasswordHashCost = cost
+	}
+
+	if secret := os.Getenv("UNLOCK_SECRET"); secret != "" {
+		config.UnlockSecret = secret
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("UNLOCK_TTL")); err == nil {
+		config.UnlockTTL = ttl
+	}
+
+	if attempts, err := strconv.Atoi(os.Getenv("UNLOCK_MAX_ATTEMPTS")); err == nil {
+		config.UnlockMaxAttempts = attempts
+	}
+
+	if window, err := time.ParseDuration(os.Getenv("UNLOCK_ATTEMPT_WINDOW")); err == nil {
+		config.UnlockAttemptWindow = window
+	}
+
+	if redirectType, err := strconv.Atoi(os.Getenv("DEFAULT_REDIRECT_TYPE")); err == nil {
+		config.DefaultRedirectType = redirectType
+	}
+
+	if maxAge, err := time.ParseDuration(os.Getenv("REDIRECT_MAX_AGE")); err == nil {
+		config.RedirectMaxAge = maxAge
+	}
+
+	if retention, err := time.ParseDuration(os.Getenv("TRASH_RETENTION")); err == nil {
+		config.TrashRetention = retention
+	}
+
+	if geoIPPath := os.Getenv("GEOIP_DB_PATH"); geoIPPath != "" {
+		config.GeoIPPath = geoIPPath
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("GEOIP_CACHE_SIZE")); err == nil {
+		config.GeoIPCacheSize = size
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("GEOIP_RELOAD_INTERVAL")); err == nil {
+		config.GeoIPReloadInterval = interval
+	}
+
 	return config
 }
 
@@ -44,6 +324,15 @@ func (c *Config) GetPort() string {
 	return c.Port
 }
 
+// IsValidRedirectType 验证默认重定向状态码是否有效
+func (c *Config) IsValidRedirectType() bool {
+	switch c.DefaultRedirectType {
+	case 301, 302, 307, 308:
+		return true
+	}
+	return false
+}
+
 // IsValidPort 验证端口号是否有效
 func (c *Config) IsValidPort() bool {
 	portStr := c.Port
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gin-url-shortener/utils"
+)
+
+// ReserveRoutes 将已注册路由的第一段静态路径加入保留字，
+// 避免短码与 /health、/info 等接口共用同一个路径
+func ReserveRoutes(router *gin.Engine, reserved *utils.ReservedCodes) {
+	for _, route := range router.Routes() {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route.Path, "/"), "/")
+		if segment == "" || segment[0] == ':' || segment[0] == '*' {
+			continue
+		}
+		reserved.Add(segment)
+	}
+}
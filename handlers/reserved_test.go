@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gin-url-shortener/utils"
+)
+
+func TestReserveRoutes(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	reserved := utils.NewReservedCodes()
+	ReserveRoutes(router, reserved)
+
+	for _, code := range []string{"shorten", "info", "health", "stats"} {
+		assert.True(t, reserved.IsReserved(code), "%s should be reserved", code)
+	}
+
+	// 通配的 /:shortCode 不产生保留字
+	assert.False(t, reserved.IsReserved("shortCode"))
+	assert.False(t, reserved.IsReserved(":shortCode"))
+}
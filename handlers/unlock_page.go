@@ -0,0 +1,40 @@
+package handlers
+
+import "html/template"
+
+// unlockCookieName 保存密码保护链接访问凭证的 Cookie，路径限定为对应的短链接
+const unlockCookieName = "shortener_unlock"
+
+// unlockPageData 解锁页面的模板数据
+type unlockPageData struct {
+	Action string // 表单提交的地址，即当前访问的路径和查询参数
+	Error  string
+}
+
+// unlockPage 访问密码保护链接时显示的密码输入页面，表单提交到当前访问的地址
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; padding-top: 15vh; background: #f5f5f5; }
+form { background: #fff; padding: 2rem; border-radius: 8px; box-shadow: 0 1px 4px rgba(0, 0, 0, .1); width: 20rem; }
+h1 { font-size: 1.2rem; margin-top: 0; }
+input, button { box-sizing: border-box; width: 100%; padding: .6rem; margin-top: .5rem; font-size: 1rem; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<form method="post" action="{{.Action}}">
+<h1>This link is password protected</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
@@ -1,14 +1,25 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
 
 	"gin-url-shortener/models"
 	"gin-url-shortener/services"
 )
 
+// variantCookieName 记录访问者分到的 A/B 测试版本的 Cookie，路径限定为对应的短链接
+const variantCookieName = "shortener_variant"
+
+// variantCookieMaxAge 版本 Cookie 的有效期
+const variantCookieMaxAge = 30 * 24 * time.Hour
+
 // URLHandler URL 相关的 HTTP 处理器
 type URLHandler struct {
 	urlService *services.URLService
@@ -36,7 +47,7 @@ func (h *URLHandler) ShortenURL(c *gin.Context) {
 	}
 
 	// 调用服务层创建短链接
-	response, err := h.urlService.ShortenURL(req.URL)
+	response, err := h.urlService.CreateShortURL(&req)
 	if err != nil {
 		switch err {
 		case services.ErrInvalidURL:
@@ -44,6 +55,71 @@ func (h *URLHandler) ShortenURL(c *gin.Context) {
 				Error:   "invalid_url",
 				Message: "The provided URL is not valid",
 			})
+		case services.ErrInvalidAlias:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_alias",
+				Message: "The alias contains invalid characters or has an invalid length",
+			})
+		case services.ErrAliasReserved:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "alias_reserved",
+				Message: "The alias is reserved and cannot be used",
+			})
+		case services.ErrAliasTaken:
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:   "alias_taken",
+				Message: "The alias is already in use",
+			})
+		case services.ErrInvalidExpiration:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_expiration",
+				Message: "Specify either a future expires_at or a positive ttl_seconds, not both",
+			})
+		case services.ErrInvalidSchedule:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_schedule",
+				Message: "deactivate_at must be in the future and after activate_at",
+			})
+		case services.ErrInvalidFallback:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_fallback_url",
+				Message: "The provided fallback URL is not valid",
+			})
+		case services.ErrInvalidPassword:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_password",
+				Message: "The password must be at most 72 bytes long",
+			})
+		case services.ErrInvalidRedirect:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_redirect_type",
+				Message: "redirect_type must be one of 301, 302, 307 or 308",
+			})
+		case services.ErrInvalidQueryMode:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_query_passthrough",
+				Message: "query_passthrough must be one of keep, override or append",
+			})
+		case services.ErrInvalidRules:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_rules",
+				Message: "Each rule needs a valid url and at least one known device, os, browser or language condition",
+			})
+		case services.ErrInvalidVariants:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_variants",
+				Message: "variants needs 2 to 10 entries with unique names, valid urls and weights adding up to more than 0, and cannot be combined with template",
+			})
+		case services.ErrInvalidTemplate:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_template",
+				Message: "The URL template must be an http(s) URL with {name} or {name=default} placeholders outside the host, and cannot be combined with path_passthrough",
+			})
+		case services.ErrInvalidClickLimit:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_click_limit",
+				Message: "A one-time link cannot have max_clicks greater than 1",
+			})
 		default:
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 				Error:   "internal_error",
@@ -56,13 +132,55 @@ func (h *URLHandler) ShortenURL(c *gin.Context) {
 	c.JSON(http.StatusCreated, response)
 }
 
-// RedirectURL 处理短链接重定向
+// RedirectURL 处理短链接重定向，短码之后的路径和查询参数按链接的设置转发，
+// User-Agent 和 Accept-Language 用于匹配链接的跳转规则，A/B 测试分到的版本记在 Cookie 中
 // GET /:shortCode
+// GET /:shortCode/*path
 func (h *URLHandler) RedirectURL(c *gin.Context) {
 	shortCode := c.Param("shortCode")
 
-	// 获取原始 URL
-	originalURL, err := h.urlService.GetOriginalURL(shortCode)
+	// 获取原始 URL，密码保护的链接需要带上解锁后签发的凭证
+	token, _ := c.Cookie(unlockCookieName)
+	variant, _ := c.Cookie(variantCookieName)
+	visit := &services.Visit{
+		Path:           c.Param("path"),
+		Query:          c.Request.URL.Query(),
+		UserAgent:      c.GetHeader("User-Agent"),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		ClientIP:       c.ClientIP(),
+		Variant:        variant,
+	}
+	redirect, err := h.urlService.ResolveRedirect(shortCode, token, visit)
+
+	var inactive *services.InactiveError
+	if errors.As(err, &inactive) {
+		h.redirectInactive(c, inactive)
+		return
+	}
+
+	var disabled *services.DisabledError
+	if errors.As(err, &disabled) {
+		message := disabled.Reason
+		if message == "" {
+			message = "Short URL has been disabled"
+		}
+		c.JSON(http.StatusGone, models.ErrorResponse{
+			Error:   "url_disabled",
+			Message: message,
+		})
+		return
+	}
+
+	// 模板无法用这次访问填充时告诉访问者缺少什么，而不是跳转到不完整的地址
+	var templateErr *services.TemplateError
+	if errors.As(err, &templateErr) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "template_error",
+			Message: templateErr.Message,
+		})
+		return
+	}
+
 	if err != nil {
 		switch err {
 		case services.ErrURLNotFound:
@@ -70,6 +188,28 @@ func (h *URLHandler) RedirectURL(c *gin.Context) {
 				Error:   "url_not_found",
 				Message: "Short URL not found",
 			})
+		case services.ErrInvalidPath:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_path",
+				Message: "Path cannot be appended to the destination",
+			})
+		case services.ErrPasswordRequired:
+			h.renderUnlockPage(c, http.StatusOK, "")
+		case services.ErrURLExpired:
+			c.JSON(http.StatusGone, models.ErrorResponse{
+				Error:   "url_expired",
+				Message: "Short URL has expired",
+			})
+		case services.ErrURLExhausted:
+			c.JSON(http.StatusGone, models.ErrorResponse{
+				Error:   "click_limit_reached",
+				Message: "Short URL has reached its click limit",
+			})
+		case services.ErrURLDeleted:
+			c.JSON(http.StatusGone, models.ErrorResponse{
+				Error:   "url_deleted",
+				Message: "Short URL has been deleted",
+			})
 		case services.ErrInvalidShortCode:
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Error:   "invalid_short_code",
@@ -84,8 +224,100 @@ func (h *URLHandler) RedirectURL(c *gin.Context) {
 		return
 	}
 
-	// 执行重定向
-	c.Redirect(http.StatusMovedPermanently, originalURL)
+	// 按链接设置的方式重定向，缓存策略与状态码一致
+	c.Header("Cache-Control", redirect.CacheControl)
+	if redirect.Vary != "" {
+		c.Header("Vary", redirect.Vary)
+	}
+	// 记下分到的版本，之后的访问留在同一个版本
+	if redirect.Variant != "" && redirect.Variant != variant {
+		c.SetSameSite(http.SameSiteLaxMode)
+		secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+		c.SetCookie(variantCookieName, redirect.Variant, int(variantCookieMaxAge.Seconds()), "/"+shortCode, "", secure, true)
+	}
+	c.Redirect(redirect.Status, redirect.URL)
+}
+
+// UnlockURL 处理密码保护链接的解锁表单，成功后回到原来访问的地址
+// POST /:shortCode
+// POST /:shortCode/*path
+func (h *URLHandler) UnlockURL(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	token, expiresAt, err := h.urlService.Unlock(shortCode, c.PostForm("password"))
+
+	var tooMany *services.TooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(tooMany.RetryAfter.Seconds())), 10))
+		h.renderUnlockPage(c, http.StatusTooManyRequests, "Too many failed attempts, please try again later")
+		return
+	}
+
+	switch err {
+	case nil:
+		// 凭证只对这个短链接有效，过期后需要重新输入密码
+		c.SetSameSite(http.SameSiteLaxMode)
+		secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+		c.SetCookie(unlockCookieName, token, int(time.Until(expiresAt).Seconds()), "/"+shortCode, "", secure, true)
+		c.Redirect(http.StatusSeeOther, c.Request.URL.RequestURI())
+	case services.ErrNoPassword:
+		c.Redirect(http.StatusSeeOther, c.Request.URL.RequestURI())
+	case services.ErrWrongPassword:
+		h.renderUnlockPage(c, http.StatusUnauthorized, "Incorrect password")
+	case services.ErrURLNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "url_not_found",
+			Message: "Short URL not found",
+		})
+	case services.ErrInvalidShortCode:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_short_code",
+			Message: "Invalid short code format",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to unlock URL",
+		})
+	}
+}
+
+// renderUnlockPage 返回密码输入页面，页面不能被缓存。
+// 表单提交到当前访问的地址，解锁后带着原来的路径和查询参数跳转。
+func (h *URLHandler) renderUnlockPage(c *gin.Context, status int, message string) {
+	c.Header("Cache-Control", "no-store")
+	c.Render(status, render.HTML{
+		Template: unlockPage,
+		Data:     unlockPageData{Action: c.Request.URL.RequestURI(), Error: message},
+	})
+}
+
+// redirectInactive 处理不在生效时间窗口内的链接：有备用地址时临时重定向过去，
+// 否则尚未生效返回 503 并通过 Retry-After 告知何时生效，已停止生效返回 410
+func (h *URLHandler) redirectInactive(c *gin.Context, inactive *services.InactiveError) {
+	if inactive.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(inactive.RetryAfter.Seconds())), 10))
+	}
+
+	if inactive.FallbackURL != "" {
+		// 链接生效后会跳转到别处，不能让客户端缓存这次重定向
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, inactive.FallbackURL)
+		return
+	}
+
+	if errors.Is(inactive, services.ErrURLNotYetActive) {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "url_not_yet_active",
+			Message: "Short URL is not active yet",
+		})
+		return
+	}
+
+	c.JSON(http.StatusGone, models.ErrorResponse{
+		Error:   "url_deactivated",
+		Message: "Short URL has been deactivated",
+	})
 }
 
 // GetURLInfo 处理获取短链接信息的请求
@@ -104,8 +336,9 @@ func (h *URLHandler) GetURLInfo(c *gin.Context) {
 			})
 		case services.ErrInvalidShortCode:
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{
-				Error:   "invalid_short_code",
-				Message: "Invalid short code format",
+				Error:       "invalid_short_code",
+				Message:     "Invalid short code format",
+				Suggestions: h.urlService.SuggestShortCodes(shortCode),
 			})
 		default:
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
@@ -119,6 +352,21 @@ func (h *URLHandler) GetURLInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, urlInfo)
 }
 
+// GetStats 处理获取服务统计信息的请求
+// GET /stats
+func (h *URLHandler) GetStats(c *gin.Context) {
+	stats, err := h.urlService.GetStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to retrieve statistics",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
 // HealthCheck 健康检查端点
 // GET /health
 func (h *URLHandler) HealthCheck(c *gin.Context) {
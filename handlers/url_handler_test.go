@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -18,20 +21,34 @@ import (
 )
 
 func setupTestRouter() (*gin.Engine, *URLHandler) {
+	return setupTestRouterWithConfig(&config.Config{
+		BaseURL: "http://localhost:8080",
+	})
+}
+
+func setupTestRouterWithConfig(cfg *config.Config) (*gin.Engine, *URLHandler) {
 	gin.SetMode(gin.TestMode)
-	
+
 	memStorage := storage.NewMemoryStorage()
-	cfg := &config.Config{
-		BaseURL: "http://localhost:8080",
-	}
 	urlService := services.NewURLService(memStorage, cfg)
 	urlHandler := NewURLHandler(urlService)
 	
 	router := gin.New()
 	router.POST("/shorten", urlHandler.ShortenURL)
 	router.GET("/:shortCode", urlHandler.RedirectURL)
+	router.GET("/:shortCode/*path", urlHandler.RedirectURL)
+	router.POST("/:shortCode", urlHandler.UnlockURL)
+	router.POST("/:shortCode/*path", urlHandler.UnlockURL)
 	router.GET("/info/:shortCode", urlHandler.GetURLInfo)
 	router.GET("/health", urlHandler.HealthCheck)
+	router.GET("/stats", urlHandler.GetStats)
+	router.PATCH("/links/:shortCode", urlHandler.UpdateURL)
+	router.GET("/links/:shortCode/history", urlHandler.GetHistory)
+	router.POST("/links/:shortCode/revert", urlHandler.RevertURL)
+	router.DELETE("/links/:shortCode", urlHandler.DeleteURL)
+	router.POST("/links/:shortCode/restore", urlHandler.RestoreURL)
+	router.POST("/links/:shortCode/disable", urlHandler.DisableURL)
+	router.POST("/links/:shortCode/enable", urlHandler.EnableURL)
 	
 	return router, urlHandler
 }
@@ -91,6 +108,537 @@ func TestURLHandler_ShortenURL(t *testing.T) {
 	})
 }
 
+func TestURLHandler_ShortenURLWithAlias(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	shorten := func(reqBody models.ShortenRequest) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Alias created", func(t *testing.T) {
+		w := shorten(models.ShortenRequest{URL: "https://www.example.com", Alias: "launch-2026"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response models.ShortenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "launch-2026", response.ShortCode)
+		assert.Equal(t, "http://localhost:8080/launch-2026", response.ShortURL)
+
+		req, _ := http.NewRequest("GET", "/launch-2026", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "https://www.example.com", w.Header().Get("Location"))
+	})
+
+	t.Run("Alias taken", func(t *testing.T) {
+		w := shorten(models.ShortenRequest{URL: "https://www.other.com", Alias: "launch-2026"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		var errorResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+		assert.Equal(t, "alias_taken", errorResp.Error)
+	})
+
+	t.Run("Invalid alias", func(t *testing.T) {
+		for _, alias := range []string{"ab", "has space", "bad!alias"} {
+			w := shorten(models.ShortenRequest{URL: "https://www.example.com", Alias: alias})
+			assert.Equal(t, http.StatusBadRequest, w.Code, "alias %q should be rejected", alias)
+
+			var errorResp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+			assert.Equal(t, "invalid_alias", errorResp.Error)
+		}
+	})
+}
+
+func TestURLHandler_ShortenURLWithExpiration(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("TTL", func(t *testing.T) {
+		w := shorten(`{"url": "https://www.example.com", "ttl_seconds": 60}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response models.ShortenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.ExpiresAt)
+
+		req, _ := http.NewRequest("GET", "/info/"+response.ShortCode, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var info models.URLInfoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		require.NotNil(t, info.ExpiresIn)
+		assert.InDelta(t, 60, *info.ExpiresIn, 1)
+	})
+
+	t.Run("Invalid expiration", func(t *testing.T) {
+		w := shorten(`{"url": "https://www.example.com", "ttl_seconds": -5}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var errorResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+		assert.Equal(t, "invalid_expiration", errorResp.Error)
+	})
+
+	t.Run("Expired link", func(t *testing.T) {
+		expiresAt := time.Now().Add(20 * time.Millisecond)
+		response, err := handler.urlService.CreateShortURL(&models.ShortenRequest{
+			URL:       "https://www.example.com",
+			ExpiresAt: &expiresAt,
+		})
+		require.NoError(t, err)
+		time.Sleep(30 * time.Millisecond)
+
+		req, _ := http.NewRequest("GET", "/"+response.ShortCode, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusGone, w.Code)
+
+		var errorResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+		assert.Equal(t, "url_expired", errorResp.Error)
+	})
+}
+
+func TestURLHandler_OneTimeLink(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	req, _ := http.NewRequest("POST", "/shorten", bytes.NewBufferString(`{"url": "https://www.example.com", "one_time": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.ShortenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uint64(1), response.MaxClicks)
+
+	// 一次性链接默认使用临时重定向，不能被浏览器缓存
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "click_limit_reached", errorResp.Error)
+}
+
+func TestURLHandler_RedirectType(t *testing.T) {
+	router, _ := setupTestRouterWithConfig(&config.Config{
+		BaseURL:             "http://localhost:8080",
+		DefaultRedirectType: http.StatusFound,
+	})
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := shorten(`{"url": "https://www.example.com", "redirect_type": 308}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response models.ShortenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusPermanentRedirect, response.RedirectType)
+
+	req, _ := http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "https://www.example.com", w.Header().Get("Location"))
+
+	// 没有单独设置时使用配置的默认值
+	w = shorten(`{"url": "https://www.example.com/default"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = shorten(`{"url": "https://www.example.com", "redirect_type": 303}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "invalid_redirect_type", errorResp.Error)
+}
+
+func TestURLHandler_RedirectInactive(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	activateAt := time.Now().Add(90 * time.Second)
+	pending, err := handler.urlService.CreateShortURL(&models.ShortenRequest{
+		URL:        "https://www.example.com",
+		ActivateAt: &activateAt,
+	})
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/"+pending.ShortCode, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "90", w.Header().Get("Retry-After"))
+
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "url_not_yet_active", errorResp.Error)
+
+	// 有备用地址时临时重定向过去
+	withFallback, err := handler.urlService.CreateShortURL(&models.ShortenRequest{
+		URL:         "https://www.example.com",
+		ActivateAt:  &activateAt,
+		FallbackURL: "https://www.example.com/soon",
+	})
+	require.NoError(t, err)
+
+	req, _ = http.NewRequest("GET", "/"+withFallback.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://www.example.com/soon", w.Header().Get("Location"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestURLHandler_PasswordProtected(t *testing.T) {
+	router, handler := setupTestRouterWithConfig(&config.Config{
+		BaseURL:          "http://localhost:8080",
+		PasswordHashCost: 4,
+	})
+
+	response, err := handler.urlService.CreateShortURL(&models.ShortenRequest{
+		URL:      "https://www.example.com/internal",
+		Password: "s3cret",
+	})
+	require.NoError(t, err)
+
+	// 没有凭证时显示解锁页面
+	req, _ := http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `action="/`+response.ShortCode+`"`)
+	assert.NotContains(t, w.Body.String(), "https://www.example.com/internal")
+
+	unlock := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {password}}
+		req, _ := http.NewRequest("POST", "/"+response.ShortCode, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w = unlock("wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Incorrect password")
+
+	w = unlock("s3cret")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/"+response.ShortCode, w.Header().Get("Location"))
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "/"+response.ShortCode, cookies[0].Path)
+	assert.True(t, cookies[0].HttpOnly)
+
+	// 带上凭证后正常重定向
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://www.example.com/internal", w.Header().Get("Location"))
+}
+
+func TestURLHandler_PasswordProtectedPending(t *testing.T) {
+	router, handler := setupTestRouterWithConfig(&config.Config{
+		BaseURL:          "http://localhost:8080",
+		PasswordHashCost: 4,
+	})
+
+	activateAt := time.Now().Add(time.Hour)
+	response, err := handler.urlService.CreateShortURL(&models.ShortenRequest{
+		URL:         "https://www.example.com/launch",
+		Password:    "s3cret",
+		ActivateAt:  &activateAt,
+		FallbackURL: "https://www.example.com/teaser",
+	})
+	require.NoError(t, err)
+
+	// 没有凭证时只显示解锁页面，不透露生效时间和备用地址
+	req, _ := http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+	assert.NotContains(t, w.Body.String(), "https://www.example.com/teaser")
+
+	form := url.Values{"password": {"s3cret"}}
+	req, _ = http.NewRequest("POST", "/"+response.ShortCode, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	// 解锁之后才按生效时间跳转到备用地址
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "https://www.example.com/teaser", w.Header().Get("Location"))
+}
+
+func TestURLHandler_Passthrough(t *testing.T) {
+	router, handler := setupTestRouterWithConfig(&config.Config{
+		BaseURL:          "http://localhost:8080",
+		PasswordHashCost: 4,
+	})
+
+	response, err := handler.urlService.CreateShortURL(&models.ShortenRequest{
+		URL:              "https://docs.example.com/v2?ref=short",
+		QueryPassthrough: models.QueryOverride,
+		PathPassthrough:  true,
+	})
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/"+response.ShortCode+"/guide/getting%20started?ref=mail&lang=en", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://docs.example.com/v2/guide/getting%20started?lang=en&ref=mail", w.Header().Get("Location"))
+
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode+"/a/../../admin", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "invalid_path", errorResp.Error)
+
+	// 没有开启路径转发的链接不匹配带路径的访问
+	plain, err := handler.urlService.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+	req, _ = http.NewRequest("GET", "/"+plain.ShortCode+"/extra", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 解锁页面提交到原来访问的地址，解锁后带着路径和查询参数回到那里
+	protected, err := handler.urlService.CreateShortURL(&models.ShortenRequest{
+		URL:              "https://www.example.com/files",
+		Password:         "s3cret",
+		QueryPassthrough: models.QueryKeep,
+		PathPassthrough:  true,
+	})
+	require.NoError(t, err)
+
+	req, _ = http.NewRequest("GET", "/"+protected.ShortCode+"/report.pdf?v=2", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `action="/`+protected.ShortCode+`/report.pdf?v=2"`)
+
+	form := url.Values{"password": {"s3cret"}}
+	req, _ = http.NewRequest("POST", "/"+protected.ShortCode+"/report.pdf?v=2", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/"+protected.ShortCode+"/report.pdf?v=2", w.Header().Get("Location"))
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	req, _ = http.NewRequest("GET", "/"+protected.ShortCode+"/report.pdf?v=2", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://www.example.com/files/report.pdf?v=2", w.Header().Get("Location"))
+}
+
+func TestURLHandler_Template(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := shorten(`{"url": "https://github.com/{org}/{repo=.github}", "template": true}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response models.ShortenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []string{"org", "repo"}, response.TemplateVariables)
+
+	req, _ := http.NewRequest("GET", "/"+response.ShortCode+"/anthropics", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://github.com/anthropics/.github", w.Header().Get("Location"))
+
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode+"?org=golang&repo=go", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "https://github.com/golang/go", w.Header().Get("Location"))
+
+	// 缺少没有默认值的变量时返回 400，而不是跳转到不完整的地址
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "template_error", errorResp.Error)
+	assert.Equal(t, "missing value for {org}", errorResp.Message)
+
+	w = shorten(`{"url": "https://github.com/anthropics", "template": true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "invalid_template", errorResp.Error)
+}
+
+func TestURLHandler_Rules(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	body := `{"url": "https://www.example.com/app", "rules": [
+		{"os": "ios", "url": "https://apps.apple.com/app/id1"},
+		{"os": "android", "url": "https://play.google.com/store/apps/details?id=com.example"}
+	]}`
+	req, _ := http.NewRequest("POST", "/shorten", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response models.ShortenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	visit := func(userAgent string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/"+response.ShortCode, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w = visit("Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1")
+	assert.Equal(t, "https://apps.apple.com/app/id1", w.Header().Get("Location"))
+	assert.Equal(t, "User-Agent, Accept-Language", w.Header().Get("Vary"))
+
+	w = visit("Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Mobile Safari/537.36")
+	assert.Equal(t, "https://play.google.com/store/apps/details?id=com.example", w.Header().Get("Location"))
+
+	w = visit("Mozilla/5.0 (X11; Linux x86_64; rv:124.0) Gecko/20100101 Firefox/124.0")
+	assert.Equal(t, "https://www.example.com/app", w.Header().Get("Location"))
+
+	req, _ = http.NewRequest("POST", "/shorten", bytes.NewBufferString(`{"url": "https://www.example.com", "rules": [{"os": "palm", "url": "https://www.example.com/palm"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "invalid_rules", errorResp.Error)
+}
+
+func TestURLHandler_Variants(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	body := `{"url": "https://www.example.com", "variants": [
+		{"name": "a", "url": "https://www.example.com/a", "weight": 1},
+		{"name": "b", "url": "https://www.example.com/b", "weight": 1}
+	]}`
+	req, _ := http.NewRequest("POST", "/shorten", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response models.ShortenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Variants, 2)
+	assert.Equal(t, 0.5, response.Variants[0].Share)
+
+	// 第一次访问分配版本并写入只对这个短链接有效的 Cookie
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "User-Agent, Cookie", w.Header().Get("Vary"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "shortener_variant", cookies[0].Name)
+	assert.Equal(t, "/"+response.ShortCode, cookies[0].Path)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, "https://www.example.com/"+cookies[0].Value, w.Header().Get("Location"))
+
+	// 带着 Cookie 访问时留在同一个版本，不再重复写入
+	other := "a"
+	if cookies[0].Value == "a" {
+		other = "b"
+	}
+	req, _ = http.NewRequest("GET", "/"+response.ShortCode, nil)
+	req.AddCookie(&http.Cookie{Name: "shortener_variant", Value: other})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "https://www.example.com/"+other, w.Header().Get("Location"))
+	assert.Empty(t, w.Result().Cookies())
+
+	req, _ = http.NewRequest("GET", "/info/"+response.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var info models.URLInfoResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	require.Len(t, info.Variants, 2)
+	assert.Equal(t, uint64(1), info.Variants[0].Clicks)
+	assert.Equal(t, uint64(1), info.Variants[1].Clicks)
+
+	req, _ = http.NewRequest("POST", "/shorten", bytes.NewBufferString(`{"url": "https://www.example.com", "variants": [{"url": "https://www.example.com/a", "weight": 1}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "invalid_variants", errorResp.Error)
+}
+
 func TestURLHandler_RedirectURL(t *testing.T) {
 	router, _ := setupTestRouter()
 
@@ -170,6 +718,46 @@ func TestURLHandler_GetURLInfo(t *testing.T) {
 	})
 }
 
+func TestURLHandler_GetURLInfoSuggestions(t *testing.T) {
+	router, handler := setupTestRouterWithConfig(&config.Config{
+		BaseURL:            "http://localhost:8080",
+		ShortCodeCheckChar: true,
+	})
+
+	response, err := handler.urlService.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+
+	typo := []byte(response.ShortCode)
+	typo[0] = 'x'
+
+	req, _ := http.NewRequest("GET", "/info/"+string(typo), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errorResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+	assert.Equal(t, "invalid_short_code", errorResp.Error)
+	assert.Equal(t, []string{response.ShortCode}, errorResp.Suggestions)
+}
+
+func TestURLHandler_GetStats(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	req, _ := http.NewRequest("GET", "/stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(0), response["total_urls"])
+}
+
 func TestURLHandler_HealthCheck(t *testing.T) {
 	router, _ := setupTestRouter()
 
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gin-url-shortener/models"
+)
+
+// DeleteURL 处理删除短链接的请求，链接移入回收站，保留期内可以恢复
+// DELETE /links/:shortCode
+func (h *URLHandler) DeleteURL(c *gin.Context) {
+	response, err := h.urlService.DeleteURL(c.Param("shortCode"), editor(c))
+	if err != nil {
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RestoreURL 处理从回收站恢复短链接的请求
+// POST /links/:shortCode/restore
+func (h *URLHandler) RestoreURL(c *gin.Context) {
+	response, err := h.urlService.RestoreURL(c.Param("shortCode"), editor(c))
+	if err != nil {
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DisableURL 处理禁用短链接的请求，请求体可以省略
+// POST /links/:shortCode/disable
+func (h *URLHandler) DisableURL(c *gin.Context) {
+	var req models.DisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.urlService.DisableURL(c.Param("shortCode"), req.Reason, editor(c))
+	if err != nil {
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// EnableURL 处理解除禁用的请求
+// POST /links/:shortCode/enable
+func (h *URLHandler) EnableURL(c *gin.Context) {
+	response, err := h.urlService.EnableURL(c.Param("shortCode"), editor(c))
+	if err != nil {
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
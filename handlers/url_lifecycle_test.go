@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/services"
+	"gin-url-shortener/storage"
+)
+
+func TestURLHandler_DeleteDisableRestore(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	created, err := handler.urlService.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Actor", "moderator")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	errorCode := func(w *httptest.ResponseRecorder) models.ErrorResponse {
+		var errorResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+		return errorResp
+	}
+
+	// 禁用的链接返回 410 和禁用原因
+	w := send("POST", "/links/"+created.ShortCode+"/disable", `{"reason": "Reported as phishing"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var info models.URLInfoResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.True(t, info.Disabled)
+
+	w = send("GET", "/"+created.ShortCode, "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	resp := errorCode(w)
+	assert.Equal(t, "url_disabled", resp.Error)
+	assert.Equal(t, "Reported as phishing", resp.Message)
+
+	w = send("POST", "/links/"+created.ShortCode+"/enable", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	w = send("POST", "/links/"+created.ShortCode+"/enable", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "not_disabled", errorCode(w).Error)
+
+	// 删除后进入回收站，访问返回 410，恢复前不能修改
+	w = send("DELETE", "/links/"+created.ShortCode, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	require.NotNil(t, info.PurgeAt)
+
+	w = send("GET", "/"+created.ShortCode, "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "url_deleted", errorCode(w).Error)
+
+	w = send("PATCH", "/links/"+created.ShortCode, `{"url": "https://www.example.org"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "url_deleted", errorCode(w).Error)
+
+	w = send("POST", "/links/"+created.ShortCode+"/restore", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	w = send("GET", "/"+created.ShortCode, "")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+
+	w = send("POST", "/links/"+created.ShortCode+"/restore", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "not_deleted", errorCode(w).Error)
+
+	w = send("DELETE", "/links/zzzzzz", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestURLHandler_ReapedLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStorage()
+	urlService := services.NewURLService(store, &config.Config{BaseURL: "http://localhost:8080"})
+	router := gin.New()
+	router.GET("/:shortCode", NewURLHandler(urlService).RedirectURL)
+
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	expiring, err := urlService.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	deleted, err := urlService.ShortenURL("https://www.example.org")
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(deleted.ShortCode))
+	time.Sleep(30 * time.Millisecond)
+
+	reaper, err := services.NewExpiryReaper(store, services.ExpiryReaperConfig{Interval: time.Hour})
+	require.NoError(t, err)
+	defer reaper.Close()
+	reaped, err := reaper.Reap(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, reaped)
+
+	visit := func(shortCode string) (int, string) {
+		req, _ := http.NewRequest("GET", "/"+shortCode, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var errorResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+		return w.Code, errorResp.Error
+	}
+
+	// 过期后被清理的链接仍然返回 410，其他原因删除的短码返回 404
+	status, code := visit(expiring.ShortCode)
+	assert.Equal(t, http.StatusGone, status)
+	assert.Equal(t, "url_expired", code)
+	status, code = visit(deleted.ShortCode)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "url_not_found", code)
+}
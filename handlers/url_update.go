@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/services"
+)
+
+// actorHeader 记录修改人的请求头，未提供时使用客户端 IP
+const actorHeader = "X-Actor"
+
+// passwordHeader 修改设置了密码的链接时携带链接当前访问密码的请求头
+const passwordHeader = "X-Link-Password"
+
+// UpdateURL 处理修改短链接的请求
+// PATCH /links/:shortCode
+func (h *URLHandler) UpdateURL(c *gin.Context) {
+	var req models.UpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.urlService.UpdateURL(c.Param("shortCode"), &req, editor(c))
+	if err != nil {
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevertURL 处理恢复到历史版本的请求
+// POST /links/:shortCode/revert
+func (h *URLHandler) RevertURL(c *gin.Context) {
+	var req models.RevertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.urlService.RevertURL(c.Param("shortCode"), req.Revision, editor(c))
+	if err != nil {
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetHistory 处理查询修改历史的请求
+// GET /links/:shortCode/history
+func (h *URLHandler) GetHistory(c *gin.Context) {
+	history, err := h.urlService.GetHistory(c.Param("shortCode"))
+	if err != nil {
+		switch err {
+		case services.ErrURLNotFound:
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "url_not_found",
+				Message: "Short URL not found",
+			})
+		case services.ErrInvalidShortCode:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_short_code",
+				Message: "Invalid short code format",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "internal_error",
+				Message: "Failed to retrieve history",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// respondUpdateError 把修改、恢复、删除和禁用短链接的错误转换为响应
+func (h *URLHandler) respondUpdateError(c *gin.Context, err error) {
+	var tooMany *services.TooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(tooMany.RetryAfter.Seconds())), 10))
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Error:   "too_many_attempts",
+			Message: "Too many failed password attempts, please try again later",
+		})
+		return
+	}
+
+	switch err {
+	case services.ErrURLNotFound:
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "url_not_found",
+			Message: "Short URL not found",
+		})
+	case services.ErrInvalidShortCode:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_short_code",
+			Message: "Invalid short code format",
+		})
+	case services.ErrPasswordRequired:
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "password_required",
+			Message: "The short URL is password protected, send its current password in the " + passwordHeader + " header",
+		})
+	case services.ErrWrongPassword:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "wrong_password",
+			Message: "Incorrect password",
+		})
+	case services.ErrCannotAddPassword:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "password_not_allowed",
+			Message: "A password can only be added when the short URL is created",
+		})
+	case services.ErrNoChanges:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "no_changes",
+			Message: "The request does not contain any field to update",
+		})
+	case services.ErrInvalidURL:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_url",
+			Message: "The provided URL is not valid",
+		})
+	case services.ErrInvalidExpiration:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_expiration",
+			Message: "expires_at must be in the future",
+		})
+	case services.ErrInvalidSchedule:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_schedule",
+			Message: "deactivate_at must be in the future and after activate_at",
+		})
+	case services.ErrInvalidFallback:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_fallback_url",
+			Message: "The provided fallback URL is not valid",
+		})
+	case services.ErrInvalidPassword:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_password",
+			Message: "The password must be at most 72 bytes long",
+		})
+	case services.ErrInvalidRedirect:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_redirect_type",
+			Message: "redirect_type must be one of 301, 302, 307 or 308",
+		})
+	case services.ErrInvalidQueryMode:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_query_passthrough",
+			Message: "query_passthrough must be one of keep, override or append",
+		})
+	case services.ErrInvalidRules:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_rules",
+			Message: "Each rule needs a valid url and at least one known device, os, browser or language condition",
+		})
+	case services.ErrInvalidVariants:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_variants",
+			Message: "variants needs 2 to 10 entries with unique names, valid urls and weights adding up to more than 0, and cannot be combined with template",
+		})
+	case services.ErrInvalidTemplate:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_template",
+			Message: "The URL template must be an http(s) URL with {name} or {name=default} placeholders outside the host, and cannot be combined with path_passthrough",
+		})
+	case services.ErrInvalidRevision:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_revision",
+			Message: "revision must be an earlier revision of this short URL",
+		})
+	case services.ErrInvalidReason:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_reason",
+			Message: "The reason must be at most 500 characters long",
+		})
+	case services.ErrRevisionConflict:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "revision_conflict",
+			Message: "The short URL was modified concurrently, please retry",
+		})
+	case services.ErrURLDeleted:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "url_deleted",
+			Message: "The short URL is in the trash, restore it first",
+		})
+	case services.ErrNotDeleted:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "not_deleted",
+			Message: "The short URL is not in the trash",
+		})
+	case services.ErrNotDisabled:
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "not_disabled",
+			Message: "The short URL is not disabled",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to update short URL",
+		})
+	}
+}
+
+// editor 返回发起修改的人，优先使用 X-Actor 请求头，访问密码取自 X-Link-Password 请求头
+func editor(c *gin.Context) services.Editor {
+	name := c.GetHeader(actorHeader)
+	if name == "" {
+		name = c.ClientIP()
+	}
+	return services.Editor{Name: name, Address: c.ClientIP(), Password: c.GetHeader(passwordHeader)}
+}
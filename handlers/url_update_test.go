@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/services"
+)
+
+func TestURLHandler_UpdateAndRevert(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	created, err := handler.urlService.ShortenURL("https://www.exmaple.com")
+	require.NoError(t, err)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Actor", "alice")
+		req.RemoteAddr = "192.0.2.1:4321"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("PATCH", "/links/"+created.ShortCode, `{"url": "https://www.example.com"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var info models.URLInfoResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "https://www.example.com", info.OriginalURL)
+	assert.Equal(t, 2, info.Revision)
+
+	req, _ := http.NewRequest("GET", "/"+created.ShortCode, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "https://www.example.com", w.Header().Get("Location"))
+
+	w = send("GET", "/links/"+created.ShortCode+"/history", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var history models.HistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history.Revisions, 2)
+	assert.Equal(t, "alice", history.Revisions[1].Actor)
+	assert.Equal(t, "192.0.2.1", history.Revisions[1].ActorIP)
+
+	w = send("POST", "/links/"+created.ShortCode+"/revert", `{"revision": 1}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "https://www.exmaple.com", info.OriginalURL)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"empty patch", "PATCH", "/links/" + created.ShortCode, `{}`, http.StatusBadRequest, "no_changes"},
+		{"invalid url", "PATCH", "/links/" + created.ShortCode, `{"url": "not a url"}`, http.StatusBadRequest, "invalid_url"},
+		{"unknown link", "PATCH", "/links/zzzzzz", `{"url": "https://www.example.com"}`, http.StatusNotFound, "url_not_found"},
+		{"current revision", "POST", "/links/" + created.ShortCode + "/revert", `{"revision": 3}`, http.StatusBadRequest, "invalid_revision"},
+		{"missing revision", "POST", "/links/" + created.ShortCode + "/revert", `{}`, http.StatusBadRequest, "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			var errorResp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+			assert.Equal(t, tt.wantError, errorResp.Error)
+		})
+	}
+}
+
+func TestURLHandler_UpdateProtected(t *testing.T) {
+	router, handler := setupTestRouterWithConfig(&config.Config{
+		BaseURL:          "http://localhost:8080",
+		PasswordHashCost: 4,
+	})
+
+	created, err := handler.urlService.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com/v1", Password: "s3cret"})
+	require.NoError(t, err)
+	_, err = handler.urlService.UpdateURL(created.ShortCode, &models.UpdateRequest{
+		MaxClicks: models.Optional[uint64]{Set: true},
+	}, services.Editor{Name: "alice", Password: "s3cret"})
+	require.NoError(t, err)
+	plain, err := handler.urlService.ShortenURL("https://www.example.com/plain")
+	require.NoError(t, err)
+
+	send := func(method, path, body, password string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if password != "" {
+			req.Header.Set("X-Link-Password", password)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		password   string
+		wantStatus int
+		wantError  string
+	}{
+		{"anonymous patch", "PATCH", "/links/" + created.ShortCode, `{"password": null}`, "", http.StatusUnauthorized, "password_required"},
+		{"anonymous revert", "POST", "/links/" + created.ShortCode + "/revert", `{"revision": 1}`, "", http.StatusUnauthorized, "password_required"},
+		{"anonymous delete", "DELETE", "/links/" + created.ShortCode, "", "", http.StatusUnauthorized, "password_required"},
+		{"wrong password", "PATCH", "/links/" + created.ShortCode, `{"password": null}`, "guess", http.StatusForbidden, "wrong_password"},
+		{"anonymous password", "PATCH", "/links/" + plain.ShortCode, `{"password": "mine"}`, "", http.StatusForbidden, "password_not_allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.body, tt.password)
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			var errorResp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errorResp))
+			assert.Equal(t, tt.wantError, errorResp.Error)
+		})
+	}
+
+	// 被拒绝的修改没有生效，访问仍然需要密码
+	req, _ := http.NewRequest("GET", "/"+created.ShortCode, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+
+	w = send("PATCH", "/links/"+created.ShortCode, `{"password": null}`, "s3cret")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info models.URLInfoResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.False(t, info.PasswordProtected)
+	assert.Equal(t, "https://www.example.com/v1", info.OriginalURL)
+}
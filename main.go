@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 
 	"gin-url-shortener/config"
 	"gin-url-shortener/handlers"
 	"gin-url-shortener/services"
 	"gin-url-shortener/storage"
+	"gin-url-shortener/utils"
 )
 
 func main() {
@@ -20,12 +28,83 @@ func main() {
 	if !cfg.IsValidPort() {
 		log.Fatalf("Invalid port configuration: %s", cfg.Port)
 	}
+	if !cfg.IsValidRedirectType() {
+		log.Fatalf("Invalid default redirect type: %d", cfg.DefaultRedirectType)
+	}
 
 	// 初始化存储
-	memStorage := storage.NewMemoryStorage()
+	store, err := newStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// 内存存储本身就在进程内，其他后端在前面加一层读缓存；Redis 后端通过 Pub/Sub 在实例之间同步失效
+	if cfg.CacheSize > 0 && cfg.StorageDriver != "memory" {
+		store = storage.NewCachedStore(store, storage.CacheConfig{
+			Size:        cfg.CacheSize,
+			TTL:         cfg.CacheTTL,
+			NegativeTTL: cfg.CacheNegativeTTL,
+		})
+	}
+	defer store.Close()
+
+	codes, err := newCodeGenerator(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize short code generator: %v", err)
+	}
 
 	// 初始化服务
-	urlService := services.NewURLService(memStorage, cfg)
+	urlService := services.NewURLService(store, cfg)
+	urlService.SetCodeGenerator(codes)
+
+	// 保留字：路由路径在注册路由后加入，屏蔽词从文件读取
+	reserved := utils.NewReservedCodes()
+	if cfg.DenyListFile != "" {
+		if err := reserved.LoadDenyList(cfg.DenyListFile); err != nil {
+			log.Fatalf("Failed to load deny list: %v", err)
+		}
+	}
+	urlService.SetReservedCodes(reserved)
+
+	// 异步记录点击，避免存储写入拖慢重定向
+	var clicks *services.ClickRecorder
+	if cfg.ClickQueueSize > 0 {
+		clicks = services.NewClickRecorder(store, services.ClickRecorderConfig{
+			QueueSize:     cfg.ClickQueueSize,
+			BatchSize:     cfg.ClickBatchSize,
+			FlushInterval: cfg.ClickFlushInterval,
+			Policy:        services.QueueFullPolicy(cfg.ClickQueuePolicy),
+		})
+		urlService.SetClickRecorder(clicks)
+	}
+
+	// 后台删除已过期的链接
+	var reaper *services.ExpiryReaper
+	if cfg.ReaperInterval > 0 {
+		reaper, err = services.NewExpiryReaper(store, services.ExpiryReaperConfig{
+			Interval:    cfg.ReaperInterval,
+			BatchSize:   cfg.ReaperBatchSize,
+			ArchivePath: cfg.ExpiredArchivePath,
+		})
+		if err != nil {
+			log.Fatalf("Failed to start expiry reaper: %v", err)
+		}
+		urlService.SetExpiryReaper(reaper)
+	}
+
+	// 按访问者 IP 查询国家和大洲，地址库文件更新后自动重新加载
+	var geo *services.GeoLocator
+	if cfg.GeoIPPath != "" {
+		geo, err = services.NewGeoLocator(services.GeoLocatorConfig{
+			Path:           cfg.GeoIPPath,
+			CacheSize:      cfg.GeoIPCacheSize,
+			ReloadInterval: cfg.GeoIPReloadInterval,
+		})
+		if err != nil {
+			log.Fatalf("Failed to load GeoIP database: %v", err)
+		}
+		urlService.SetGeoLocator(geo)
+	}
 
 	// 初始化处理器
 	urlHandler := handlers.NewURLHandler(urlService)
@@ -47,13 +126,98 @@ func main() {
 
 	// 注册路由
 	setupRoutes(router, urlHandler)
+	handlers.ReserveRoutes(router, reserved)
 
 	// 启动服务器
 	log.Printf("Starting server on port %s", cfg.Port)
 	log.Printf("Base URL: %s", cfg.BaseURL)
-	
-	if err := router.Run(cfg.GetPort()); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	log.Printf("Storage driver: %s", cfg.StorageDriver)
+
+	server := &http.Server{
+		Addr:    cfg.GetPort(),
+		Handler: router,
+	}
+
+	// 收到退出信号后优雅关闭：先停止接收请求，再写入剩余的点击，最后关闭存储
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 服务器出错时同样走下面的关闭流程，保证剩余的点击写入、存储正常关闭
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down server...")
+	case err := <-serverErr:
+		log.Printf("Server error: %v, shutting down...", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	if clicks != nil {
+		clicks.Close()
+	}
+	if reaper != nil {
+		reaper.Close()
+	}
+	if geo != nil {
+		geo.Close()
+	}
+}
+
+// newStore 根据配置创建存储后端
+func newStore(cfg *config.Config) (storage.Store, error) {
+	switch cfg.StorageDriver {
+	case "memory":
+		if cfg.JournalDir == "" {
+			return storage.NewMemoryStorage(), nil
+		}
+		return storage.OpenMemoryStorage(storage.JournalConfig{
+			Dir:              cfg.JournalDir,
+			SyncPolicy:       storage.SyncPolicy(cfg.JournalSync),
+			SyncInterval:     cfg.JournalSyncInterval,
+			SnapshotInterval: cfg.SnapshotInterval,
+		})
+	case "sqlite":
+		return storage.NewSQLiteStorage(cfg.DatabasePath)
+	case "bolt":
+		return storage.NewBoltStorage(cfg.BoltPath)
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		return storage.NewRedisStorage(client, cfg.RedisKeyPrefix)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.StorageDriver)
+	}
+}
+
+// newCodeGenerator 根据配置创建短码生成策略
+func newCodeGenerator(cfg *config.Config) (utils.CodeGenerator, error) {
+	switch cfg.ShortCodeStrategy {
+	case "sequential":
+		var obfuscator *utils.IDObfuscator
+		if cfg.ShortCodeSecret != "" {
+			obfuscator = utils.NewIDObfuscator(cfg.ShortCodeSecret, cfg.ShortCodeMinLength)
+		}
+		return utils.NewSequentialGenerator(obfuscator), nil
+	case "random":
+		return utils.NewRandomGenerator(cfg.ShortCodeLength), nil
+	case "hash":
+		return utils.NewHashGenerator(cfg.ShortCodeLength), nil
+	default:
+		return nil, fmt.Errorf("unknown short code strategy: %s", cfg.ShortCodeStrategy)
 	}
 }
 
@@ -67,8 +231,17 @@ func setupRoutes(router *gin.Engine, urlHandler *handlers.URLHandler) {
 			"endpoints": gin.H{
 				"shorten":     "POST /shorten",
 				"redirect":    "GET /:shortCode",
+				"unlock":      "POST /:shortCode",
 				"info":        "GET /info/:shortCode",
+				"update":      "PATCH /links/:shortCode",
+				"history":     "GET /links/:shortCode/history",
+				"revert":      "POST /links/:shortCode/revert",
+				"delete":      "DELETE /links/:shortCode",
+				"restore":     "POST /links/:shortCode/restore",
+				"disable":     "POST /links/:shortCode/disable",
+				"enable":      "POST /links/:shortCode/enable",
 				"health":      "GET /health",
+				"stats":       "GET /stats",
 			},
 		})
 	})
@@ -79,17 +252,31 @@ func setupRoutes(router *gin.Engine, urlHandler *handlers.URLHandler) {
 	// 短链接相关 API
 	router.POST("/shorten", urlHandler.ShortenURL)
 	router.GET("/info/:shortCode", urlHandler.GetURLInfo)
+	router.GET("/stats", urlHandler.GetStats)
+
+	// 修改短链接及其历史版本
+	router.PATCH("/links/:shortCode", urlHandler.UpdateURL)
+	router.GET("/links/:shortCode/history", urlHandler.GetHistory)
+	router.POST("/links/:shortCode/revert", urlHandler.RevertURL)
+	router.DELETE("/links/:shortCode", urlHandler.DeleteURL)
+	router.POST("/links/:shortCode/restore", urlHandler.RestoreURL)
+	router.POST("/links/:shortCode/disable", urlHandler.DisableURL)
+	router.POST("/links/:shortCode/enable", urlHandler.EnableURL)
 
-	// 短链接重定向（放在最后，避免与其他路由冲突）
+	// 短链接重定向（放在最后，避免与其他路由冲突），POST 提交密码保护链接的解锁表单；
+	// 带路径的形式用于开启了路径转发的链接
 	router.GET("/:shortCode", urlHandler.RedirectURL)
+	router.GET("/:shortCode/*path", urlHandler.RedirectURL)
+	router.POST("/:shortCode", urlHandler.UnlockURL)
+	router.POST("/:shortCode/*path", urlHandler.UnlockURL)
 }
 
 // corsMiddleware CORS 中间件
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Actor")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 修改历史的操作类型
+const (
+	RevisionCreate = "create" // 创建时的初始版本
+	RevisionUpdate = "update" // 通过 PATCH 修改
+	RevisionRevert = "revert" // 恢复到之前的版本
+
+	RevisionDelete  = "delete"  // 移入回收站
+	RevisionRestore = "restore" // 从回收站恢复
+	RevisionDisable = "disable" // 禁用
+	RevisionEnable  = "enable"  // 解除禁用
+)
+
+// Revision 短链接的一个历史版本，保存该版本生效时的全部可变字段
+type Revision struct {
+	Number     int       `json:"revision"`              // 从 1 开始递增的版本号
+	ShortCode  string    `json:"short_code"`            // 所属短码
+	CreatedAt  time.Time `json:"created_at"`            // 版本产生的时间
+	Actor      string    `json:"actor,omitempty"`       // 修改人，由请求方自行声明
+	ActorIP    string    `json:"actor_ip,omitempty"`    // 发起修改的客户端地址，由服务端记录
+	Action     string    `json:"action"`                // create / update / revert / delete / restore / disable / enable
+	RevertedTo int       `json:"reverted_to,omitempty"` // revert 时恢复的版本号
+	Reason     string    `json:"reason,omitempty"`      // disable 时的禁用原因
+
+	OriginalURL  string     `json:"original_url"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxClicks    uint64     `json:"max_clicks,omitempty"`
+	ActivateAt   *time.Time `json:"activate_at,omitempty"`
+	DeactivateAt *time.Time `json:"deactivate_at,omitempty"`
+	FallbackURL  string     `json:"fallback_url,omitempty"`
+	PasswordHash string     `json:"password_hash,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool   `json:"path_passthrough,omitempty"`
+
+	Template bool           `json:"template,omitempty"`
+	Rules    []RedirectRule `json:"rules,omitempty"`
+	Variants []Variant      `json:"variants,omitempty"` // 不包含访问次数
+}
+
+// NewRevision 用记录当前的可变字段生成一个版本，版本号由调用方填写
+func NewRevision(u *URL, action, actor string, at time.Time) *Revision {
+	return &Revision{
+		ShortCode: u.ShortCode,
+		CreatedAt: at,
+		Actor:     actor,
+		Action:    action,
+
+		OriginalURL:  u.OriginalURL,
+		ExpiresAt:    u.ExpiresAt,
+		MaxClicks:    u.MaxClicks,
+		ActivateAt:   u.ActivateAt,
+		DeactivateAt: u.DeactivateAt,
+		FallbackURL:  u.FallbackURL,
+		PasswordHash: u.PasswordHash,
+		RedirectType: u.RedirectType,
+
+		QueryPassthrough: u.QueryPassthrough,
+		PathPassthrough:  u.PathPassthrough,
+
+		Template: u.Template,
+		Rules:    u.Rules,
+		Variants: CloneVariants(u.Variants, false),
+	}
+}
+
+// ApplyTo 把版本中的可变字段写回记录，短码、ID、创建时间、访问次数以及回收站和禁用状态保持不变。
+// 各版本的访问次数由存储在修改时按版本名保留。
+func (r *Revision) ApplyTo(u *URL) {
+	u.OriginalURL = r.OriginalURL
+	u.ExpiresAt = r.ExpiresAt
+	u.MaxClicks = r.MaxClicks
+	u.ActivateAt = r.ActivateAt
+	u.DeactivateAt = r.DeactivateAt
+	u.FallbackURL = r.FallbackURL
+	u.PasswordHash = r.PasswordHash
+	u.RedirectType = r.RedirectType
+	u.QueryPassthrough = r.QueryPassthrough
+	u.PathPassthrough = r.PathPassthrough
+	u.Template = r.Template
+	u.Rules = r.Rules
+	u.Variants = CloneVariants(r.Variants, false)
+}
+
+// Optional 区分 JSON 中字段未出现、为 null 和有值三种情况，用于 PATCH 请求
+type Optional[T any] struct {
+	Set   bool // 字段出现在请求中
+	Value *T   // 为 nil 时表示 null，即清除该设置
+}
+
+// UnmarshalJSON 只有字段出现在 JSON 中时才会被调用
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
+
+// UpdateRequest 修改短链接的请求，按 JSON Merge Patch 处理：未出现的字段保持不变，null 清除该设置
+type UpdateRequest struct {
+	URL          Optional[string]    `json:"url"`           // 新的目标地址，不能为 null
+	ExpiresAt    Optional[time.Time] `json:"expires_at"`    // 过期时间
+	MaxClicks    Optional[uint64]    `json:"max_clicks"`    // 最多访问次数，null 表示不限
+	ActivateAt   Optional[time.Time] `json:"activate_at"`   // 开始生效的时间
+	DeactivateAt Optional[time.Time] `json:"deactivate_at"` // 停止生效的时间
+	FallbackURL  Optional[string]    `json:"fallback_url"`  // 不在窗口内时跳转的地址
+	Password     Optional[string]    `json:"password"`      // 访问密码，null 或空字符串表示取消密码
+	RedirectType Optional[int]       `json:"redirect_type"` // 重定向状态码，null 表示使用全局配置
+
+	QueryPassthrough Optional[string] `json:"query_passthrough"` // 查询参数的合并方式，null 或空字符串表示不转发
+	PathPassthrough  Optional[bool]   `json:"path_passthrough"`  // 是否转发短码之后的路径，null 表示不转发
+
+	Template Optional[bool]           `json:"template"` // url 是否为模板，null 表示不是
+	Rules    Optional[[]RedirectRule] `json:"rules"`    // 整体替换跳转规则，null 或空数组表示清除
+	Variants Optional[[]Variant]      `json:"variants"` // 整体替换 A/B 测试的版本，同名版本保留访问次数，null 或空数组表示清除
+}
+
+// Empty 请求中是否没有任何要修改的字段
+func (r *UpdateRequest) Empty() bool {
+	return !r.URL.Set && !r.ExpiresAt.Set && !r.MaxClicks.Set && !r.ActivateAt.Set &&
+		!r.DeactivateAt.Set && !r.FallbackURL.Set && !r.Password.Set && !r.RedirectType.Set &&
+		!r.QueryPassthrough.Set && !r.PathPassthrough.Set && !r.Template.Set &&
+		!r.Rules.Set && !r.Variants.Set
+}
+
+// RevertRequest 恢复到历史版本的请求
+type RevertRequest struct {
+	Revision int `json:"revision" binding:"required"` // 要恢复的版本号
+}
+
+// RevisionResponse 修改历史中的一个版本，不包含密码哈希
+type RevisionResponse struct {
+	Revision   int       `json:"revision"`
+	CreatedAt  time.Time `json:"created_at"`
+	Actor      string    `json:"actor,omitempty"`
+	ActorIP    string    `json:"actor_ip,omitempty"`
+	Action     string    `json:"action"`
+	RevertedTo int       `json:"reverted_to,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+
+	OriginalURL       string     `json:"original_url"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	MaxClicks         uint64     `json:"max_clicks,omitempty"`
+	ActivateAt        *time.Time `json:"activate_at,omitempty"`
+	DeactivateAt      *time.Time `json:"deactivate_at,omitempty"`
+	FallbackURL       string     `json:"fallback_url,omitempty"`
+	PasswordProtected bool       `json:"password_protected,omitempty"`
+	RedirectType      int        `json:"redirect_type,omitempty"`
+	QueryPassthrough  string     `json:"query_passthrough,omitempty"`
+	PathPassthrough   bool       `json:"path_passthrough,omitempty"`
+	Template          bool       `json:"template,omitempty"`
+
+	Rules    []RedirectRule `json:"rules,omitempty"`
+	Variants []Variant      `json:"variants,omitempty"`
+}
+
+// DisableRequest 禁用短链接的请求
+type DisableRequest struct {
+	Reason string `json:"reason"` // 禁用原因，访问短链接时返回给用户
+}
+
+// HistoryResponse 短链接的修改历史，按版本号从旧到新排列
+type HistoryResponse struct {
+	ShortCode string              `json:"short_code"`
+	Revisions []*RevisionResponse `json:"revisions"`
+}
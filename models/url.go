@@ -1,44 +1,346 @@
 package models
 
 import (
+	"sync/atomic"
 	"time"
 )
 
+// 把访问请求中的查询参数合并到目标地址的方式，为空时忽略请求中的查询参数
+const (
+	QueryKeep     = "keep"     // 同名参数保留目标地址中的值
+	QueryOverride = "override" // 同名参数使用请求中的值
+	QueryAppend   = "append"   // 同名参数两边的值都保留，目标地址的在前
+)
+
+// RedirectRule 按访问者的客户端信息和地理位置选择目标地址的规则，所有非空条件都满足时匹配。
+// 国家和大洲代码是大写，其他值都是小写。
+type RedirectRule struct {
+	Device    string `json:"device,omitempty"`    // 设备类型：mobile、tablet、desktop 或 bot
+	OS        string `json:"os,omitempty"`        // 操作系统：ios、android、windows、macos、linux 或 chromeos
+	Browser   string `json:"browser,omitempty"`   // 浏览器：chrome、safari、firefox、edge、opera 或 samsung
+	Language  string `json:"language,omitempty"`  // 首选语言，如 zh 匹配 zh-CN 和 zh-TW
+	Country   string `json:"country,omitempty"`   // ISO 3166-1 两位国家代码，如 CN、US
+	Continent string `json:"continent,omitempty"` // 大洲代码：AF、AN、AS、EU、NA、OC 或 SA
+	URL       string `json:"url"`                 // 匹配时跳转的地址
+}
+
+// Variant A/B 测试中的一个目标地址，访问者按权重分到其中一个版本，之后固定访问同一个版本
+type Variant struct {
+	// Clicks 会被并发地原子更新；Weight 也是 64 位，32 位平台上数组中每个元素的 Clicks 都按 8 字节对齐
+	Clicks uint64 `json:"clicks,omitempty"` // 分到该版本的访问次数，由存储维护，请求中的值被忽略
+	Weight uint64 `json:"weight"`           // 权重，按各版本权重之和的比例分配新访问者，0 表示暂停分配
+	Name   string `json:"name"`             // 版本名，同一链接内唯一，记录在访问者的 Cookie 中
+	URL    string `json:"url"`              // 目标地址
+}
+
+// LoadClicks 原子地读取版本的访问次数
+func (v *Variant) LoadClicks() uint64 {
+	return atomic.LoadUint64(&v.Clicks)
+}
+
 // URL 表示一个短链接记录
 type URL struct {
-	ID          uint64    `json:"id"`          // 唯一标识符
-	OriginalURL string    `json:"original_url"` // 原始长 URL
-	ShortCode   string    `json:"short_code"`   // 短链接代码
-	CreatedAt   time.Time `json:"created_at"`   // 创建时间
-	AccessCount uint64    `json:"access_count"` // 访问次数
+	// AccessCount 会被并发地原子更新，放在首位保证 32 位平台上的 64 位对齐
+	AccessCount uint64     `json:"access_count"`         // 访问次数
+	ID          uint64     `json:"id"`                   // 唯一标识符
+	OriginalURL string     `json:"original_url"`         // 原始长 URL
+	ShortCode   string     `json:"short_code"`           // 短链接代码
+	CreatedAt   time.Time  `json:"created_at"`           // 创建时间
+	Custom      bool       `json:"custom,omitempty"`     // 是否为自定义别名
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // 过期时间，为 nil 时永不过期
+	MaxClicks   uint64     `json:"max_clicks,omitempty"` // 最多访问次数，0 表示不限
+
+	// 生效时间窗口，不在窗口内时不重定向到原始 URL
+	ActivateAt   *time.Time `json:"activate_at,omitempty"`   // 开始生效的时间，为 nil 时立即生效
+	DeactivateAt *time.Time `json:"deactivate_at,omitempty"` // 停止生效的时间，为 nil 时一直有效
+	FallbackURL  string     `json:"fallback_url,omitempty"`  // 不在窗口内时跳转的地址，为空时使用全局配置
+
+	PasswordHash string `json:"password_hash,omitempty"` // 访问密码的 bcrypt 哈希，为空时不需要密码
+	RedirectType int    `json:"redirect_type,omitempty"` // 重定向状态码，0 表示使用全局配置
+
+	// 访问请求的转发：短码之后的路径追加到目标地址的路径，查询参数按 QueryPassthrough 合并
+	QueryPassthrough string `json:"query_passthrough,omitempty"` // keep / override / append，为空时不转发
+	PathPassthrough  bool   `json:"path_passthrough,omitempty"`  // 是否转发短码之后的路径
+
+	// Template 为 true 时 OriginalURL 是带 {name} 占位符的模板，访问时用路径和查询参数填充
+	Template bool `json:"template,omitempty"`
+
+	// Rules 按顺序匹配的跳转规则，第一个匹配的规则决定目标地址，都不匹配时跳转到 OriginalURL
+	Rules []RedirectRule `json:"rules,omitempty"`
+
+	// Variants A/B 测试的目标地址，没有匹配的跳转规则时按访问者选择其中一个，为空时跳转到 OriginalURL
+	Variants []Variant `json:"variants,omitempty"`
+
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // 最近一次修改的时间，为 nil 时创建后没有修改过
+
+	// 回收站与禁用状态，不随历史版本恢复
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`      // 移入回收站的时间，为 nil 时不在回收站中
+	PurgeAt        *time.Time `json:"purge_at,omitempty"`        // 从回收站永久删除的时间
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`     // 被禁用的时间，为 nil 时未禁用
+	DisabledReason string     `json:"disabled_reason,omitempty"` // 禁用原因，访问时返回给用户
+}
+
+// Deduplicable 是否参与原始 URL 去重。
+// 只有不带任何额外设置的普通链接才会复用，别名和有期限的链接总是单独创建；
+// 修改过的链接不再参与去重，避免把别人改过的链接交给新的请求方。
+func (u *URL) Deduplicable() bool {
+	return !u.Custom && u.ExpiresAt == nil && u.MaxClicks == 0 &&
+		u.ActivateAt == nil && u.DeactivateAt == nil && u.FallbackURL == "" &&
+		u.PasswordHash == "" && u.RedirectType == 0 && u.QueryPassthrough == "" && !u.PathPassthrough &&
+		!u.Template && len(u.Rules) == 0 && len(u.Variants) == 0 && u.UpdatedAt == nil
+}
+
+// IsExpired 判断链接在指定时间是否已过期
+func (u *URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// ReapAt 返回记录应被后台任务删除的时间：过期时间和回收站清除时间中较早的一个，都没有时为 nil
+func (u *URL) ReapAt() *time.Time {
+	if u.PurgeAt != nil && (u.ExpiresAt == nil || u.PurgeAt.Before(*u.ExpiresAt)) {
+		return u.PurgeAt
+	}
+	return u.ExpiresAt
+}
+
+// IsPending 判断链接在指定时间是否尚未生效
+func (u *URL) IsPending(now time.Time) bool {
+	return u.ActivateAt != nil && now.Before(*u.ActivateAt)
+}
+
+// IsDeactivated 判断链接在指定时间是否已停止生效
+func (u *URL) IsDeactivated(now time.Time) bool {
+	return u.DeactivateAt != nil && !now.Before(*u.DeactivateAt)
+}
+
+// IsExhausted 判断链接的访问次数是否已用完
+func (u *URL) IsExhausted() bool {
+	return u.MaxClicks > 0 && u.LoadAccessCount() >= u.MaxClicks
+}
+
+// AddAccessCountWithin 原子地增加最多 delta 次访问，总数不超过 MaxClicks，返回实际增加的次数
+func (u *URL) AddAccessCountWithin(delta uint64) uint64 {
+	for {
+		current := u.LoadAccessCount()
+		added := delta
+		if u.MaxClicks > 0 {
+			if current >= u.MaxClicks {
+				return 0
+			}
+			if remaining := u.MaxClicks - current; added > remaining {
+				added = remaining
+			}
+		}
+
+		if atomic.CompareAndSwapUint64(&u.AccessCount, current, current+added) {
+			return added
+		}
+	}
+}
+
+// LoadAccessCount 原子地读取访问次数
+func (u *URL) LoadAccessCount() uint64 {
+	return atomic.LoadUint64(&u.AccessCount)
+}
+
+// AddAccessCount 原子地增加访问次数，返回增加后的值
+func (u *URL) AddAccessCount(delta uint64) uint64 {
+	return atomic.AddUint64(&u.AccessCount, delta)
+}
+
+// AddVariantClicks 原子地增加名为 name 的版本的访问次数，没有该版本时返回 false
+func (u *URL) AddVariantClicks(name string, delta uint64) bool {
+	for i := range u.Variants {
+		if u.Variants[i].Name == name {
+			atomic.AddUint64(&u.Variants[i].Clicks, delta)
+			return true
+		}
+	}
+	return false
+}
+
+// CopyVariantClicks 按版本名把 from 中各版本的访问次数复制过来，from 中没有的版本从 0 开始
+func (u *URL) CopyVariantClicks(from *URL) {
+	for i := range u.Variants {
+		u.Variants[i].Clicks = 0
+		for j := range from.Variants {
+			if from.Variants[j].Name == u.Variants[i].Name {
+				u.Variants[i].Clicks = from.Variants[j].LoadClicks()
+				break
+			}
+		}
+	}
+}
+
+// CloneVariants 返回版本列表的副本，访问次数通过原子操作读取；withClicks 为 false 时不复制访问次数
+func CloneVariants(variants []Variant, withClicks bool) []Variant {
+	if variants == nil {
+		return nil
+	}
+
+	cloned := make([]Variant, len(variants))
+	for i := range variants {
+		cloned[i] = Variant{Weight: variants[i].Weight, Name: variants[i].Name, URL: variants[i].URL}
+		if withClicks {
+			cloned[i].Clicks = variants[i].LoadClicks()
+		}
+	}
+	return cloned
+}
+
+// Clone 返回记录的副本，访问次数通过原子操作读取
+func (u *URL) Clone() *URL {
+	return &URL{
+		AccessCount: u.LoadAccessCount(),
+		ID:          u.ID,
+		OriginalURL: u.OriginalURL,
+		ShortCode:   u.ShortCode,
+		CreatedAt:   u.CreatedAt,
+		Custom:      u.Custom,
+		ExpiresAt:   u.ExpiresAt,
+		MaxClicks:   u.MaxClicks,
+
+		ActivateAt:   u.ActivateAt,
+		DeactivateAt: u.DeactivateAt,
+		FallbackURL:  u.FallbackURL,
+
+		PasswordHash: u.PasswordHash,
+		RedirectType: u.RedirectType,
+
+		QueryPassthrough: u.QueryPassthrough,
+		PathPassthrough:  u.PathPassthrough,
+
+		Template: u.Template,
+		Rules:    u.Rules,
+		Variants: CloneVariants(u.Variants, true),
+
+		UpdatedAt: u.UpdatedAt,
+
+		DeletedAt:      u.DeletedAt,
+		PurgeAt:        u.PurgeAt,
+		DisabledAt:     u.DisabledAt,
+		DisabledReason: u.DisabledReason,
+	}
 }
 
 // ShortenRequest 表示创建短链接的请求
 type ShortenRequest struct {
-	URL string `json:"url" binding:"required,url"` // 原始 URL，必填且必须是有效 URL
+	URL   string `json:"url" binding:"required,url"` // 原始 URL，必填且必须是有效 URL
+	Alias string `json:"alias"`                      // 自定义别名，可选；按原样作为短码，启用校验字符时也不追加校验字符
+
+	// 有效期，二选一，都不填时永不过期
+	ExpiresAt  *time.Time `json:"expires_at"`  // 过期时间
+	TTLSeconds int64      `json:"ttl_seconds"` // 从创建开始的有效秒数
+
+	// 访问次数限制，都不填时不限
+	MaxClicks uint64 `json:"max_clicks"` // 最多访问次数
+	OneTime   bool   `json:"one_time"`   // 一次性链接，第一次重定向后即失效
+
+	// 生效时间窗口，都不填时创建后立即生效且一直有效
+	ActivateAt   *time.Time `json:"activate_at"`   // 开始生效的时间
+	DeactivateAt *time.Time `json:"deactivate_at"` // 停止生效的时间
+	FallbackURL  string     `json:"fallback_url"`  // 不在窗口内时跳转的地址
+
+	Password     string `json:"password"`      // 访问密码，设置后访问短链接需要先输入密码
+	RedirectType int    `json:"redirect_type"` // 重定向状态码：301、302、307 或 308，不填时使用全局配置
+
+	QueryPassthrough string `json:"query_passthrough"` // 合并访问请求中的查询参数：keep、override 或 append
+	PathPassthrough  bool   `json:"path_passthrough"`  // 把短码之后的路径追加到目标地址
+
+	Template bool `json:"template"` // url 是带 {name} 或 {name=默认值} 占位符的模板
+
+	Rules []RedirectRule `json:"rules"` // 按设备、系统、浏览器和语言跳转的规则，都不匹配时跳转到 url
+
+	Variants []Variant `json:"variants"` // A/B 测试的目标地址及权重，设置后 url 只在没有访问者信息时使用
 }
 
 // ShortenResponse 表示创建短链接的响应
 type ShortenResponse struct {
-	ID          uint64    `json:"id"`
-	OriginalURL string    `json:"original_url"`
-	ShortCode   string    `json:"short_code"`
-	ShortURL    string    `json:"short_url"`    // 完整的短链接 URL
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uint64     `json:"id"`
+	OriginalURL string     `json:"original_url"`
+	ShortCode   string     `json:"short_code"`
+	ShortURL    string     `json:"short_url"` // 完整的短链接 URL
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	MaxClicks   uint64     `json:"max_clicks,omitempty"`
+
+	ActivateAt   *time.Time `json:"activate_at,omitempty"`
+	DeactivateAt *time.Time `json:"deactivate_at,omitempty"`
+	FallbackURL  string     `json:"fallback_url,omitempty"`
+
+	PasswordProtected bool `json:"password_protected,omitempty"`
+	RedirectType      int  `json:"redirect_type"` // 实际使用的重定向状态码
+
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool   `json:"path_passthrough,omitempty"`
+
+	Template          bool     `json:"template,omitempty"`
+	TemplateVariables []string `json:"template_variables,omitempty"` // 模板中的变量，按填充路径段的顺序排列
+
+	Rules []RedirectRule `json:"rules,omitempty"`
+
+	Variants []VariantInfo `json:"variants,omitempty"`
+}
+
+// VariantInfo A/B 测试中一个版本的设置和访问情况
+type VariantInfo struct {
+	Name   string  `json:"name"`
+	URL    string  `json:"url,omitempty"`
+	Weight uint64  `json:"weight"`
+	Share  float64 `json:"share"`  // 按权重分到的访问者比例，0 到 1
+	Clicks uint64  `json:"clicks"` // 分到该版本的访问次数
+	// ClickShare 该版本的访问次数占所有版本访问次数的比例，还没有访问时为 0
+	ClickShare float64 `json:"click_share"`
 }
 
 // URLInfoResponse 表示查询短链接信息的响应
 type URLInfoResponse struct {
-	ID          uint64    `json:"id"`
-	OriginalURL string    `json:"original_url"`
-	ShortCode   string    `json:"short_code"`
-	ShortURL    string    `json:"short_url"`
-	CreatedAt   time.Time `json:"created_at"`
-	AccessCount uint64    `json:"access_count"`
+	ID          uint64     `json:"id"`
+	OriginalURL string     `json:"original_url"`
+	ShortCode   string     `json:"short_code"`
+	ShortURL    string     `json:"short_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	AccessCount uint64     `json:"access_count"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn   *int64     `json:"expires_in,omitempty"` // 剩余有效秒数，已过期时为 0
+	Expired     bool       `json:"expired,omitempty"`
+	MaxClicks   uint64     `json:"max_clicks,omitempty"`
+	ClicksLeft  *uint64    `json:"clicks_left,omitempty"` // 剩余访问次数，只有限制了次数的链接返回
+	Exhausted   bool       `json:"exhausted,omitempty"`
+
+	ActivateAt   *time.Time `json:"activate_at,omitempty"`
+	DeactivateAt *time.Time `json:"deactivate_at,omitempty"`
+	FallbackURL  string     `json:"fallback_url,omitempty"`
+	Pending      bool       `json:"pending,omitempty"`     // 尚未生效
+	Deactivated  bool       `json:"deactivated,omitempty"` // 已停止生效
+
+	// PasswordProtected 为 true 时不返回原始 URL、备用地址、转发和模板设置
+	PasswordProtected bool `json:"password_protected,omitempty"`
+
+	RedirectType int `json:"redirect_type"` // 实际使用的重定向状态码
+
+	QueryPassthrough string `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool   `json:"path_passthrough,omitempty"`
+
+	Template          bool     `json:"template,omitempty"`
+	TemplateVariables []string `json:"template_variables,omitempty"`
+
+	Rules []RedirectRule `json:"rules,omitempty"` // PasswordProtected 为 true 时不返回
+
+	Variants []VariantInfo `json:"variants,omitempty"` // PasswordProtected 为 true 时不返回目标地址
+
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Revision  int        `json:"revision,omitempty"` // 当前版本号，只在修改后返回
+
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"` // 在回收站中时返回
+	PurgeAt        *time.Time `json:"purge_at,omitempty"`   // 将被永久删除的时间
+	Disabled       bool       `json:"disabled,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
 }
 
 // ErrorResponse 表示错误响应
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Error       string   `json:"error"`
+	Message     string   `json:"message,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"` // 短码输错时可能想访问的短码
 }
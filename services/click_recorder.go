@@ -0,0 +1,244 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gin-url-shortener/storage"
+)
+
+// QueueFullPolicy 点击队列已满时的处理策略
+type QueueFullPolicy string
+
+const (
+	QueueFullDrop  QueueFullPolicy = "drop"  // 丢弃本次点击并计数，不阻塞重定向
+	QueueFullBlock QueueFullPolicy = "block" // 等待队列有空位，保证不丢点击
+)
+
+// ClickRecorderConfig 异步点击记录配置
+type ClickRecorderConfig struct {
+	QueueSize     int             // 队列容量
+	BatchSize     int             // 攒够多少次点击就立即写入
+	FlushInterval time.Duration   // 最长多久写入一次
+	Policy        QueueFullPolicy // 队列满时的策略
+}
+
+// click 队列中的一次点击，variant 为分到的 A/B 测试版本，没有时为空
+type click struct {
+	shortCode string
+	variant   string
+}
+
+// ClickRecorder 将访问计数从重定向热路径移到后台：
+// 点击先进入有界队列，由后台 worker 按短码合并后批量写入存储。
+type ClickRecorder struct {
+	store  storage.Store
+	config ClickRecorderConfig
+	queue  chan click
+
+	// closeMutex 保证关闭后不会再有点击进入队列
+	closeMutex sync.RWMutex
+	closed     bool
+	stop       chan struct{}
+	done       chan struct{}
+
+	recorded uint64 // 成功写入存储的点击数
+	dropped  uint64 // 因队列已满被丢弃的点击数
+	failed   uint64 // 写入存储失败而丢失的点击数
+
+	variantsFailed uint64 // 写入存储失败而丢失的版本点击数
+}
+
+// NewClickRecorder 创建点击记录器并启动后台 worker
+func NewClickRecorder(store storage.Store, config ClickRecorderConfig) *ClickRecorder {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+
+	r := &ClickRecorder{
+		store:  store,
+		config: config,
+		queue:  make(chan click, config.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+
+	return r
+}
+
+// Record 记录一次点击。关闭之后的点击会直接同步写入存储。
+func (r *ClickRecorder) Record(shortCode string) {
+	r.RecordVariant(shortCode, "")
+}
+
+// RecordVariant 记录一次分到 A/B 测试版本 variant 的点击，同时累加链接和该版本的访问次数
+func (r *ClickRecorder) RecordVariant(shortCode, variant string) {
+	r.closeMutex.RLock()
+	defer r.closeMutex.RUnlock()
+
+	c := click{shortCode: shortCode, variant: variant}
+	if r.closed {
+		pending := newClickBatch()
+		pending.add(c)
+		r.flush(pending)
+		return
+	}
+
+	if r.config.Policy == QueueFullBlock {
+		r.queue <- c
+		return
+	}
+
+	select {
+	case r.queue <- c:
+	default:
+		if dropped := atomic.AddUint64(&r.dropped, 1); dropped&(dropped-1) == 0 {
+			// 只在丢弃数为 2 的幂时打印，避免队列持续满载时刷屏
+			log.Printf("click recorder: queue full, %d clicks dropped so far", dropped)
+		}
+	}
+}
+
+// Close 停止接收新的点击，写入队列中剩余的点击后返回
+func (r *ClickRecorder) Close() error {
+	r.closeMutex.Lock()
+	if r.closed {
+		r.closeMutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.closeMutex.Unlock()
+
+	close(r.stop)
+	<-r.done
+
+	return nil
+}
+
+// Stats 返回点击记录器的统计信息
+func (r *ClickRecorder) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"recorded": atomic.LoadUint64(&r.recorded),
+		"dropped":  atomic.LoadUint64(&r.dropped),
+		"failed":   atomic.LoadUint64(&r.failed),
+		"queued":   len(r.queue),
+
+		"variants_failed": atomic.LoadUint64(&r.variantsFailed),
+	}
+}
+
+// run 后台 worker：按数量或时间间隔批量写入
+func (r *ClickRecorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	pending := newClickBatch()
+	size := 0
+
+	flushPending := func() {
+		if size == 0 {
+			return
+		}
+		r.flush(pending)
+		pending = newClickBatch()
+		size = 0
+	}
+
+	for {
+		select {
+		case c := <-r.queue:
+			pending.add(c)
+			size++
+			if size >= r.config.BatchSize {
+				flushPending()
+			}
+		case <-ticker.C:
+			flushPending()
+		case <-r.stop:
+			// 关闭后队列不会再有新元素，取完剩余的点击再做最后一次写入
+			for {
+				select {
+				case c := <-r.queue:
+					pending.add(c)
+					size++
+				default:
+					flushPending()
+					return
+				}
+			}
+		}
+	}
+}
+
+// clickBatch 按短码和版本合并的一批点击
+type clickBatch struct {
+	counts   map[string]uint64            // shortCode -> 点击数
+	variants map[string]map[string]uint64 // shortCode -> 版本名 -> 点击数
+}
+
+func newClickBatch() *clickBatch {
+	return &clickBatch{
+		counts:   make(map[string]uint64),
+		variants: make(map[string]map[string]uint64),
+	}
+}
+
+// add 合并一次点击
+func (b *clickBatch) add(c click) {
+	b.counts[c.shortCode]++
+	if c.variant == "" {
+		return
+	}
+	if b.variants[c.shortCode] == nil {
+		b.variants[c.shortCode] = make(map[string]uint64)
+	}
+	b.variants[c.shortCode][c.variant]++
+}
+
+// flush 将一批点击写入存储，失败时记录日志和丢失的数量；存储只写入了一部分时只把没写入的计为丢失。
+// 版本的访问次数单独写入，不受链接的访问次数是否写入成功影响。
+func (r *ClickRecorder) flush(batch *clickBatch) {
+	var total uint64
+	for _, delta := range batch.counts {
+		total += delta
+	}
+
+	if err := r.store.AddAccessCounts(batch.counts); err != nil {
+		var applied uint64
+		var partial *storage.PartialCountError
+		if errors.As(err, &partial) && partial.Applied <= total {
+			applied = partial.Applied
+		}
+		atomic.AddUint64(&r.recorded, applied)
+		atomic.AddUint64(&r.failed, total-applied)
+		log.Printf("click recorder: failed to record %d clicks: %v", total-applied, err)
+	} else {
+		atomic.AddUint64(&r.recorded, total)
+	}
+
+	if len(batch.variants) == 0 {
+		return
+	}
+	if err := r.store.AddVariantClicks(batch.variants); err != nil {
+		var lost uint64
+		for _, variants := range batch.variants {
+			for _, delta := range variants {
+				lost += delta
+			}
+		}
+		atomic.AddUint64(&r.variantsFailed, lost)
+		log.Printf("click recorder: failed to record %d variant clicks: %v", lost, err)
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+// failingStore 批量写入总是失败的存储
+type failingStore struct {
+	storage.Store
+}
+
+func (s failingStore) AddAccessCounts(counts map[string]uint64) error {
+	return errors.New("backend unavailable")
+}
+
+func (s failingStore) AddVariantClicks(counts map[string]map[string]uint64) error {
+	return errors.New("backend unavailable")
+}
+
+func TestClickRecorder_FlushOnClose(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	saved, err := memStorage.Save(&models.URL{ID: 1, OriginalURL: "https://www.example.com", ShortCode: "1"})
+	require.NoError(t, err)
+
+	recorder := NewClickRecorder(memStorage, ClickRecorderConfig{
+		QueueSize:     100,
+		BatchSize:     1000,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+
+	for i := 0; i < 10; i++ {
+		recorder.Record(saved.ShortCode)
+	}
+	require.NoError(t, recorder.Close())
+
+	assert.Equal(t, uint64(10), saved.LoadAccessCount())
+	assert.Equal(t, uint64(10), recorder.Stats()["recorded"])
+
+	// 关闭后的点击同步写入
+	recorder.Record(saved.ShortCode)
+	assert.Equal(t, uint64(11), saved.LoadAccessCount())
+}
+
+func TestClickRecorder_FlushByBatchSize(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	saved, err := memStorage.Save(&models.URL{ID: 1, OriginalURL: "https://www.example.com", ShortCode: "1"})
+	require.NoError(t, err)
+
+	recorder := NewClickRecorder(memStorage, ClickRecorderConfig{
+		QueueSize:     100,
+		BatchSize:     5,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+	defer recorder.Close()
+
+	for i := 0; i < 5; i++ {
+		recorder.Record(saved.ShortCode)
+	}
+
+	assert.Eventually(t, func() bool {
+		return saved.LoadAccessCount() == 5
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestClickRecorder_FlushByInterval(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	saved, err := memStorage.Save(&models.URL{ID: 1, OriginalURL: "https://www.example.com", ShortCode: "1"})
+	require.NoError(t, err)
+
+	recorder := NewClickRecorder(memStorage, ClickRecorderConfig{
+		QueueSize:     100,
+		BatchSize:     1000,
+		FlushInterval: 10 * time.Millisecond,
+		Policy:        QueueFullBlock,
+	})
+	defer recorder.Close()
+
+	recorder.Record(saved.ShortCode)
+
+	assert.Eventually(t, func() bool {
+		return saved.LoadAccessCount() == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestClickRecorder_Variants(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	saved, err := memStorage.Save(&models.URL{
+		ID:          1,
+		OriginalURL: "https://www.example.com",
+		ShortCode:   "1",
+		Variants: []models.Variant{
+			{Name: "a", URL: "https://a.example.com", Weight: 1},
+			{Name: "b", URL: "https://b.example.com", Weight: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	recorder := NewClickRecorder(memStorage, ClickRecorderConfig{
+		QueueSize:     100,
+		BatchSize:     1000,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+
+	for i := 0; i < 3; i++ {
+		recorder.RecordVariant(saved.ShortCode, "a")
+	}
+	recorder.RecordVariant(saved.ShortCode, "b")
+	recorder.Record(saved.ShortCode)
+	require.NoError(t, recorder.Close())
+
+	assert.Equal(t, uint64(5), saved.LoadAccessCount())
+	assert.Equal(t, uint64(3), saved.Variants[0].LoadClicks())
+	assert.Equal(t, uint64(1), saved.Variants[1].LoadClicks())
+}
+
+func TestClickRecorder_DropWhenFull(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+
+	// 不启动 worker，直接构造一个已满的记录器
+	recorder := &ClickRecorder{
+		store:  memStorage,
+		config: ClickRecorderConfig{Policy: QueueFullDrop},
+		queue:  make(chan click, 1),
+	}
+
+	recorder.Record("a")
+	recorder.Record("b")
+	recorder.Record("c")
+
+	stats := recorder.Stats()
+	assert.Equal(t, uint64(2), stats["dropped"])
+	assert.Equal(t, 1, stats["queued"])
+}
+
+func TestClickRecorder_CountsFailedWrites(t *testing.T) {
+	recorder := NewClickRecorder(failingStore{}, ClickRecorderConfig{
+		QueueSize:     10,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+
+	recorder.Record("a")
+	recorder.Record("b")
+	require.NoError(t, recorder.Close())
+
+	stats := recorder.Stats()
+	assert.Equal(t, uint64(2), stats["failed"])
+	assert.Equal(t, uint64(0), stats["variants_failed"])
+	assert.Equal(t, uint64(0), stats["recorded"])
+}
+
+// partialStore 批量写入时只写入短码 a 就失败的存储
+type partialStore struct {
+	storage.Store
+}
+
+func (s partialStore) AddAccessCounts(counts map[string]uint64) error {
+	return &storage.PartialCountError{Applied: counts["a"], Err: errors.New("backend unavailable")}
+}
+
+func TestClickRecorder_CountsPartialWrites(t *testing.T) {
+	recorder := NewClickRecorder(partialStore{}, ClickRecorderConfig{
+		QueueSize:     10,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+
+	recorder.Record("a")
+	recorder.Record("a")
+	recorder.Record("b")
+	require.NoError(t, recorder.Close())
+
+	stats := recorder.Stats()
+	assert.Equal(t, uint64(1), stats["failed"])
+	assert.Equal(t, uint64(2), stats["recorded"])
+}
+
+// countsFailingStore 链接的访问次数写入失败、版本的访问次数正常写入的存储
+type countsFailingStore struct {
+	*storage.MemoryStorage
+}
+
+func (s countsFailingStore) AddAccessCounts(counts map[string]uint64) error {
+	return errors.New("backend unavailable")
+}
+
+func TestClickRecorder_VariantsSurviveFailedCounts(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	saved, err := memStorage.Save(&models.URL{
+		ID:          1,
+		OriginalURL: "https://www.example.com",
+		ShortCode:   "1",
+		Variants:    []models.Variant{{Name: "a", URL: "https://a.example.com", Weight: 1}},
+	})
+	require.NoError(t, err)
+
+	recorder := NewClickRecorder(countsFailingStore{memStorage}, ClickRecorderConfig{
+		QueueSize:     10,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+	recorder.RecordVariant(saved.ShortCode, "a")
+	recorder.RecordVariant(saved.ShortCode, "a")
+	require.NoError(t, recorder.Close())
+
+	// 链接的访问次数丢失并计数，版本的访问次数照常写入
+	assert.Equal(t, uint64(2), recorder.Stats()["failed"])
+	assert.Equal(t, uint64(0), saved.LoadAccessCount())
+	assert.Equal(t, uint64(2), saved.Variants[0].LoadClicks())
+}
+
+func TestClickRecorder_CountsFailedVariants(t *testing.T) {
+	recorder := NewClickRecorder(failingStore{}, ClickRecorderConfig{
+		QueueSize:     10,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+	recorder.RecordVariant("a", "x")
+	recorder.RecordVariant("a", "y")
+	recorder.Record("b")
+	require.NoError(t, recorder.Close())
+
+	stats := recorder.Stats()
+	assert.Equal(t, uint64(3), stats["failed"])
+	assert.Equal(t, uint64(2), stats["variants_failed"])
+}
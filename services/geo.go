@@ -0,0 +1,181 @@
+package services
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gin-url-shortener/utils"
+)
+
+// GeoLocatorConfig IP 地理位置查询配置
+type GeoLocatorConfig struct {
+	Path           string        // MaxMind 格式（.mmdb）的地址库文件
+	CacheSize      int           // 最多缓存的查询结果数
+	ReloadInterval time.Duration // 检查文件是否变化的间隔，为 0 时不自动重新加载
+}
+
+// geoResult 缓存的查询结果，查不到的地址也缓存，避免重复查询
+type geoResult struct {
+	location utils.GeoLocation
+	found    bool
+}
+
+// GeoLocator 按访问者 IP 查询国家和大洲，用于匹配地理位置跳转规则。
+// 查询结果缓存在 LRU 中；地址库文件被替换后自动重新加载，不需要重启服务。
+type GeoLocator struct {
+	config GeoLocatorConfig
+
+	// mutex 保护地址库、文件状态和缓存，重新加载时整体替换
+	mutex   sync.RWMutex
+	db      *utils.GeoDB
+	modTime time.Time
+	size    int64
+	cache   *utils.LRU[string, geoResult]
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+
+	lookups uint64 // 查询次数
+	hits    uint64 // 命中缓存的次数
+	reloads uint64 // 重新加载的次数
+	failed  uint64 // 查询或重新加载失败的次数
+}
+
+// NewGeoLocator 读取地址库文件，ReloadInterval 大于 0 时启动后台 goroutine 检查文件变化
+func NewGeoLocator(config GeoLocatorConfig) (*GeoLocator, error) {
+	if config.CacheSize <= 0 {
+		config.CacheSize = 1
+	}
+
+	g := &GeoLocator{
+		config: config,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if _, err := g.Reload(); err != nil {
+		return nil, err
+	}
+	atomic.StoreUint64(&g.reloads, 0)
+
+	if config.ReloadInterval > 0 {
+		go g.run()
+	} else {
+		close(g.done)
+	}
+
+	return g, nil
+}
+
+// Locate 查询 IP 地址所在的国家和大洲。地址无效、不在地址库中或 g 为 nil 时 found 为 false。
+func (g *GeoLocator) Locate(ip string) (location utils.GeoLocation, found bool) {
+	if g == nil {
+		return utils.GeoLocation{}, false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return utils.GeoLocation{}, false
+	}
+	atomic.AddUint64(&g.lookups, 1)
+
+	g.mutex.RLock()
+	db, cache := g.db, g.cache
+	g.mutex.RUnlock()
+
+	if result, ok := cache.Get(ip); ok {
+		atomic.AddUint64(&g.hits, 1)
+		return result.location, result.found
+	}
+
+	location, found, err := db.Lookup(parsed)
+	if err != nil {
+		atomic.AddUint64(&g.failed, 1)
+		log.Printf("geo locator: lookup %s: %v", ip, err)
+		return utils.GeoLocation{}, false
+	}
+	cache.Add(ip, geoResult{location: location, found: found}, 0)
+
+	return location, found
+}
+
+// Reload 文件的修改时间或大小变化时重新加载地址库并清空缓存，返回是否重新加载。
+// 新文件无效时继续使用旧的地址库。
+func (g *GeoLocator) Reload() (bool, error) {
+	info, err := os.Stat(g.config.Path)
+	if err != nil {
+		return false, err
+	}
+
+	g.mutex.RLock()
+	unchanged := g.db != nil && info.ModTime().Equal(g.modTime) && info.Size() == g.size
+	g.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	db, err := utils.OpenGeoDB(g.config.Path)
+	if err != nil {
+		return false, err
+	}
+
+	g.mutex.Lock()
+	g.db = db
+	g.modTime = info.ModTime()
+	g.size = info.Size()
+	g.cache = utils.NewLRU[string, geoResult](g.config.CacheSize)
+	g.mutex.Unlock()
+
+	atomic.AddUint64(&g.reloads, 1)
+	return true, nil
+}
+
+// Close 停止检查文件变化
+func (g *GeoLocator) Close() error {
+	g.closeOnce.Do(func() {
+		close(g.stop)
+		<-g.done
+	})
+	return nil
+}
+
+// Stats 返回地理位置查询的统计信息
+func (g *GeoLocator) Stats() map[string]interface{} {
+	g.mutex.RLock()
+	cached := g.cache.Len()
+	g.mutex.RUnlock()
+
+	return map[string]interface{}{
+		"lookups": atomic.LoadUint64(&g.lookups),
+		"hits":    atomic.LoadUint64(&g.hits),
+		"reloads": atomic.LoadUint64(&g.reloads),
+		"failed":  atomic.LoadUint64(&g.failed),
+		"cached":  cached,
+	}
+}
+
+// run 后台循环，按间隔检查地址库文件是否变化
+func (g *GeoLocator) run() {
+	defer close(g.done)
+
+	ticker := time.NewTicker(g.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := g.Reload()
+			if err != nil {
+				atomic.AddUint64(&g.failed, 1)
+				log.Printf("geo locator: reload %s: %v", g.config.Path, err)
+			} else if reloaded {
+				log.Printf("geo locator: reloaded %s", g.config.Path)
+			}
+		case <-g.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+	"gin-url-shortener/utils"
+)
+
+// writeGeoDB 生成地址库文件，修改时间设为 modTime 以便触发重新加载
+func writeGeoDB(t *testing.T, path string, networks map[string]utils.GeoLocation, modTime time.Time) {
+	t.Helper()
+	buffer, err := utils.BuildGeoDB(networks)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, buffer, 0o644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestGeoLocator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	now := time.Now()
+	writeGeoDB(t, path, map[string]utils.GeoLocation{"8.8.8.0/24": {Country: "US", Continent: "NA"}}, now)
+
+	geo, err := NewGeoLocator(GeoLocatorConfig{Path: path, CacheSize: 10})
+	require.NoError(t, err)
+	defer geo.Close()
+
+	location, found := geo.Locate("8.8.8.8")
+	assert.True(t, found)
+	assert.Equal(t, utils.GeoLocation{Country: "US", Continent: "NA"}, location)
+
+	// 第二次查询命中缓存，查不到的地址也缓存
+	geo.Locate("8.8.8.8")
+	_, found = geo.Locate("1.1.1.1")
+	assert.False(t, found)
+	_, found = geo.Locate("not an ip")
+	assert.False(t, found)
+	stats := geo.Stats()
+	assert.Equal(t, uint64(3), stats["lookups"])
+	assert.Equal(t, uint64(1), stats["hits"])
+	assert.Equal(t, 2, stats["cached"])
+
+	// 文件没有变化时不重新加载
+	reloaded, err := geo.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// 替换文件后重新加载并清空缓存
+	writeGeoDB(t, path, map[string]utils.GeoLocation{"8.8.8.0/24": {Country: "CA", Continent: "NA"}}, now.Add(time.Minute))
+	reloaded, err = geo.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	location, _ = geo.Locate("8.8.8.8")
+	assert.Equal(t, "CA", location.Country)
+	assert.Equal(t, uint64(1), geo.Stats()["reloads"])
+
+	// 新文件无效时继续使用旧的地址库
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o644))
+	_, err = geo.Reload()
+	assert.ErrorIs(t, err, utils.ErrInvalidGeoDB)
+	location, _ = geo.Locate("8.8.8.8")
+	assert.Equal(t, "CA", location.Country)
+
+	// 文件无效或不存在时无法创建
+	_, err = NewGeoLocator(GeoLocatorConfig{Path: path})
+	assert.Error(t, err)
+	_, err = NewGeoLocator(GeoLocatorConfig{Path: filepath.Join(t.TempDir(), "missing.mmdb")})
+	assert.Error(t, err)
+
+	// 未配置时所有地址都查不到
+	var disabled *GeoLocator
+	_, found = disabled.Locate("8.8.8.8")
+	assert.False(t, found)
+}
+
+func TestGeoLocator_BackgroundReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	now := time.Now()
+	writeGeoDB(t, path, map[string]utils.GeoLocation{"8.8.8.0/24": {Country: "US"}}, now)
+
+	geo, err := NewGeoLocator(GeoLocatorConfig{Path: path, CacheSize: 10, ReloadInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer geo.Close()
+
+	writeGeoDB(t, path, map[string]utils.GeoLocation{"8.8.8.0/24": {Country: "MX"}}, now.Add(time.Minute))
+	assert.Eventually(t, func() bool {
+		location, _ := geo.Locate("8.8.8.8")
+		return location.Country == "MX"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestURLService_GeoRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeGeoDB(t, path, map[string]utils.GeoLocation{
+		"8.8.8.0/24":    {Country: "US", Continent: "NA"},
+		"81.2.69.0/24":  {Country: "GB", Continent: "EU"},
+		"2.16.0.0/16":   {Country: "FR", Continent: "EU"},
+		"2001:db8::/32": {Country: "JP", Continent: "AS"},
+	}, time.Now())
+	geo, err := NewGeoLocator(GeoLocatorConfig{Path: path, CacheSize: 10})
+	require.NoError(t, err)
+	defer geo.Close()
+
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{BaseURL: "http://localhost:8080"})
+
+	response, err := service.CreateShortURL(&models.ShortenRequest{
+		URL: "https://www.example.com",
+		Rules: []models.RedirectRule{
+			{Country: "gb", URL: "https://www.example.co.uk"},
+			{Continent: "eu", Device: "mobile", URL: "https://m.example.eu"},
+			{Continent: "EU", URL: "https://www.example.eu"},
+			{Country: "JP", URL: "https://www.example.jp"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "GB", response.Rules[0].Country)
+	assert.Equal(t, "EU", response.Rules[1].Continent)
+
+	// 未设置地理位置查询时地理条件都不匹配
+	redirect, err := service.ResolveRedirect(response.ShortCode, "", &Visit{ClientIP: "81.2.69.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com", redirect.URL)
+
+	service.SetGeoLocator(geo)
+	tests := []struct {
+		name      string
+		ip        string
+		userAgent string
+		expected  string
+	}{
+		{"country", "81.2.69.1", "", "https://www.example.co.uk"},
+		{"continent and device", "2.16.1.1", iPhoneUA, "https://m.example.eu"},
+		{"continent", "2.16.1.1", desktopUA, "https://www.example.eu"},
+		{"IPv6", "2001:db8::1", "", "https://www.example.jp"},
+		{"no rule", "8.8.8.8", "", "https://www.example.com"},
+		{"unknown address", "127.0.0.1", "", "https://www.example.com"},
+		{"no address", "", "", "https://www.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(response.ShortCode, "", &Visit{ClientIP: tt.ip, UserAgent: tt.userAgent})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, redirect.URL)
+		})
+	}
+
+	stats, err := service.GetStats()
+	require.NoError(t, err)
+	assert.Contains(t, stats, "geo")
+
+	invalid := [][]models.RedirectRule{
+		{{Country: "USA", URL: "https://www.example.com"}},
+		{{Country: "1A", URL: "https://www.example.com"}},
+		{{Continent: "XX", URL: "https://www.example.com"}},
+	}
+	for _, rules := range invalid {
+		_, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Rules: rules})
+		assert.Equal(t, ErrInvalidRules, err, rules)
+	}
+}
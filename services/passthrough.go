@@ -0,0 +1,172 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+
+	"gin-url-shortener/models"
+)
+
+// Visit 一次访问短链接的请求信息
+type Visit struct {
+	Path  string     // 短码之后的路径，如 /docs/page，没有时为空
+	Query url.Values // 请求中的查询参数
+
+	UserAgent      string // User-Agent 请求头，用于匹配跳转规则
+	AcceptLanguage string // Accept-Language 请求头
+	ClientIP       string // 访问者 IP，用于匹配地理位置条件和选择 A/B 测试版本
+	Variant        string // Cookie 中记下的 A/B 测试版本，没有时为空
+}
+
+// hasPath 请求是否在短码之后带有路径
+func (v *Visit) hasPath() bool {
+	return v != nil && strings.Trim(v.Path, "/") != ""
+}
+
+// isQueryPassthrough 判断查询参数的合并方式是否有效，空字符串表示不转发
+func isQueryPassthrough(mode string) bool {
+	switch mode {
+	case "", models.QueryKeep, models.QueryOverride, models.QueryAppend:
+		return true
+	}
+	return false
+}
+
+// destination 按链接的设置选出目标地址：匹配的跳转规则优先，其次是访问者分到的 A/B 测试版本，
+// 否则用访问请求填充模板，再把请求中的路径和查询参数拼接到目标地址上。规则和版本的目标地址不是模板。
+// 第二个返回值为分到的版本名，由规则决定目标地址或没有版本时为空。
+func destination(urlRecord *models.URL, visit *Visit, geo *GeoLocator) (string, string, error) {
+	raw := urlRecord.OriginalURL
+	template := urlRecord.Template
+	var variant string
+	if rule := matchRule(urlRecord.Rules, visit, geo); rule != nil {
+		raw = rule.URL
+		template = false
+	} else if picked := pickVariant(urlRecord.ShortCode, urlRecord.Variants, visit); picked != nil {
+		raw = picked.URL
+		variant = picked.Name
+		template = false
+	}
+
+	var query url.Values
+	if visit != nil {
+		query = visit.Query
+	}
+
+	if template {
+		tmpl, err := parseTemplate(raw)
+		if err != nil {
+			return "", "", err
+		}
+		values, err := tmpl.templateValues(visit)
+		if err != nil {
+			return "", "", err
+		}
+		if raw, err = tmpl.render(values); err != nil {
+			return "", "", err
+		}
+
+		// 已经用来填充变量的查询参数不再转发
+		query = withoutKeys(query, tmpl.variables)
+	}
+
+	forwardPath := urlRecord.PathPassthrough && visit.hasPath()
+	forwardQuery := urlRecord.QueryPassthrough != "" && len(query) > 0
+	if !forwardPath && !forwardQuery {
+		return raw, variant, nil
+	}
+
+	target, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	if forwardPath {
+		if err := joinPath(target, visit.Path); err != nil {
+			return "", "", err
+		}
+	}
+	if forwardQuery {
+		target.RawQuery = mergeQuery(target.RawQuery, query, urlRecord.QueryPassthrough)
+	}
+
+	return target.String(), variant, nil
+}
+
+// withoutKeys 返回去掉指定参数后的查询参数副本
+func withoutKeys(query url.Values, keys []string) url.Values {
+	result := make(url.Values, len(query))
+	for name, values := range query {
+		result[name] = values
+	}
+	for _, key := range keys {
+		delete(result, key)
+	}
+	return result
+}
+
+// joinPath 把访问路径逐段转义后追加到目标地址的路径之后。
+// 空段和 "." 被忽略，".." 会跳出目标地址的路径，直接拒绝。
+func joinPath(target *url.URL, extra string) error {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(extra, "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return ErrInvalidPath
+		}
+		segments = append(segments, url.PathEscape(segment))
+	}
+
+	escaped := strings.TrimSuffix(target.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+	if strings.HasSuffix(extra, "/") {
+		escaped += "/"
+	}
+
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return err
+	}
+	target.Path = path
+	target.RawPath = escaped
+
+	return nil
+}
+
+// mergeQuery 按合并方式把请求中的查询参数合并到目标地址的查询字符串中。
+// 目标地址原有的参数保持原来的顺序和编码，请求中的参数按名称排序追加在后面。
+func mergeQuery(rawQuery string, incoming url.Values, mode string) string {
+	existing := make(map[string]bool)
+	pairs := make([]string, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		existing[name] = true
+
+		// 请求中的值优先时去掉目标地址中的同名参数
+		if _, conflict := incoming[name]; conflict && mode == models.QueryOverride {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+
+	extra := url.Values{}
+	for name, values := range incoming {
+		if existing[name] && mode == models.QueryKeep {
+			continue
+		}
+		extra[name] = values
+	}
+	if encoded := extra.Encode(); encoded != "" {
+		pairs = append(pairs, encoded)
+	}
+
+	return strings.Join(pairs, "&")
+}
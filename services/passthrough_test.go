@@ -0,0 +1,122 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+func TestDestination(t *testing.T) {
+	query := func(raw string) url.Values {
+		values, err := url.ParseQuery(raw)
+		require.NoError(t, err)
+		return values
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		query    string
+		path     bool
+		visit    *Visit
+		expected string
+		err      error
+	}{
+		{"no passthrough", "https://example.com/a?x=1", "", false, &Visit{Query: query("utm_source=x")}, "https://example.com/a?x=1", nil},
+		{"keep adds new parameters", "https://example.com/a?x=1", models.QueryKeep, false,
+			&Visit{Query: query("x=2&utm_source=news")}, "https://example.com/a?x=1&utm_source=news", nil},
+		{"override replaces conflicts", "https://example.com/a?x=1&y=2", models.QueryOverride, false,
+			&Visit{Query: query("x=2")}, "https://example.com/a?y=2&x=2", nil},
+		{"append keeps both", "https://example.com/a?x=1", models.QueryAppend, false,
+			&Visit{Query: query("x=2")}, "https://example.com/a?x=1&x=2", nil},
+		{"query before fragment", "https://example.com/a#top", models.QueryKeep, false,
+			&Visit{Query: query("q=go")}, "https://example.com/a?q=go#top", nil},
+		{"path appended", "https://example.com/docs/", "", true,
+			&Visit{Path: "/guide/intro"}, "https://example.com/docs/guide/intro", nil},
+		{"path segments escaped", "https://example.com/files", "", true,
+			&Visit{Path: "/a b/c?d"}, "https://example.com/files/a%20b/c%3Fd", nil},
+		{"trailing slash kept", "https://example.com", "", true,
+			&Visit{Path: "/docs/"}, "https://example.com/docs/", nil},
+		{"path and query", "https://example.com/base?ref=short", models.QueryKeep, true,
+			&Visit{Path: "/page", Query: query("lang=en")}, "https://example.com/base/page?ref=short&lang=en", nil},
+		{"dot segments ignored", "https://example.com/base", "", true,
+			&Visit{Path: "/./page//"}, "https://example.com/base/page/", nil},
+		{"parent segment rejected", "https://example.com/base", "", true,
+			&Visit{Path: "/../admin"}, "", ErrInvalidPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urlRecord := &models.URL{OriginalURL: tt.target, QueryPassthrough: tt.query, PathPassthrough: tt.path}
+			result, _, err := destination(urlRecord, tt.visit, nil)
+			if tt.err != nil {
+				assert.Equal(t, tt.err, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestURLService_Passthrough(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{BaseURL: "http://localhost:8080"})
+
+	response, err := service.CreateShortURL(&models.ShortenRequest{
+		URL:              "https://www.example.com/docs",
+		QueryPassthrough: models.QueryKeep,
+		PathPassthrough:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.QueryKeep, response.QueryPassthrough)
+	assert.True(t, response.PathPassthrough)
+
+	redirect, err := service.ResolveRedirect(response.ShortCode, "", &Visit{Path: "/intro", Query: url.Values{"lang": {"en"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/docs/intro?lang=en", redirect.URL)
+
+	// 拼接失败的访问不计数
+	_, err = service.ResolveRedirect(response.ShortCode, "", &Visit{Path: "/../secret"})
+	assert.Equal(t, ErrInvalidPath, err)
+	info, err := service.GetURLInfo(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), info.AccessCount)
+
+	// 转发设置不同的链接不会复用同一个短码
+	plain, err := service.ShortenURL("https://www.example.com/docs")
+	require.NoError(t, err)
+	assert.NotEqual(t, response.ShortCode, plain.ShortCode)
+
+	// 没有开启转发时忽略请求中的查询参数，带路径的访问找不到链接
+	redirect, err = service.ResolveRedirect(plain.ShortCode, "", &Visit{Query: url.Values{"lang": {"en"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/docs", redirect.URL)
+	_, err = service.ResolveRedirect(plain.ShortCode, "", &Visit{Path: "/intro"})
+	assert.Equal(t, ErrURLNotFound, err)
+
+	// 修改转发设置
+	mode := models.QueryAppend
+	disabled := false
+	updated, err := service.UpdateURL(plain.ShortCode, &models.UpdateRequest{
+		QueryPassthrough: models.Optional[string]{Set: true, Value: &mode},
+		PathPassthrough:  models.Optional[bool]{Set: true, Value: &disabled},
+	}, Editor{})
+	require.NoError(t, err)
+	assert.Equal(t, models.QueryAppend, updated.QueryPassthrough)
+	assert.False(t, updated.PathPassthrough)
+
+	invalid := "merge"
+	_, err = service.UpdateURL(plain.ShortCode, &models.UpdateRequest{
+		QueryPassthrough: models.Optional[string]{Set: true, Value: &invalid},
+	}, Editor{})
+	assert.Equal(t, ErrInvalidQueryMode, err)
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", QueryPassthrough: "merge"})
+	assert.Equal(t, ErrInvalidQueryMode, err)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gin-url-shortener/storage"
+)
+
+// ExpiryReaperConfig 过期链接清理配置
+type ExpiryReaperConfig struct {
+	Interval    time.Duration // 清理间隔
+	BatchSize   int           // 每次从存储读取的过期记录数
+	ArchivePath string        // 删除前把记录追加写入该文件（JSON Lines），为空时直接删除
+}
+
+// ExpiryReaper 后台定期删除已过期的链接，以及在回收站中超过保留期的链接。
+// 这些记录通过存储的过期索引按批读取，不需要扫描全部记录。
+type ExpiryReaper struct {
+	store   storage.Store
+	config  ExpiryReaperConfig
+	archive *os.File // 为 nil 时不归档
+
+	// mutex 保证同一时刻只有一轮清理，Reap 也可以被直接调用
+	mutex     sync.Mutex
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+
+	reaped   uint64 // 已删除的过期链接数
+	purged   uint64 // 已从回收站永久删除的链接数
+	archived uint64 // 已归档的链接数
+	skipped  uint64 // 列出之后被延期或恢复而没有删除的链接数
+	failed   uint64 // 清理失败的轮数
+}
+
+// NewExpiryReaper 创建过期清理任务并启动后台 goroutine
+func NewExpiryReaper(store storage.Store, config ExpiryReaperConfig) (*ExpiryReaper, error) {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+
+	r := &ExpiryReaper{
+		store:  store,
+		config: config,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if config.ArchivePath != "" {
+		archive, err := os.OpenFile(config.ArchivePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open expired archive: %w", err)
+		}
+		r.archive = archive
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// Reap 删除在 now 之前过期或回收站保留期已满的所有链接，返回删除的数量
+func (r *ExpiryReaper) Reap(now time.Time) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	total := 0
+	for {
+		urls, err := r.store.ListExpired(now, r.config.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(urls) == 0 {
+			return total, nil
+		}
+
+		// 先归档整批并刷盘，再删除，进程中途退出也不会丢失记录
+		if r.archive != nil {
+			encoder := json.NewEncoder(r.archive)
+			for _, url := range urls {
+				if err := encoder.Encode(url); err != nil {
+					return total, fmt.Errorf("archive expired url: %w", err)
+				}
+			}
+			if err := r.archive.Sync(); err != nil {
+				return total, fmt.Errorf("sync expired archive: %w", err)
+			}
+			atomic.AddUint64(&r.archived, uint64(len(urls)))
+		}
+
+		// 列出之后被延期或从回收站恢复的链接由存储在删除时识别并跳过
+		for _, url := range urls {
+			err := r.store.DeleteIfDue(url.ShortCode, now)
+			if errors.Is(err, storage.ErrNotDue) || errors.Is(err, storage.ErrURLNotFound) {
+				atomic.AddUint64(&r.skipped, 1)
+				continue
+			}
+			if err != nil {
+				return total, err
+			}
+			total++
+			if url.DeletedAt != nil {
+				atomic.AddUint64(&r.purged, 1)
+			} else {
+				atomic.AddUint64(&r.reaped, 1)
+			}
+		}
+
+		if len(urls) < r.config.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+// Close 停止后台清理并关闭归档文件
+func (r *ExpiryReaper) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+
+		if r.archive != nil {
+			err = r.archive.Close()
+		}
+	})
+	return err
+}
+
+// Stats 返回清理任务的统计信息
+func (r *ExpiryReaper) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"reaped":   atomic.LoadUint64(&r.reaped),
+		"purged":   atomic.LoadUint64(&r.purged),
+		"archived": atomic.LoadUint64(&r.archived),
+		"skipped":  atomic.LoadUint64(&r.skipped),
+		"failed":   atomic.LoadUint64(&r.failed),
+	}
+}
+
+// run 后台循环，按间隔执行清理
+func (r *ExpiryReaper) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := r.Reap(time.Now()); err != nil {
+				atomic.AddUint64(&r.failed, 1)
+				log.Printf("expiry reaper: %v", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+func TestExpiryReaper_ReapAndArchive(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	archivePath := filepath.Join(t.TempDir(), "expired.jsonl")
+
+	now := time.Now()
+	for i, offset := range []time.Duration{-time.Hour, -time.Minute, -time.Second, time.Hour} {
+		expiresAt := now.Add(offset)
+		_, err := memStorage.Save(&models.URL{
+			ID:          uint64(i + 1),
+			OriginalURL: "https://www.example.com",
+			ShortCode:   string(rune('a' + i)),
+			CreatedAt:   now.Add(-2 * time.Hour),
+			ExpiresAt:   &expiresAt,
+		})
+		require.NoError(t, err)
+	}
+
+	reaper, err := NewExpiryReaper(memStorage, ExpiryReaperConfig{
+		Interval:    time.Hour, // 只手动触发
+		BatchSize:   2,
+		ArchivePath: archivePath,
+	})
+	require.NoError(t, err)
+
+	reaped, err := reaper.Reap(now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, reaped)
+	require.NoError(t, reaper.Close())
+
+	for _, shortCode := range []string{"a", "b", "c"} {
+		_, err := memStorage.GetByShortCode(shortCode)
+		assert.Equal(t, storage.ErrURLNotFound, err)
+	}
+	_, err = memStorage.GetByShortCode("d")
+	assert.NoError(t, err)
+
+	// 归档按过期时间顺序写入
+	file, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var archived []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var url models.URL
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &url))
+		archived = append(archived, url.ShortCode)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, archived)
+
+	stats := reaper.Stats()
+	assert.Equal(t, uint64(3), stats["reaped"])
+	assert.Equal(t, uint64(3), stats["archived"])
+}
+
+func TestExpiryReaper_Background(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+
+	expiresAt := time.Now().Add(-time.Second)
+	_, err := memStorage.Save(&models.URL{
+		ID:          1,
+		OriginalURL: "https://www.example.com",
+		ShortCode:   "1",
+		CreatedAt:   time.Now(),
+		ExpiresAt:   &expiresAt,
+	})
+	require.NoError(t, err)
+
+	reaper, err := NewExpiryReaper(memStorage, ExpiryReaperConfig{Interval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer reaper.Close()
+
+	assert.Eventually(t, func() bool {
+		_, err := memStorage.GetByShortCode("1")
+		return err == storage.ErrURLNotFound
+	}, time.Second, 10*time.Millisecond)
+}
+
+// extendingStore 在列出过期链接之后、删除之前延长其中一个链接的有效期，模拟并发的修改
+type extendingStore struct {
+	*storage.MemoryStorage
+	shortCode string
+}
+
+func (s *extendingStore) ListExpired(before time.Time, limit int) ([]*models.URL, error) {
+	urls, err := s.MemoryStorage.ListExpired(before, limit)
+	if err != nil || s.shortCode == "" {
+		return urls, err
+	}
+
+	current, err := s.MemoryStorage.GetByShortCode(s.shortCode)
+	if err != nil {
+		return nil, err
+	}
+	extended := current.Clone()
+	expiresAt := before.Add(time.Hour)
+	extended.ExpiresAt = &expiresAt
+	if _, err := s.MemoryStorage.Update(extended); err != nil {
+		return nil, err
+	}
+	s.shortCode = ""
+	return urls, nil
+}
+
+func TestExpiryReaper_SkipsExtendedLinks(t *testing.T) {
+	store := &extendingStore{MemoryStorage: storage.NewMemoryStorage(), shortCode: "b"}
+
+	now := time.Now()
+	for i, shortCode := range []string{"a", "b"} {
+		expiresAt := now.Add(-time.Minute)
+		_, err := store.Save(&models.URL{
+			ID:          uint64(i + 1),
+			OriginalURL: "https://www.example.com",
+			ShortCode:   shortCode,
+			CreatedAt:   now.Add(-time.Hour),
+			ExpiresAt:   &expiresAt,
+		})
+		require.NoError(t, err)
+	}
+
+	reaper, err := NewExpiryReaper(store, ExpiryReaperConfig{Interval: time.Hour, BatchSize: 10})
+	require.NoError(t, err)
+	defer reaper.Close()
+
+	reaped, err := reaper.Reap(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reaped)
+
+	_, err = store.GetByShortCode("a")
+	assert.Equal(t, storage.ErrURLNotFound, err)
+	record, err := store.GetByShortCode("b")
+	require.NoError(t, err)
+	assert.True(t, record.ExpiresAt.After(now))
+	assert.Equal(t, uint64(1), reaper.Stats()["skipped"])
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/utils"
+)
+
+// maxRedirectRules 一个链接最多的跳转规则数
+const maxRedirectRules = 20
+
+// languageTag 规则中的语言标签，如 zh、en-us、zh-hant-tw
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// countryCode 规则中的国家代码，如 CN、US
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// 规则条件允许的取值
+var (
+	ruleDevices    = []string{utils.DeviceMobile, utils.DeviceTablet, utils.DeviceDesktop, utils.DeviceBot}
+	ruleOSes       = []string{utils.OSIOS, utils.OSAndroid, utils.OSWindows, utils.OSMacOS, utils.OSLinux, utils.OSChromeOS}
+	ruleBrowsers   = []string{utils.BrowserChrome, utils.BrowserSafari, utils.BrowserFirefox, utils.BrowserEdge, utils.BrowserOpera, utils.BrowserSamsung}
+	ruleContinents = []string{"AF", "AN", "AS", "EU", "NA", "OC", "SA"}
+)
+
+// validateRules 校验并标准化跳转规则：国家和大洲代码统一为大写，其他条件统一为小写，
+// 每条规则至少有一个条件，目标地址必须有效
+func (s *URLService) validateRules(rules []models.RedirectRule) ([]models.RedirectRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if len(rules) > maxRedirectRules {
+		return nil, ErrInvalidRules
+	}
+
+	normalized := make([]models.RedirectRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Device = strings.ToLower(strings.TrimSpace(rule.Device))
+		rule.OS = strings.ToLower(strings.TrimSpace(rule.OS))
+		rule.Browser = strings.ToLower(strings.TrimSpace(rule.Browser))
+		rule.Language = strings.ToLower(strings.TrimSpace(rule.Language))
+		rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+		rule.Continent = strings.ToUpper(strings.TrimSpace(rule.Continent))
+
+		if rule.Device == "" && rule.OS == "" && rule.Browser == "" && rule.Language == "" &&
+			rule.Country == "" && rule.Continent == "" {
+			return nil, ErrInvalidRules
+		}
+		if !oneOf(rule.Device, ruleDevices) || !oneOf(rule.OS, ruleOSes) || !oneOf(rule.Browser, ruleBrowsers) ||
+			!oneOf(rule.Continent, ruleContinents) {
+			return nil, ErrInvalidRules
+		}
+		if rule.Language != "" && !languageTag.MatchString(rule.Language) {
+			return nil, ErrInvalidRules
+		}
+		if rule.Country != "" && !countryCode.MatchString(rule.Country) {
+			return nil, ErrInvalidRules
+		}
+		if s.validateURL(rule.URL) != nil {
+			return nil, ErrInvalidRules
+		}
+		rule.URL = s.normalizeURL(rule.URL)
+
+		normalized = append(normalized, rule)
+	}
+
+	return normalized, nil
+}
+
+// oneOf 判断值为空或是允许的取值之一
+func oneOf(value string, allowed []string) bool {
+	if value == "" {
+		return true
+	}
+	for _, candidate := range allowed {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRule 按顺序返回第一条与访问者匹配的规则，没有匹配的规则时返回 nil。
+// 访问者的地理位置只在遇到地理位置条件时查询；geo 为 nil 或查不到位置时这些条件都不匹配。
+func matchRule(rules []models.RedirectRule, visit *Visit, geo *GeoLocator) *models.RedirectRule {
+	if len(rules) == 0 || visit == nil {
+		return nil
+	}
+
+	client := utils.ParseUserAgent(visit.UserAgent)
+	language := utils.PreferredLanguage(visit.AcceptLanguage)
+
+	var location utils.GeoLocation
+	located := false
+	locate := func() utils.GeoLocation {
+		if !located {
+			location, _ = geo.Locate(visit.ClientIP)
+			located = true
+		}
+		return location
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Device != "" && rule.Device != client.Device {
+			continue
+		}
+		if rule.OS != "" && rule.OS != client.OS {
+			continue
+		}
+		if rule.Browser != "" && rule.Browser != client.Browser {
+			continue
+		}
+		if rule.Language != "" && !utils.MatchLanguage(rule.Language, language) {
+			continue
+		}
+		if rule.Country != "" && rule.Country != locate().Country {
+			continue
+		}
+		if rule.Continent != "" && rule.Continent != locate().Continent {
+			continue
+		}
+		return rule
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36"
+)
+
+func TestURLService_Rules(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:        "http://localhost:8080",
+		RedirectMaxAge: time.Hour,
+	})
+
+	response, err := service.CreateShortURL(&models.ShortenRequest{
+		URL: "https://www.example.com/app",
+		Rules: []models.RedirectRule{
+			{OS: "iOS", URL: "https://apps.apple.com/app/id1"},
+			{OS: "android", URL: "https://play.google.com/store/apps/details?id=com.example"},
+			{Device: "desktop", Language: "zh", URL: "https://www.example.com/zh/app"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ios", response.Rules[0].OS)
+
+	tests := []struct {
+		name      string
+		userAgent string
+		language  string
+		expected  string
+	}{
+		{"iOS", iPhoneUA, "zh-CN", "https://apps.apple.com/app/id1"},
+		{"Android", androidUA, "", "https://play.google.com/store/apps/details?id=com.example"},
+		{"desktop Chinese", desktopUA, "zh-TW,zh;q=0.9,en;q=0.8", "https://www.example.com/zh/app"},
+		{"desktop English", desktopUA, "en-US,zh;q=0.5", "https://www.example.com/app"},
+		{"no headers", "", "", "https://www.example.com/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := service.ResolveRedirect(response.ShortCode, "", &Visit{UserAgent: tt.userAgent, AcceptLanguage: tt.language})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, redirect.URL)
+			assert.Equal(t, "User-Agent, Accept-Language", redirect.Vary)
+			assert.Equal(t, "private, max-age=3600", redirect.CacheControl)
+		})
+	}
+
+	// 没有请求信息时跳转到默认地址
+	original, err := service.GetOriginalURL(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/app", original)
+
+	// 带规则的链接不参与去重
+	plain, err := service.ShortenURL("https://www.example.com/app")
+	require.NoError(t, err)
+	assert.NotEqual(t, response.ShortCode, plain.ShortCode)
+	redirect, err := service.ResolveRedirect(plain.ShortCode, "", &Visit{UserAgent: iPhoneUA})
+	require.NoError(t, err)
+	assert.Empty(t, redirect.Vary)
+	assert.Equal(t, http.StatusMovedPermanently, redirect.Status)
+
+	invalid := [][]models.RedirectRule{
+		{{URL: "https://www.example.com"}},
+		{{Device: "watch", URL: "https://www.example.com"}},
+		{{OS: "symbian", URL: "https://www.example.com"}},
+		{{Browser: "netscape", URL: "https://www.example.com"}},
+		{{Language: "chinese!", URL: "https://www.example.com"}},
+		{{OS: "ios", URL: "not a url"}},
+	}
+	for _, rules := range invalid {
+		_, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Rules: rules})
+		assert.Equal(t, ErrInvalidRules, err, rules)
+	}
+
+	// 修改时整体替换规则，null 清除
+	rules := []models.RedirectRule{{Device: "mobile", URL: "https://m.example.com"}}
+	updated, err := service.UpdateURL(response.ShortCode, &models.UpdateRequest{Rules: models.Optional[[]models.RedirectRule]{Set: true, Value: &rules}}, Editor{})
+	require.NoError(t, err)
+	assert.Equal(t, rules, updated.Rules)
+	redirect, err = service.ResolveRedirect(response.ShortCode, "", &Visit{UserAgent: androidUA})
+	require.NoError(t, err)
+	assert.Equal(t, "https://m.example.com", redirect.URL)
+
+	updated, err = service.UpdateURL(response.ShortCode, &models.UpdateRequest{Rules: models.Optional[[]models.RedirectRule]{Set: true}}, Editor{})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Rules)
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxTemplateVariables 一个模板中最多的变量数
+const maxTemplateVariables = 10
+
+// 占位符在目标地址中的位置，决定替换值的转义方式
+const (
+	templatePath = iota
+	templateQuery
+	templateFragment
+)
+
+// TemplateError 模板无法用访问请求填充，Message 说明缺少或不合法的变量
+type TemplateError struct {
+	Message string
+}
+
+func (e *TemplateError) Error() string {
+	return ErrTemplateRender.Error() + ": " + e.Message
+}
+
+func (e *TemplateError) Unwrap() error {
+	return ErrTemplateRender
+}
+
+// templatePart 模板中的一段：字面量或占位符
+type templatePart struct {
+	literal    string
+	name       string // 为空时是字面量
+	value      string // 默认值
+	hasDefault bool
+	section    int
+}
+
+// urlTemplate 解析后的目标地址模板，形如 https://github.com/{org}/{repo=readme}
+type urlTemplate struct {
+	parts     []templatePart
+	variables []string // 按第一次出现的顺序排列，路径段依次填充
+}
+
+// parseTemplate 解析模板中的 {name} 和 {name=默认值} 占位符，
+// 变量名只能包含字母、数字和下划线，默认值中不能有花括号
+func parseTemplate(raw string) (*urlTemplate, error) {
+	tmpl := &urlTemplate{}
+	seen := make(map[string]bool)
+	section := templatePath
+
+	for rest := raw; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			tmpl.addLiteral(rest, &section)
+			break
+		}
+		if rest[open] == '}' {
+			return nil, ErrInvalidTemplate
+		}
+		tmpl.addLiteral(rest[:open], &section)
+
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end < 0 || rest[open+1+end] != '}' {
+			return nil, ErrInvalidTemplate
+		}
+		name, value, hasDefault := strings.Cut(rest[open+1:open+1+end], "=")
+		if !isTemplateName(name) {
+			return nil, ErrInvalidTemplate
+		}
+		if !seen[name] {
+			seen[name] = true
+			tmpl.variables = append(tmpl.variables, name)
+		}
+		tmpl.parts = append(tmpl.parts, templatePart{name: name, value: value, hasDefault: hasDefault, section: section})
+
+		rest = rest[open+1+end+1:]
+	}
+
+	if len(tmpl.variables) == 0 || len(tmpl.variables) > maxTemplateVariables {
+		return nil, ErrInvalidTemplate
+	}
+
+	return tmpl, nil
+}
+
+// addLiteral 追加一段字面量，并根据其中的 ? 和 # 更新之后占位符所在的位置
+func (t *urlTemplate) addLiteral(literal string, section *int) {
+	if literal == "" {
+		return
+	}
+	t.parts = append(t.parts, templatePart{literal: literal})
+
+	if strings.Contains(literal, "#") {
+		*section = templateFragment
+	} else if *section == templatePath && strings.Contains(literal, "?") {
+		*section = templateQuery
+	}
+}
+
+// isTemplateName 判断变量名是否只由字母、数字和下划线组成且不以数字开头
+func isTemplateName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+// render 用变量值填充模板，值按所在位置转义；没有值也没有默认值的变量返回 *TemplateError
+func (t *urlTemplate) render(values map[string]string) (string, error) {
+	var builder strings.Builder
+	for _, part := range t.parts {
+		if part.name == "" {
+			builder.WriteString(part.literal)
+			continue
+		}
+
+		value, ok := values[part.name]
+		if !ok || value == "" {
+			if !part.hasDefault {
+				return "", &TemplateError{Message: fmt.Sprintf("missing value for {%s}", part.name)}
+			}
+			value = part.value
+		}
+
+		switch part.section {
+		case templatePath:
+			// 替换值只能占据一个路径段，不能借助 . 和 .. 改变路径
+			if value == "." || value == ".." {
+				return "", &TemplateError{Message: fmt.Sprintf("invalid value for {%s}", part.name)}
+			}
+			builder.WriteString(url.PathEscape(value))
+		case templateQuery:
+			builder.WriteString(url.QueryEscape(value))
+		default:
+			builder.WriteString(url.PathEscape(value))
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// sample 用固定的值填充所有变量，用于校验模板
+func (t *urlTemplate) sample(value string) string {
+	values := make(map[string]string, len(t.variables))
+	for _, name := range t.variables {
+		values[name] = value
+	}
+	rendered, _ := t.render(values)
+	return rendered
+}
+
+// templateValues 从访问请求中取出变量值：路径段按顺序填充变量，同名的查询参数优先。
+// 路径段多于变量时返回 *TemplateError。
+func (t *urlTemplate) templateValues(visit *Visit) (map[string]string, error) {
+	values := make(map[string]string, len(t.variables))
+	if visit == nil {
+		return values, nil
+	}
+
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(visit.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) > len(t.variables) {
+		return nil, &TemplateError{Message: fmt.Sprintf("expected at most %d path segments", len(t.variables))}
+	}
+	for i, segment := range segments {
+		values[t.variables[i]] = segment
+	}
+
+	for _, name := range t.variables {
+		if value := visit.Query.Get(name); value != "" {
+			values[name] = value
+		}
+	}
+
+	return values, nil
+}
+
+// validateTemplate 校验模板目标地址：占位符语法正确，填充后是有效的 URL，
+// 并且占位符不能出现在协议、用户信息和主机名中，避免跳转到任意站点
+func (s *URLService) validateTemplate(raw string) error {
+	tmpl, err := parseTemplate(raw)
+	if err != nil {
+		return err
+	}
+
+	first, second := tmpl.sample("a"), tmpl.sample("b")
+	if s.validateURL(first) != nil {
+		return ErrInvalidTemplate
+	}
+	firstURL, err := url.Parse(first)
+	if err != nil {
+		return ErrInvalidTemplate
+	}
+	secondURL, err := url.Parse(second)
+	if err != nil {
+		return ErrInvalidTemplate
+	}
+	if firstURL.Scheme == "" || firstURL.Scheme != secondURL.Scheme ||
+		firstURL.User.String() != secondURL.User.String() || firstURL.Host != secondURL.Host {
+		return ErrInvalidTemplate
+	}
+
+	return nil
+}
+
+// templateVariables 返回模板中的变量，不是模板或无法解析时返回 nil
+func templateVariables(raw string) []string {
+	tmpl, err := parseTemplate(raw)
+	if err != nil {
+		return nil
+	}
+	return tmpl.variables
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tmpl, err := parseTemplate("https://github.com/{org}/{repo=readme}?tab={tab=code}#L{line}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"org", "repo", "tab", "line"}, tmpl.variables)
+
+	invalid := []string{
+		"https://github.com/anthropics",
+		"https://github.com/{org",
+		"https://github.com/org}",
+		"https://github.com/{}",
+		"https://github.com/{1org}",
+		"https://github.com/{org-name}",
+		"https://github.com/{org{repo}}",
+		"https://example.com/{a}{b}{c}{d}{e}{f}{g}{h}{i}{j}{k}",
+	}
+	for _, raw := range invalid {
+		_, err := parseTemplate(raw)
+		assert.Equal(t, ErrInvalidTemplate, err, raw)
+	}
+}
+
+func TestURLTemplate_Render(t *testing.T) {
+	tmpl, err := parseTemplate("https://github.com/{org}/{repo=readme}?q={q=}#{anchor=top}")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		visit    *Visit
+		expected string
+		message  string
+	}{
+		{"path segments", &Visit{Path: "/anthropics/sdk"}, "https://github.com/anthropics/sdk?q=#top", ""},
+		{"defaults", &Visit{Path: "/anthropics"}, "https://github.com/anthropics/readme?q=#top", ""},
+		{"query parameters", &Visit{Query: url.Values{"org": {"golang"}, "q": {"a&b=c"}}}, "https://github.com/golang/readme?q=a%26b%3Dc#top", ""},
+		{"query wins over path", &Visit{Path: "/anthropics", Query: url.Values{"org": {"golang"}}}, "https://github.com/golang/readme?q=#top", ""},
+		{"path value escaped", &Visit{Query: url.Values{"org": {"a b/c"}}}, "https://github.com/a%20b%2Fc/readme?q=#top", ""},
+		{"missing variable", &Visit{}, "", "missing value for {org}"},
+		{"dot segment", &Visit{Query: url.Values{"org": {".."}}}, "", "invalid value for {org}"},
+		{"too many segments", &Visit{Path: "/a/b/c/d/e"}, "", "expected at most 4 path segments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := tmpl.templateValues(tt.visit)
+			if err == nil {
+				var rendered string
+				rendered, err = tmpl.render(values)
+				if tt.message == "" {
+					require.NoError(t, err)
+					assert.Equal(t, tt.expected, rendered)
+					return
+				}
+			}
+
+			var templateErr *TemplateError
+			require.True(t, errors.As(err, &templateErr))
+			assert.Equal(t, tt.message, templateErr.Message)
+			assert.ErrorIs(t, err, ErrTemplateRender)
+		})
+	}
+}
+
+func TestURLService_Template(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{BaseURL: "http://localhost:8080"})
+
+	// 占位符不能出现在协议和主机名中，模板必须带协议
+	for _, raw := range []string{
+		"https://{host}.example.com/{path}",
+		"{scheme}://example.com/{path}",
+		"https://example.com:{port}/",
+		"github.com/{org}",
+	} {
+		_, err := service.CreateShortURL(&models.ShortenRequest{URL: raw, Template: true})
+		assert.Equal(t, ErrInvalidTemplate, err, raw)
+	}
+	_, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://github.com/{org}", Template: true, PathPassthrough: true})
+	assert.Equal(t, ErrInvalidTemplate, err)
+
+	response, err := service.CreateShortURL(&models.ShortenRequest{
+		URL:              "https://github.com/{org}/{repo}",
+		Template:         true,
+		QueryPassthrough: models.QueryKeep,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/{org}/{repo}", response.OriginalURL)
+	assert.Equal(t, []string{"org", "repo"}, response.TemplateVariables)
+
+	// 用来填充变量的查询参数不再转发
+	redirect, err := service.ResolveRedirect(response.ShortCode, "", &Visit{
+		Path:  "/anthropics",
+		Query: url.Values{"repo": {"sdk"}, "tab": {"readme"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/anthropics/sdk?tab=readme", redirect.URL)
+
+	// 填充失败的访问不计数
+	_, err = service.ResolveRedirect(response.ShortCode, "", &Visit{Path: "/anthropics"})
+	assert.ErrorIs(t, err, ErrTemplateRender)
+	info, err := service.GetURLInfo(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), info.AccessCount)
+	assert.True(t, info.Template)
+
+	// 修改模板时同样校验
+	invalid := "https://{org}.github.io"
+	_, err = service.UpdateURL(response.ShortCode, &models.UpdateRequest{URL: models.Optional[string]{Set: true, Value: &invalid}}, Editor{})
+	assert.Equal(t, ErrInvalidTemplate, err)
+
+	next := "https://gitlab.com/{org}/{repo=main}"
+	updated, err := service.UpdateURL(response.ShortCode, &models.UpdateRequest{URL: models.Optional[string]{Set: true, Value: &next}}, Editor{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"org", "repo"}, updated.TemplateVariables)
+
+	redirect, err = service.ResolveRedirect(response.ShortCode, "", &Visit{Path: "/anthropics"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.com/anthropics/main", redirect.URL)
+
+	// 普通链接改为模板时校验现有地址
+	plain, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+	enabled := true
+	_, err = service.UpdateURL(plain.ShortCode, &models.UpdateRequest{Template: models.Optional[bool]{Set: true, Value: &enabled}}, Editor{})
+	assert.Equal(t, ErrInvalidTemplate, err)
+}
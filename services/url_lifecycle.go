@@ -0,0 +1,62 @@
+package services
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"gin-url-shortener/models"
+)
+
+// DeleteURL 把短链接移入回收站，保留期内可以恢复，之后由清理任务永久删除
+func (s *URLService) DeleteURL(shortCode string, editor Editor) (*models.URLInfoResponse, error) {
+	retention := s.config.TrashRetention
+	if retention <= 0 {
+		retention = defaultTrashRetention
+	}
+
+	return s.modify(shortCode, models.RevisionDelete, editor, 0, func(urlRecord *models.URL, _ []*models.Revision, now time.Time) error {
+		purgeAt := now.Add(retention)
+		urlRecord.DeletedAt = &now
+		urlRecord.PurgeAt = &purgeAt
+		return nil
+	})
+}
+
+// RestoreURL 把回收站中的短链接恢复到删除前的状态，不在回收站中时返回 ErrNotDeleted
+func (s *URLService) RestoreURL(shortCode string, editor Editor) (*models.URLInfoResponse, error) {
+	return s.modify(shortCode, models.RevisionRestore, editor, 0, func(urlRecord *models.URL, _ []*models.Revision, _ time.Time) error {
+		if urlRecord.DeletedAt == nil {
+			return ErrNotDeleted
+		}
+		urlRecord.DeletedAt = nil
+		urlRecord.PurgeAt = nil
+		return nil
+	})
+}
+
+// DisableURL 禁用短链接，访问时返回 410 和禁用原因；已禁用的链接会更新原因
+func (s *URLService) DisableURL(shortCode, reason string, editor Editor) (*models.URLInfoResponse, error) {
+	if utf8.RuneCountInString(reason) > maxReasonLength {
+		return nil, ErrInvalidReason
+	}
+
+	return s.modify(shortCode, models.RevisionDisable, editor, 0, func(urlRecord *models.URL, _ []*models.Revision, now time.Time) error {
+		if urlRecord.DisabledAt == nil {
+			urlRecord.DisabledAt = &now
+		}
+		urlRecord.DisabledReason = reason
+		return nil
+	})
+}
+
+// EnableURL 解除禁用，未被禁用时返回 ErrNotDisabled
+func (s *URLService) EnableURL(shortCode string, editor Editor) (*models.URLInfoResponse, error) {
+	return s.modify(shortCode, models.RevisionEnable, editor, 0, func(urlRecord *models.URL, _ []*models.Revision, _ time.Time) error {
+		if urlRecord.DisabledAt == nil {
+			return ErrNotDisabled
+		}
+		urlRecord.DisabledAt = nil
+		urlRecord.DisabledReason = ""
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+func TestURLService_DeleteAndRestore(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewURLService(store, &config.Config{
+		BaseURL:        "http://localhost:8080",
+		TrashRetention: time.Hour,
+	})
+
+	created, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+
+	info, err := service.DeleteURL(created.ShortCode, Editor{Name: "alice"})
+	require.NoError(t, err)
+	require.NotNil(t, info.DeletedAt)
+	require.NotNil(t, info.PurgeAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *info.PurgeAt, time.Second)
+
+	_, err = service.GetOriginalURL(created.ShortCode)
+	assert.Equal(t, ErrURLDeleted, err)
+
+	// 回收站中的链接只能恢复，不能修改或重复删除
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"url": "https://www.example.org"}`), Editor{Name: "alice"})
+	assert.Equal(t, ErrURLDeleted, err)
+	_, err = service.DeleteURL(created.ShortCode, Editor{Name: "alice"})
+	assert.Equal(t, ErrURLDeleted, err)
+
+	// 删除的链接离开去重索引，相同的地址会创建新的短码
+	again, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, created.ShortCode, again.ShortCode)
+
+	info, err = service.RestoreURL(created.ShortCode, Editor{Name: "bob"})
+	require.NoError(t, err)
+	assert.Nil(t, info.DeletedAt)
+	assert.Nil(t, info.PurgeAt)
+
+	originalURL, err := service.GetOriginalURL(created.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com", originalURL)
+
+	_, err = service.RestoreURL(created.ShortCode, Editor{Name: "bob"})
+	assert.Equal(t, ErrNotDeleted, err)
+
+	history, err := service.GetHistory(created.ShortCode)
+	require.NoError(t, err)
+	require.Len(t, history.Revisions, 3)
+	assert.Equal(t, models.RevisionDelete, history.Revisions[1].Action)
+	assert.Equal(t, models.RevisionRestore, history.Revisions[2].Action)
+}
+
+func TestURLService_DisableAndEnable(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{BaseURL: "http://localhost:8080"})
+
+	created, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+
+	info, err := service.DisableURL(created.ShortCode, "Reported as phishing", Editor{Name: "moderator"})
+	require.NoError(t, err)
+	assert.True(t, info.Disabled)
+	assert.Equal(t, "Reported as phishing", info.DisabledReason)
+
+	_, err = service.GetOriginalURL(created.ShortCode)
+	var disabled *DisabledError
+	require.True(t, errors.As(err, &disabled))
+	assert.Equal(t, "Reported as phishing", disabled.Reason)
+	assert.ErrorIs(t, err, ErrURLDisabled)
+
+	history, err := service.GetHistory(created.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "Reported as phishing", history.Revisions[len(history.Revisions)-1].Reason)
+
+	info, err = service.EnableURL(created.ShortCode, Editor{Name: "moderator"})
+	require.NoError(t, err)
+	assert.False(t, info.Disabled)
+	assert.Empty(t, info.DisabledReason)
+
+	_, err = service.GetOriginalURL(created.ShortCode)
+	assert.NoError(t, err)
+
+	_, err = service.EnableURL(created.ShortCode, Editor{Name: "moderator"})
+	assert.Equal(t, ErrNotDisabled, err)
+	_, err = service.DisableURL(created.ShortCode, string(make([]byte, maxReasonLength+1)), Editor{Name: "moderator"})
+	assert.Equal(t, ErrInvalidReason, err)
+}
+
+func TestURLService_PurgedCodesAreNotReissued(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewURLService(store, &config.Config{
+		BaseURL:        "http://localhost:8080",
+		TrashRetention: time.Minute,
+	})
+	reaper, err := NewExpiryReaper(store, ExpiryReaperConfig{Interval: time.Hour})
+	require.NoError(t, err)
+	defer reaper.Close()
+	service.SetExpiryReaper(reaper)
+
+	created, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Alias: "promo"})
+	require.NoError(t, err)
+	_, err = service.DeleteURL(created.ShortCode, Editor{Name: "alice"})
+	require.NoError(t, err)
+
+	// 保留期满后由清理任务永久删除
+	purged, err := reaper.Reap(time.Now().Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = service.GetOriginalURL(created.ShortCode)
+	assert.Equal(t, ErrURLNotFound, err)
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.org", Alias: "promo"})
+	assert.Equal(t, ErrAliasTaken, err)
+
+	stats, err := service.GetStats()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, stats["deleted_codes"])
+	assert.EqualValues(t, 1, stats["reaper"].(map[string]interface{})["purged"])
+}
@@ -2,8 +2,15 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 
 	"gin-url-shortener/config"
 	"gin-url-shortener/models"
@@ -12,37 +19,272 @@ import (
 )
 
 var (
-	ErrInvalidURL    = errors.New("invalid URL format")
-	ErrURLNotFound   = errors.New("short URL not found")
-	ErrInvalidShortCode = errors.New("invalid short code format")
+	ErrInvalidURL        = errors.New("invalid URL format")
+	ErrURLNotFound       = errors.New("short URL not found")
+	ErrInvalidShortCode  = errors.New("invalid short code format")
+	ErrInvalidAlias      = errors.New("invalid alias")
+	ErrAliasTaken        = errors.New("alias already taken")
+	ErrAliasReserved     = errors.New("alias is reserved")
+	ErrInvalidExpiration = errors.New("invalid expiration")
+	ErrURLExpired        = errors.New("short URL has expired")
+	ErrInvalidClickLimit = errors.New("invalid click limit")
+	ErrURLExhausted      = errors.New("short URL has reached its click limit")
+	ErrInvalidSchedule   = errors.New("invalid activation window")
+	ErrInvalidFallback   = errors.New("invalid fallback URL")
+	ErrURLNotYetActive   = errors.New("short URL is not active yet")
+	ErrURLDeactivated    = errors.New("short URL has been deactivated")
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrPasswordRequired  = errors.New("password required")
+	ErrWrongPassword     = errors.New("incorrect password")
+	ErrNoPassword        = errors.New("short URL is not password protected")
+	ErrCannotAddPassword = errors.New("a password can only be set when creating the short URL")
+	ErrTooManyAttempts   = errors.New("too many failed unlock attempts")
+	ErrInvalidRedirect   = errors.New("invalid redirect type")
+	ErrNoChanges         = errors.New("no fields to update")
+	ErrInvalidRevision   = errors.New("invalid revision")
+	ErrRevisionConflict  = errors.New("short URL was modified concurrently")
+	ErrURLDeleted        = errors.New("short URL has been deleted")
+	ErrURLDisabled       = errors.New("short URL has been disabled")
+	ErrNotDeleted        = errors.New("short URL is not in the trash")
+	ErrNotDisabled       = errors.New("short URL is not disabled")
+	ErrInvalidReason     = errors.New("invalid disable reason")
+	ErrInvalidQueryMode  = errors.New("invalid query passthrough mode")
+	ErrInvalidPath       = errors.New("invalid passthrough path")
+	ErrInvalidTemplate   = errors.New("invalid URL template")
+	ErrTemplateRender    = errors.New("cannot render URL template")
+	ErrInvalidRules      = errors.New("invalid redirect rules")
+	ErrInvalidVariants   = errors.New("invalid A/B test variants")
+)
+
+// InactiveError 链接不在生效时间窗口内，Err 为 ErrURLNotYetActive 或 ErrURLDeactivated
+type InactiveError struct {
+	Err         error
+	RetryAfter  time.Duration // 距离生效还有多久，已停止生效时为 0
+	FallbackURL string        // 窗口外跳转的地址，为空时没有可跳转的地址
+}
+
+func (e *InactiveError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InactiveError) Unwrap() error {
+	return e.Err
+}
+
+// DisabledError 链接已被禁用，Reason 为禁用时填写的原因
+type DisabledError struct {
+	Reason string
+}
+
+func (e *DisabledError) Error() string {
+	return ErrURLDisabled.Error()
+}
+
+func (e *DisabledError) Unwrap() error {
+	return ErrURLDisabled
+}
+
+// TooManyAttemptsError 密码输错次数过多，RetryAfter 之后才能再试
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *TooManyAttemptsError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// Redirect 短链接的重定向结果
+type Redirect struct {
+	URL          string // 跳转的地址
+	Status       int    // 重定向状态码
+	CacheControl string // 与状态码对应的缓存策略
+	Vary         string // 目标地址取决于哪些请求头，为空时与请求头无关
+	Variant      string // 访问者分到的 A/B 测试版本，需要记在 Cookie 中，没有时为空
+}
+
+const (
+	// maxCodeAttempts 生成的短码被占用时的最大重试次数
+	maxCodeAttempts = 10
+
+	// maxSuggestions 短码校验失败时最多给出的纠错建议数
+	maxSuggestions = 5
+
+	// defaultRedirectType 未配置时使用的重定向状态码
+	defaultRedirectType = http.StatusMovedPermanently
+
+	// maxPasswordLength bcrypt 只使用密码的前 72 个字节，更长的密码直接拒绝
+	maxPasswordLength = 72
+
+	// maxReasonLength 禁用原因的最大长度
+	maxReasonLength = 500
+
+	// defaultTrashRetention 未配置时删除的链接在回收站中保留的时长
+	defaultTrashRetention = 30 * 24 * time.Hour
+
+	// 未配置时使用的解锁规则
+	defaultUnlockTTL           = 10 * time.Minute
+	defaultUnlockMaxAttempts   = 5
+	defaultUnlockAttemptWindow = 15 * time.Minute
+	unlockTrackedCodes         = 10000
+
+	// 未配置时使用的别名规则
+	defaultAliasCharset   = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_"
+	defaultAliasMinLength = 3
+	defaultAliasMaxLength = 32
 )
 
 // URLService URL 业务逻辑服务
 type URLService struct {
-	storage *storage.MemoryStorage
-	config  *config.Config
+	storage  storage.Store
+	config   *config.Config
+	clicks   *ClickRecorder // 为 nil 时同步更新访问计数
+	reaper   *ExpiryReaper  // 只用于统计信息
+	geo      *GeoLocator    // 为 nil 时地理位置条件都不匹配
+	codes    utils.CodeGenerator
+	reserved *utils.ReservedCodes  // 为 nil 时不检查保留字
+	unlocks  *utils.Signer         // 签发密码保护链接的访问凭证
+	attempts *utils.AttemptLimiter // 按短码限制密码输错次数
 }
 
 // NewURLService 创建新的 URL 服务实例
-func NewURLService(storage *storage.MemoryStorage, config *config.Config) *URLService {
+func NewURLService(storage storage.Store, config *config.Config) *URLService {
+	maxAttempts, window := config.UnlockMaxAttempts, config.UnlockAttemptWindow
+	if maxAttempts <= 0 {
+		maxAttempts = defaultUnlockMaxAttempts
+	}
+	if window <= 0 {
+		window = defaultUnlockAttemptWindow
+	}
+
 	return &URLService{
-		storage: storage,
-		config:  config,
+		storage:  storage,
+		config:   config,
+		codes:    utils.NewSequentialGenerator(nil),
+		unlocks:  utils.NewSigner(config.UnlockSecret),
+		attempts: utils.NewAttemptLimiter(maxAttempts, window, unlockTrackedCodes),
 	}
 }
 
-// ShortenURL 创建短链接
+// SetCodeGenerator 设置短码生成策略，默认按 ID 顺序生成
+func (s *URLService) SetCodeGenerator(codes utils.CodeGenerator) {
+	s.codes = codes
+}
+
+// SetReservedCodes 设置保留字表，生成的短码和别名都不能命中保留字
+func (s *URLService) SetReservedCodes(reserved *utils.ReservedCodes) {
+	s.reserved = reserved
+}
+
+// SetClickRecorder 设置异步点击记录器，之后访问计数不再阻塞重定向
+func (s *URLService) SetClickRecorder(clicks *ClickRecorder) {
+	s.clicks = clicks
+}
+
+// SetExpiryReaper 设置过期清理任务，其统计信息会出现在 GetStats 中
+func (s *URLService) SetExpiryReaper(reaper *ExpiryReaper) {
+	s.reaper = reaper
+}
+
+// SetGeoLocator 设置 IP 地理位置查询，用于匹配按国家和大洲跳转的规则
+func (s *URLService) SetGeoLocator(geo *GeoLocator) {
+	s.geo = geo
+}
+
+// ShortenURL 为原始 URL 创建短链接
 func (s *URLService) ShortenURL(originalURL string) (*models.ShortenResponse, error) {
-	// 验证 URL 格式
-	if err := s.validateURL(originalURL); err != nil {
+	return s.CreateShortURL(&models.ShortenRequest{URL: originalURL})
+}
+
+// CreateShortURL 按请求创建短链接，指定别名时使用别名作为短码
+func (s *URLService) CreateShortURL(req *models.ShortenRequest) (*models.ShortenResponse, error) {
+	// 验证 URL 格式，模板在填充之前不是完整的 URL，单独校验；模板自己使用路径，不能再转发路径
+	originalURL := req.URL
+	if req.Template {
+		if err := s.validateTemplate(req.URL); err != nil {
+			return nil, err
+		}
+		if req.PathPassthrough {
+			return nil, ErrInvalidTemplate
+		}
+	} else {
+		if err := s.validateURL(req.URL); err != nil {
+			return nil, err
+		}
+		originalURL = s.normalizeURL(req.URL)
+	}
+
+	now := time.Now()
+	expiresAt, err := s.expiration(req, now)
+	if err != nil {
+		return nil, err
+	}
+	maxClicks, err := s.clickLimit(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateSchedule(req.ActivateAt, req.DeactivateAt, req.FallbackURL, now); err != nil {
 		return nil, err
 	}
+	fallbackURL := ""
+	if req.FallbackURL != "" {
+		fallbackURL = s.normalizeURL(req.FallbackURL)
+	}
+	passwordHash, err := s.hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if req.RedirectType != 0 && !isRedirectType(req.RedirectType) {
+		return nil, ErrInvalidRedirect
+	}
+	if !isQueryPassthrough(req.QueryPassthrough) {
+		return nil, ErrInvalidQueryMode
+	}
+	rules, err := s.validateRules(req.Rules)
+	if err != nil {
+		return nil, err
+	}
+	// 版本的目标地址取代 url，模板不会被用到
+	variants, err := s.validateVariants(req.Variants)
+	if err != nil {
+		return nil, err
+	}
+	if len(variants) > 0 && req.Template {
+		return nil, ErrInvalidVariants
+	}
+
+	// 短码和 ID 在保存时填入
+	template := &models.URL{
+		OriginalURL: originalURL,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+		MaxClicks:   maxClicks,
 
-	// 标准化 URL（确保有协议前缀）
-	normalizedURL := s.normalizeURL(originalURL)
+		ActivateAt:   req.ActivateAt,
+		DeactivateAt: req.DeactivateAt,
+		FallbackURL:  fallbackURL,
+
+		PasswordHash: passwordHash,
+		RedirectType: req.RedirectType,
+
+		QueryPassthrough: req.QueryPassthrough,
+		PathPassthrough:  req.PathPassthrough,
+
+		Template: req.Template,
+		Rules:    rules,
+		Variants: variants,
+	}
 
 	// 保存到存储
-	urlRecord, err := s.storage.Save(normalizedURL)
+	var urlRecord *models.URL
+	if req.Alias != "" {
+		urlRecord, err = s.saveAlias(template, req.Alias)
+	} else {
+		urlRecord, err = s.save(template)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -54,63 +296,373 @@ func (s *URLService) ShortenURL(originalURL string) (*models.ShortenResponse, er
 		ShortCode:   urlRecord.ShortCode,
 		ShortURL:    s.buildShortURL(urlRecord.ShortCode),
 		CreatedAt:   urlRecord.CreatedAt,
+		ExpiresAt:   urlRecord.ExpiresAt,
+		MaxClicks:   urlRecord.MaxClicks,
+
+		ActivateAt:   urlRecord.ActivateAt,
+		DeactivateAt: urlRecord.DeactivateAt,
+		FallbackURL:  urlRecord.FallbackURL,
+
+		PasswordProtected: urlRecord.PasswordHash != "",
+		RedirectType:      s.redirectType(urlRecord),
+
+		QueryPassthrough: urlRecord.QueryPassthrough,
+		PathPassthrough:  urlRecord.PathPassthrough,
+	}
+	if urlRecord.Template {
+		response.Template = true
+		response.TemplateVariables = templateVariables(urlRecord.OriginalURL)
 	}
+	response.Rules = urlRecord.Rules
+	response.Variants = variantInfo(urlRecord.Variants, false)
 
 	return response, nil
 }
 
-// GetOriginalURL 根据短码获取原始 URL 并增加访问计数
+// GetOriginalURL 根据短码获取原始 URL 并增加访问计数。
+// 在回收站中的链接返回 ErrURLDeleted，被禁用的链接返回 *DisabledError；
+// 链接不在生效时间窗口内时返回 *InactiveError，其中带有可以跳转的备用地址；
+// 设置了密码的链接返回 ErrPasswordRequired，需要通过 GetUnlockedURL 访问。
 func (s *URLService) GetOriginalURL(shortCode string) (string, error) {
-	// 验证短码格式
-	if !utils.IsValidBase62(shortCode) {
-		return "", ErrInvalidShortCode
+	redirect, err := s.resolve(shortCode, "", nil)
+	if err != nil {
+		return "", err
 	}
+	return redirect.URL, nil
+}
 
-	// 获取 URL 记录
-	urlRecord, err := s.storage.GetByShortCode(shortCode)
+// GetUnlockedURL 与 GetOriginalURL 相同，但允许用 Unlock 签发的凭证访问设置了密码的链接
+func (s *URLService) GetUnlockedURL(shortCode, token string) (string, error) {
+	redirect, err := s.resolve(shortCode, token, nil)
 	if err != nil {
-		if err == storage.ErrURLNotFound {
-			return "", ErrURLNotFound
-		}
 		return "", err
 	}
+	return redirect.URL, nil
+}
 
-	// 增加访问计数
-	if err := s.storage.IncrementAccessCount(shortCode); err != nil {
-		// 记录错误但不影响重定向
-		// 在实际应用中可以使用日志记录
+// ResolveRedirect 与 GetUnlockedURL 相同，同时返回链接使用的重定向状态码和缓存策略。
+// visit 为访问请求的路径和查询参数，按链接的转发设置拼接到目标地址上；
+// 带有路径但链接没有开启路径转发时返回 ErrURLNotFound，路径无法拼接时返回 ErrInvalidPath，
+// 模板链接缺少变量或变量值不合法时返回 *TemplateError。
+func (s *URLService) ResolveRedirect(shortCode, token string, visit *Visit) (*Redirect, error) {
+	return s.resolve(shortCode, token, visit)
+}
+
+// Unlock 校验链接的访问密码，成功时返回访问凭证及其过期时间。
+// 同一短码在一段时间内输错次数过多时返回 *TooManyAttemptsError。
+func (s *URLService) Unlock(shortCode, password string) (string, time.Time, error) {
+	urlRecord, err := s.lookup(shortCode)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// 在比较哈希之前检查，被限制时不消耗 bcrypt 的计算
+	if allowed, retryAfter := s.attempts.Allow(shortCode); !allowed {
+		return "", time.Time{}, &TooManyAttemptsError{RetryAfter: retryAfter}
+	}
+	if urlRecord.PasswordHash == "" {
+		return "", time.Time{}, ErrNoPassword
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(urlRecord.PasswordHash), []byte(password)) != nil {
+		s.attempts.Fail(shortCode)
+		return "", time.Time{}, ErrWrongPassword
+	}
+	s.attempts.Reset(shortCode)
+
+	ttl := s.config.UnlockTTL
+	if ttl <= 0 {
+		ttl = defaultUnlockTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+	return s.unlocks.Sign(unlockPayload(urlRecord), expiresAt), expiresAt, nil
+}
+
+// resolve 查找短码对应的原始 URL，token 为访问密码保护链接的凭证，visit 为 nil 时不转发请求信息
+func (s *URLService) resolve(shortCode, token string, visit *Visit) (*Redirect, error) {
+	// 验证短码格式并获取 URL 记录；过期后被清理的链接仍然按过期处理
+	urlRecord, err := s.lookup(shortCode)
+	if err == ErrURLNotFound && s.wasExpired(shortCode) {
+		return nil, ErrURLExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 回收站中和被禁用的链接不再跳转
+	if urlRecord.DeletedAt != nil {
+		return nil, ErrURLDeleted
+	}
+	if urlRecord.DisabledAt != nil {
+		return nil, &DisabledError{Reason: urlRecord.DisabledReason}
+	}
+
+	// 已过期但还没被清理的链接
+	now := time.Now()
+	if urlRecord.IsExpired(now) {
+		return nil, ErrURLExpired
+	}
+
+	// 凭证与密码哈希绑定，修改密码后之前签发的凭证全部失效；
+	// 在生效时间之前检查，不向没有密码的人透露生效时间和备用地址
+	if urlRecord.PasswordHash != "" && (token == "" || !s.unlocks.Verify(unlockPayload(urlRecord), token)) {
+		return nil, ErrPasswordRequired
+	}
+
+	// 不在生效时间窗口内的访问不计数
+	if err := s.checkSchedule(urlRecord, now); err != nil {
+		return nil, err
+	}
+
+	// 没有开启路径转发的普通链接只匹配短码本身；拼接失败的访问不计数
+	if visit.hasPath() && !urlRecord.PathPassthrough && !urlRecord.Template {
+		return nil, ErrURLNotFound
+	}
+	target, variant, err := destination(urlRecord, visit, s.geo)
+	if err != nil {
+		var templateErr *TemplateError
+		if errors.As(err, &templateErr) {
+			return nil, err
+		}
+		return nil, ErrInvalidPath
 	}
 
-	return urlRecord.OriginalURL, nil
+	// 限制了访问次数的链接同步计数，由存储在递增时原子地检查限制，并发访问不会超出
+	if urlRecord.MaxClicks > 0 {
+		if err := s.storage.IncrementAccessCount(shortCode); err != nil {
+			if errors.Is(err, storage.ErrClickLimitReached) {
+				return nil, ErrURLExhausted
+			}
+			if errors.Is(err, storage.ErrURLNotFound) {
+				return nil, ErrURLNotFound
+			}
+			return nil, err
+		}
+		if variant != "" {
+			if err := s.storage.AddVariantClicks(map[string]map[string]uint64{shortCode: {variant: 1}}); err != nil {
+				log.Printf("failed to record variant click for %s: %v", shortCode, err)
+			}
+		}
+		return s.redirect(urlRecord, target, variant, now), nil
+	}
+
+	// 增加访问计数
+	s.recordClick(shortCode, variant)
+
+	return s.redirect(urlRecord, target, variant, now), nil
 }
 
 // GetURLInfo 获取短链接详细信息
 func (s *URLService) GetURLInfo(shortCode string) (*models.URLInfoResponse, error) {
-	// 验证短码格式
-	if !utils.IsValidBase62(shortCode) {
-		return nil, ErrInvalidShortCode
+	// 验证短码格式并获取 URL 记录
+	urlRecord, err := s.lookup(shortCode)
+	if err != nil {
+		return nil, err
 	}
 
-	// 获取 URL 记录
-	urlRecord, err := s.storage.GetByShortCode(shortCode)
+	response := s.urlInfo(urlRecord)
+
+	// 修改过的链接返回当前版本号，用于查看历史和恢复
+	revisions, err := s.storage.GetRevisions(shortCode)
 	if err != nil {
-		if err == storage.ErrURLNotFound {
-			return nil, ErrURLNotFound
-		}
 		return nil, err
 	}
+	response.Revision = len(revisions)
 
-	// 构建响应
+	return response, nil
+}
+
+// urlInfo 根据记录构建详细信息
+func (s *URLService) urlInfo(urlRecord *models.URL) *models.URLInfoResponse {
 	response := &models.URLInfoResponse{
 		ID:          urlRecord.ID,
 		OriginalURL: urlRecord.OriginalURL,
 		ShortCode:   urlRecord.ShortCode,
 		ShortURL:    s.buildShortURL(urlRecord.ShortCode),
 		CreatedAt:   urlRecord.CreatedAt,
-		AccessCount: urlRecord.AccessCount,
+		AccessCount: urlRecord.LoadAccessCount(),
+		ExpiresAt:   urlRecord.ExpiresAt,
 	}
 
-	return response, nil
+	// 剩余有效期，向上取整到秒，已过期时为 0
+	if urlRecord.ExpiresAt != nil {
+		remaining := time.Until(*urlRecord.ExpiresAt)
+		expiresIn := int64((remaining + time.Second - 1) / time.Second)
+		if remaining <= 0 {
+			expiresIn = 0
+			response.Expired = true
+		}
+		response.ExpiresIn = &expiresIn
+	}
+
+	if urlRecord.MaxClicks > 0 {
+		clicksLeft := uint64(0)
+		if count := urlRecord.LoadAccessCount(); count < urlRecord.MaxClicks {
+			clicksLeft = urlRecord.MaxClicks - count
+		}
+		response.MaxClicks = urlRecord.MaxClicks
+		response.ClicksLeft = &clicksLeft
+		response.Exhausted = clicksLeft == 0
+	}
+
+	response.ActivateAt = urlRecord.ActivateAt
+	response.DeactivateAt = urlRecord.DeactivateAt
+	response.FallbackURL = urlRecord.FallbackURL
+	response.Pending = urlRecord.IsPending(time.Now())
+	response.Deactivated = urlRecord.IsDeactivated(time.Now())
+
+	response.RedirectType = s.redirectType(urlRecord)
+	response.QueryPassthrough = urlRecord.QueryPassthrough
+	response.PathPassthrough = urlRecord.PathPassthrough
+	if urlRecord.Template {
+		response.Template = true
+		response.TemplateVariables = templateVariables(urlRecord.OriginalURL)
+	}
+	response.Rules = urlRecord.Rules
+
+	// 不向没有密码的人透露目标地址，也不透露备用地址和能推断出目标地址结构的设置
+	if urlRecord.PasswordHash != "" {
+		response.PasswordProtected = true
+		response.OriginalURL = ""
+		response.FallbackURL = ""
+		response.QueryPassthrough = ""
+		response.PathPassthrough = false
+		response.Template = false
+		response.TemplateVariables = nil
+		response.Rules = nil
+	}
+	response.Variants = variantInfo(urlRecord.Variants, urlRecord.PasswordHash != "")
+
+	response.UpdatedAt = urlRecord.UpdatedAt
+
+	response.DeletedAt = urlRecord.DeletedAt
+	response.PurgeAt = urlRecord.PurgeAt
+	response.Disabled = urlRecord.DisabledAt != nil
+	response.DisabledReason = urlRecord.DisabledReason
+
+	return response
+}
+
+// GetStats 获取服务统计信息
+func (s *URLService) GetStats() (map[string]interface{}, error) {
+	stats, err := s.storage.GetStats()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.clicks != nil {
+		stats["clicks"] = s.clicks.Stats()
+	}
+	if s.reaper != nil {
+		stats["reaper"] = s.reaper.Stats()
+	}
+	if s.geo != nil {
+		stats["geo"] = s.geo.Stats()
+	}
+
+	return stats, nil
+}
+
+// redirect 构建跳转到 target 的重定向结果，target 为拼接了请求信息的原始 URL，variant 为分到的 A/B 测试版本
+func (s *URLService) redirect(urlRecord *models.URL, target, variant string, now time.Time) *Redirect {
+	status := s.redirectType(urlRecord)
+	redirect := &Redirect{
+		URL:          target,
+		Status:       status,
+		CacheControl: s.cacheControl(urlRecord, status, now),
+		Variant:      variant,
+	}
+
+	var vary []string
+	if len(urlRecord.Rules) > 0 {
+		vary = append(vary, "User-Agent", "Accept-Language")
+	}
+	if len(urlRecord.Variants) > 0 {
+		if len(vary) == 0 {
+			vary = append(vary, "User-Agent")
+		}
+		vary = append(vary, "Cookie")
+	}
+	redirect.Vary = strings.Join(vary, ", ")
+
+	return redirect
+}
+
+// redirectType 返回链接实际使用的重定向状态码
+func (s *URLService) redirectType(urlRecord *models.URL) int {
+	if urlRecord.RedirectType != 0 {
+		return urlRecord.RedirectType
+	}
+
+	// 有期限、次数限制或密码的链接被浏览器永久记住后这些限制都会失效，默认使用临时重定向
+	if urlRecord.ExpiresAt != nil || urlRecord.MaxClicks > 0 || urlRecord.ActivateAt != nil ||
+		urlRecord.DeactivateAt != nil || urlRecord.PasswordHash != "" {
+		return http.StatusFound
+	}
+
+	if isRedirectType(s.config.DefaultRedirectType) {
+		return s.config.DefaultRedirectType
+	}
+	return defaultRedirectType
+}
+
+// cacheControl 返回重定向响应的 Cache-Control。
+// 临时重定向不允许缓存，保证每次访问都经过服务；永久重定向最多缓存 RedirectMaxAge，
+// 并且不超过链接剩余的有效期。
+func (s *URLService) cacheControl(urlRecord *models.URL, status int, now time.Time) string {
+	if status == http.StatusFound || status == http.StatusTemporaryRedirect {
+		return "no-store"
+	}
+
+	// 每次访问都必须计数或校验凭证的链接即使指定了永久重定向也不缓存
+	if urlRecord.MaxClicks > 0 || urlRecord.PasswordHash != "" {
+		return "no-store"
+	}
+
+	maxAge := s.config.RedirectMaxAge
+	for _, deadline := range []*time.Time{urlRecord.ExpiresAt, urlRecord.DeactivateAt} {
+		if deadline != nil && deadline.Sub(now) < maxAge {
+			maxAge = deadline.Sub(now)
+		}
+	}
+
+	seconds := int64(maxAge / time.Second)
+	if seconds <= 0 {
+		return "no-store"
+	}
+
+	// 按访问者选择目标地址的链接只允许浏览器自己缓存，共享缓存可能把一个人的结果交给另一个人
+	if len(urlRecord.Rules) > 0 || len(urlRecord.Variants) > 0 {
+		return fmt.Sprintf("private, max-age=%d", seconds)
+	}
+	return fmt.Sprintf("public, max-age=%d", seconds)
+}
+
+// isRedirectType 判断状态码是否是支持的重定向方式
+func isRedirectType(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// recordClick 记录一次访问，variant 为分到的 A/B 测试版本；失败时只记录日志，不影响重定向
+func (s *URLService) recordClick(shortCode, variant string) {
+	if s.clicks != nil {
+		s.clicks.RecordVariant(shortCode, variant)
+		return
+	}
+
+	if err := s.storage.IncrementAccessCount(shortCode); err != nil {
+		log.Printf("failed to increment access count for %s: %v", shortCode, err)
+		return
+	}
+	if variant != "" {
+		if err := s.storage.AddVariantClicks(map[string]map[string]uint64{shortCode: {variant: 1}}); err != nil {
+			log.Printf("failed to record variant click for %s: %v", shortCode, err)
+		}
+	}
 }
 
 // validateURL 验证 URL 格式
@@ -150,6 +702,272 @@ func (s *URLService) validateURL(rawURL string) error {
 	return nil
 }
 
+// expiration 根据请求计算过期时间，过期时间和有效秒数只能指定一个，且必须在未来
+func (s *URLService) expiration(req *models.ShortenRequest, now time.Time) (*time.Time, error) {
+	switch {
+	case req.ExpiresAt != nil && req.TTLSeconds != 0:
+		return nil, ErrInvalidExpiration
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return nil, ErrInvalidExpiration
+		}
+		return req.ExpiresAt, nil
+	case req.TTLSeconds < 0 || req.TTLSeconds > math.MaxInt64/int64(time.Second):
+		return nil, ErrInvalidExpiration
+	case req.TTLSeconds > 0:
+		expiresAt := now.Add(time.Duration(req.TTLSeconds) * time.Second)
+		return &expiresAt, nil
+	default:
+		return nil, nil
+	}
+}
+
+// hashPassword 计算访问密码的 bcrypt 哈希，密码为空时返回空字符串
+func (s *URLService) hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxPasswordLength {
+		return "", ErrInvalidPassword
+	}
+
+	cost := s.config.PasswordHashCost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// unlockPayload 访问凭证签名的内容：短码和密码哈希
+func unlockPayload(urlRecord *models.URL) string {
+	return urlRecord.ShortCode + "\x00" + urlRecord.PasswordHash
+}
+
+// clickLimit 根据请求计算访问次数限制，一次性链接相当于只能访问一次
+func (s *URLService) clickLimit(req *models.ShortenRequest) (uint64, error) {
+	if !req.OneTime {
+		return req.MaxClicks, nil
+	}
+	if req.MaxClicks > 1 {
+		return 0, ErrInvalidClickLimit
+	}
+	return 1, nil
+}
+
+// validateSchedule 检查生效时间窗口：停止时间必须在未来且晚于开始时间，备用地址必须是有效 URL
+func (s *URLService) validateSchedule(activateAt, deactivateAt *time.Time, fallbackURL string, now time.Time) error {
+	if deactivateAt != nil {
+		if !deactivateAt.After(now) {
+			return ErrInvalidSchedule
+		}
+		if activateAt != nil && !deactivateAt.After(*activateAt) {
+			return ErrInvalidSchedule
+		}
+	}
+
+	if fallbackURL != "" && s.validateURL(fallbackURL) != nil {
+		return ErrInvalidFallback
+	}
+	return nil
+}
+
+// checkSchedule 检查链接在 now 时是否处于生效时间窗口内，
+// 链接没有设置备用地址时使用全局配置的备用地址
+func (s *URLService) checkSchedule(urlRecord *models.URL, now time.Time) error {
+	var inactive *InactiveError
+	switch {
+	case urlRecord.IsPending(now):
+		inactive = &InactiveError{Err: ErrURLNotYetActive, RetryAfter: urlRecord.ActivateAt.Sub(now)}
+	case urlRecord.IsDeactivated(now):
+		inactive = &InactiveError{Err: ErrURLDeactivated}
+	default:
+		return nil
+	}
+
+	inactive.FallbackURL = urlRecord.FallbackURL
+	if inactive.FallbackURL == "" {
+		inactive.FallbackURL = s.config.FallbackURL
+	}
+	return inactive
+}
+
+// save 生成短码并保存，短码被占用时换一个 ID 和短码重试。
+// template 提供除 ID 和短码以外的字段。
+func (s *URLService) save(template *models.URL) (*models.URL, error) {
+	normalizedURL := template.OriginalURL
+
+	// 可以复用时直接返回已有的链接，不消耗新的 ID
+	if template.Deduplicable() {
+		if existing, err := s.storage.GetByOriginalURL(normalizedURL); err == nil {
+			return existing, nil
+		} else if !errors.Is(err, storage.ErrURLNotFound) {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		id, err := s.storage.NextID()
+		if err != nil {
+			return nil, err
+		}
+
+		shortCode, err := s.codes.Generate(id, normalizedURL, attempt)
+		if err != nil {
+			return nil, err
+		}
+		if s.config.ShortCodeCheckChar {
+			shortCode = utils.AppendCheckChar(shortCode)
+		}
+
+		// 与路由冲突或包含屏蔽词的短码直接跳过，换下一个 ID
+		if s.isReserved(shortCode) {
+			continue
+		}
+
+		record := template.Clone()
+		record.ID = id
+		record.ShortCode = shortCode
+		urlRecord, err := s.storage.Save(record)
+		if errors.Is(err, storage.ErrCodeExists) {
+			continue
+		}
+		return urlRecord, err
+	}
+
+	return nil, fmt.Errorf("no free short code after %d attempts", maxCodeAttempts)
+}
+
+// saveAlias 以自定义别名作为短码保存。
+// 顺序生成的短码遇到已被占用的短码会自动跳过，因此别名不会挡住之后生成的短码。
+func (s *URLService) saveAlias(template *models.URL, alias string) (*models.URL, error) {
+	if !s.isValidAlias(alias) {
+		return nil, ErrInvalidAlias
+	}
+	if s.isReserved(alias) {
+		return nil, ErrAliasReserved
+	}
+
+	id, err := s.storage.NextID()
+	if err != nil {
+		return nil, err
+	}
+
+	record := template.Clone()
+	record.ID = id
+	record.ShortCode = alias
+	record.Custom = true
+	urlRecord, err := s.storage.Save(record)
+	if errors.Is(err, storage.ErrCodeExists) {
+		return nil, ErrAliasTaken
+	}
+	return urlRecord, err
+}
+
+// isReserved 检查短码是否为保留字
+func (s *URLService) isReserved(shortCode string) bool {
+	return s.reserved != nil && s.reserved.IsReserved(shortCode)
+}
+
+// isValidAlias 检查别名的长度和字符是否符合配置
+func (s *URLService) isValidAlias(alias string) bool {
+	charset, minLength, maxLength := s.aliasRules()
+	if len(alias) < minLength || len(alias) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(alias); i++ {
+		if strings.IndexByte(charset, alias[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup 校验短码格式并读取记录，短码格式无效返回 ErrInvalidShortCode，不存在返回 ErrURLNotFound。
+// 启用校验字符时自定义别名按原样保存、不带校验字符，所以没通过校验但符合别名规则的短码仍会查询存储，
+// 只有查到的是别名时才返回记录，否则当作输错的短码
+func (s *URLService) lookup(shortCode string) (*models.URL, error) {
+	checked := s.isValidShortCode(shortCode)
+	if !checked && !(s.config.ShortCodeCheckChar && s.isValidAlias(shortCode)) {
+		return nil, ErrInvalidShortCode
+	}
+
+	urlRecord, err := s.storage.GetByShortCode(shortCode)
+	if err != nil {
+		if err != storage.ErrURLNotFound {
+			return nil, err
+		}
+		if !checked {
+			return nil, ErrInvalidShortCode
+		}
+		return nil, ErrURLNotFound
+	}
+	if !checked && !urlRecord.Custom {
+		return nil, ErrInvalidShortCode
+	}
+
+	return urlRecord, nil
+}
+
+// wasExpired 判断短码是否在过期后被后台任务永久删除
+func (s *URLService) wasExpired(shortCode string) bool {
+	reason, err := s.storage.DeletionReason(shortCode)
+	return err == nil && reason == storage.DeletionExpired
+}
+
+// isValidShortCode 短码要么是生成的 Base62 编码，要么是符合规则的别名；
+// 启用校验字符时还要通过校验，输错的短码不会查询存储（别名见 lookup）
+func (s *URLService) isValidShortCode(shortCode string) bool {
+	if !s.config.ShortCodeCheckChar {
+		return utils.IsValidBase62(shortCode) || s.isValidAlias(shortCode)
+	}
+
+	if !utils.VerifyCheckChar(shortCode) {
+		return false
+	}
+	return utils.IsValidBase62(shortCode) || s.isValidAlias(shortCode[:len(shortCode)-1])
+}
+
+// SuggestShortCodes 为未通过校验的短码给出可能的正确短码：
+// 只替换一个字符就能通过校验且确实存在的短码。未启用校验字符时返回 nil。
+func (s *URLService) SuggestShortCodes(shortCode string) []string {
+	if !s.config.ShortCodeCheckChar || utils.VerifyCheckChar(shortCode) {
+		return nil
+	}
+
+	var suggestions []string
+	for _, candidate := range utils.SuggestCorrections(shortCode) {
+		if _, err := s.storage.GetByShortCode(candidate); err != nil {
+			continue
+		}
+
+		suggestions = append(suggestions, candidate)
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+	return suggestions
+}
+
+// aliasRules 返回别名规则，未配置的项使用默认值
+func (s *URLService) aliasRules() (charset string, minLength, maxLength int) {
+	charset, minLength, maxLength = s.config.AliasCharset, s.config.AliasMinLength, s.config.AliasMaxLength
+	if charset == "" {
+		charset = defaultAliasCharset
+	}
+	if minLength <= 0 {
+		minLength = defaultAliasMinLength
+	}
+	if maxLength <= 0 {
+		maxLength = defaultAliasMaxLength
+	}
+	return charset, minLength, maxLength
+}
+
 // normalizeURL 标准化 URL
 func (s *URLService) normalizeURL(rawURL string) string {
 	parsedURL, err := url.Parse(rawURL)
@@ -1,13 +1,18 @@
 package services
 
 import (
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"gin-url-shortener/config"
+	"gin-url-shortener/models"
 	"gin-url-shortener/storage"
+	"gin-url-shortener/utils"
 )
 
 func TestURLService_ShortenURL(t *testing.T) {
@@ -160,3 +165,473 @@ func TestURLService_GetURLInfo(t *testing.T) {
 		assert.Equal(t, uint64(3), info.AccessCount)
 	})
 }
+
+func TestURLService_AsyncClicks(t *testing.T) {
+	// 设置测试环境
+	memStorage := storage.NewMemoryStorage()
+	cfg := &config.Config{
+		BaseURL: "http://localhost:8080",
+	}
+	service := NewURLService(memStorage, cfg)
+	clicks := NewClickRecorder(memStorage, ClickRecorderConfig{
+		QueueSize:     100,
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+		Policy:        QueueFullBlock,
+	})
+	service.SetClickRecorder(clicks)
+
+	response, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := service.GetOriginalURL(response.ShortCode)
+		require.NoError(t, err)
+	}
+
+	// 点击在后台批量写入，关闭时全部落盘
+	require.NoError(t, clicks.Close())
+
+	info, err := service.GetURLInfo(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), info.AccessCount)
+
+	stats, err := service.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats["total_urls"])
+	assert.Contains(t, stats, "clicks")
+}
+
+// fixedGenerator 前几次总是返回同一个短码，用于模拟碰撞
+type fixedGenerator struct {
+	code     string
+	attempts []int
+}
+
+func (g *fixedGenerator) Generate(id uint64, url string, attempt int) (string, error) {
+	g.attempts = append(g.attempts, attempt)
+	if attempt < 2 {
+		return g.code, nil
+	}
+	return utils.EncodeBase62(id), nil
+}
+
+func TestURLService_CodeGenerator(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080"}
+
+	t.Run("Random codes", func(t *testing.T) {
+		service := NewURLService(storage.NewMemoryStorage(), cfg)
+		service.SetCodeGenerator(utils.NewRandomGenerator(10))
+
+		response, err := service.ShortenURL("https://www.example.com")
+		require.NoError(t, err)
+		assert.Len(t, response.ShortCode, 10)
+
+		originalURL, err := service.GetOriginalURL(response.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, "https://www.example.com", originalURL)
+	})
+
+	t.Run("Retry on collision", func(t *testing.T) {
+		service := NewURLService(storage.NewMemoryStorage(), cfg)
+		first, err := service.ShortenURL("https://www.example.com/1")
+		require.NoError(t, err)
+
+		generator := &fixedGenerator{code: first.ShortCode}
+		service.SetCodeGenerator(generator)
+
+		second, err := service.ShortenURL("https://www.example.com/2")
+		require.NoError(t, err)
+		assert.NotEqual(t, first.ShortCode, second.ShortCode)
+		assert.Equal(t, []int{0, 1, 2}, generator.attempts)
+	})
+
+	t.Run("Hash codes for repeated links", func(t *testing.T) {
+		service := NewURLService(storage.NewMemoryStorage(), cfg)
+		service.SetCodeGenerator(utils.NewHashGenerator(8))
+
+		// 不参与去重的链接每次都需要新的短码，数量超过重试次数也不会失败
+		codes := make(map[string]bool)
+		for i := 0; i < 2*maxCodeAttempts; i++ {
+			response, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", MaxClicks: 1})
+			require.NoError(t, err)
+			assert.False(t, codes[response.ShortCode])
+			codes[response.ShortCode] = true
+		}
+	})
+}
+
+func TestURLService_Alias(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:        "http://localhost:8080",
+		AliasMinLength: 1,
+	})
+
+	plain, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+
+	// 别名与已有链接指向同一个 URL 时仍然创建新的短码
+	alias, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Alias: "promo"})
+	require.NoError(t, err)
+	assert.Equal(t, "promo", alias.ShortCode)
+	assert.NotEqual(t, plain.ID, alias.ID)
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.other.com", Alias: "promo"})
+	assert.Equal(t, ErrAliasTaken, err)
+
+	// 别名占用了之后的顺序短码时，顺序生成会跳过它
+	taken := utils.EncodeBase62(alias.ID + 2)
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.net", Alias: taken})
+	require.NoError(t, err)
+
+	generated, err := service.ShortenURL("https://www.generated.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, taken, generated.ShortCode)
+
+	originalURL, err := service.GetOriginalURL(taken)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.net", originalURL)
+}
+
+func TestURLService_ReservedCodes(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{BaseURL: "http://localhost:8080"})
+
+	reserved := utils.NewReservedCodes()
+	reserved.Add("info")
+	reserved.AddWords("2", "3") // 让 ID 2、3 的顺序短码被跳过
+	service.SetReservedCodes(reserved)
+
+	first, err := service.ShortenURL("https://www.example.com/1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", first.ShortCode)
+
+	second, err := service.ShortenURL("https://www.example.com/2")
+	require.NoError(t, err)
+	assert.Equal(t, "4", second.ShortCode)
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Alias: "INFO"})
+	assert.Equal(t, ErrAliasReserved, err)
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Alias: "abc2def"})
+	assert.Equal(t, ErrAliasReserved, err)
+}
+
+func TestURLService_CheckChar(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:            "http://localhost:8080",
+		ShortCodeCheckChar: true,
+	})
+
+	response, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+	assert.True(t, utils.VerifyCheckChar(response.ShortCode))
+
+	originalURL, err := service.GetOriginalURL(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com", originalURL)
+
+	// 输错一个字符时在查询存储前失败，并能给出正确的短码
+	typo := []byte(response.ShortCode)
+	typo[0] = 'x'
+	_, err = service.GetOriginalURL(string(typo))
+	assert.Equal(t, ErrInvalidShortCode, err)
+	assert.Equal(t, []string{response.ShortCode}, service.SuggestShortCodes(string(typo)))
+
+	// 别名按原样保存，不带校验字符
+	alias, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Alias: "launch-2026"})
+	require.NoError(t, err)
+	assert.Equal(t, "launch-2026", alias.ShortCode)
+	_, err = service.GetOriginalURL("launch-2026")
+	require.NoError(t, err)
+	info, err := service.GetURLInfo("launch-2026")
+	require.NoError(t, err)
+	assert.Equal(t, "launch-2026", info.ShortCode)
+
+	// 没通过校验、也不是已有别名的短码仍然是格式错误
+	_, err = service.GetOriginalURL("launch-2027")
+	assert.Equal(t, ErrInvalidShortCode, err)
+}
+
+func TestURLService_Expiration(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	service := NewURLService(memStorage, &config.Config{BaseURL: "http://localhost:8080"})
+
+	plain, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+	assert.Nil(t, plain.ExpiresAt)
+
+	// 有期限的链接不复用已有的短码
+	expiring, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", TTLSeconds: 3600})
+	require.NoError(t, err)
+	assert.NotEqual(t, plain.ShortCode, expiring.ShortCode)
+	require.NotNil(t, expiring.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *expiring.ExpiresAt, time.Second)
+
+	info, err := service.GetURLInfo(expiring.ShortCode)
+	require.NoError(t, err)
+	require.NotNil(t, info.ExpiresIn)
+	assert.InDelta(t, 3600, *info.ExpiresIn, 1)
+	assert.False(t, info.Expired)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+	invalid := []models.ShortenRequest{
+		{URL: "https://www.example.com", TTLSeconds: -1},
+		{URL: "https://www.example.com", ExpiresAt: &past},
+		{URL: "https://www.example.com", ExpiresAt: &future, TTLSeconds: 60},
+	}
+	for _, req := range invalid {
+		_, err := service.CreateShortURL(&req)
+		assert.Equal(t, ErrInvalidExpiration, err)
+	}
+
+	// 已过期但尚未清理的链接
+	_, err = memStorage.Save(&models.URL{
+		ID:          100,
+		OriginalURL: "https://www.expired.com",
+		ShortCode:   "expired",
+		CreatedAt:   time.Now().Add(-time.Hour),
+		ExpiresAt:   &past,
+	})
+	require.NoError(t, err)
+
+	_, err = service.GetOriginalURL("expired")
+	assert.Equal(t, ErrURLExpired, err)
+
+	info, err = service.GetURLInfo("expired")
+	require.NoError(t, err)
+	assert.True(t, info.Expired)
+	assert.Equal(t, int64(0), *info.ExpiresIn)
+	assert.Equal(t, uint64(0), info.AccessCount)
+}
+
+func TestURLService_ClickLimit(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	service := NewURLService(memStorage, &config.Config{BaseURL: "http://localhost:8080"})
+
+	// 开启异步点击记录时，限制了次数的链接仍然同步计数
+	clicks := NewClickRecorder(memStorage, ClickRecorderConfig{QueueSize: 10, BatchSize: 10, FlushInterval: time.Hour})
+	defer clicks.Close()
+	service.SetClickRecorder(clicks)
+
+	limited, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", MaxClicks: 2})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), limited.MaxClicks)
+
+	for i := 0; i < 2; i++ {
+		_, err := service.GetOriginalURL(limited.ShortCode)
+		require.NoError(t, err)
+	}
+	_, err = service.GetOriginalURL(limited.ShortCode)
+	assert.Equal(t, ErrURLExhausted, err)
+
+	info, err := service.GetURLInfo(limited.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.AccessCount)
+	assert.Equal(t, uint64(0), *info.ClicksLeft)
+	assert.True(t, info.Exhausted)
+
+	oneTime, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", OneTime: true})
+	require.NoError(t, err)
+	assert.NotEqual(t, limited.ShortCode, oneTime.ShortCode)
+	assert.Equal(t, uint64(1), oneTime.MaxClicks)
+
+	info, err = service.GetURLInfo(oneTime.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), *info.ClicksLeft)
+
+	_, err = service.GetOriginalURL(oneTime.ShortCode)
+	require.NoError(t, err)
+	_, err = service.GetOriginalURL(oneTime.ShortCode)
+	assert.Equal(t, ErrURLExhausted, err)
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", OneTime: true, MaxClicks: 3})
+	assert.Equal(t, ErrInvalidClickLimit, err)
+}
+
+func TestURLService_ActivationWindow(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	service := NewURLService(memStorage, &config.Config{
+		BaseURL:     "http://localhost:8080",
+		FallbackURL: "https://www.example.com/default",
+	})
+
+	activateAt := time.Now().Add(time.Hour)
+	pending, err := service.CreateShortURL(&models.ShortenRequest{
+		URL:         "https://www.example.com/launch",
+		ActivateAt:  &activateAt,
+		FallbackURL: "www.example.com/soon",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "http://www.example.com/soon", pending.FallbackURL)
+
+	_, err = service.GetOriginalURL(pending.ShortCode)
+	var inactive *InactiveError
+	require.ErrorAs(t, err, &inactive)
+	assert.ErrorIs(t, err, ErrURLNotYetActive)
+	assert.InDelta(t, time.Hour.Seconds(), inactive.RetryAfter.Seconds(), 1)
+	assert.Equal(t, "http://www.example.com/soon", inactive.FallbackURL)
+
+	info, err := service.GetURLInfo(pending.ShortCode)
+	require.NoError(t, err)
+	assert.True(t, info.Pending)
+	assert.Equal(t, uint64(0), info.AccessCount)
+
+	// 已停止生效且没有单独的备用地址时使用全局配置
+	past := time.Now().Add(-time.Minute)
+	_, err = memStorage.Save(&models.URL{
+		ID:           100,
+		OriginalURL:  "https://www.example.com/old",
+		ShortCode:    "ended",
+		CreatedAt:    time.Now().Add(-time.Hour),
+		DeactivateAt: &past,
+	})
+	require.NoError(t, err)
+
+	_, err = service.GetOriginalURL("ended")
+	require.ErrorAs(t, err, &inactive)
+	assert.ErrorIs(t, err, ErrURLDeactivated)
+	assert.Zero(t, inactive.RetryAfter)
+	assert.Equal(t, "https://www.example.com/default", inactive.FallbackURL)
+
+	invalid := []models.ShortenRequest{
+		{URL: "https://www.example.com", DeactivateAt: &past},
+		{URL: "https://www.example.com", ActivateAt: &activateAt, DeactivateAt: &activateAt},
+	}
+	for _, req := range invalid {
+		_, err := service.CreateShortURL(&req)
+		assert.Equal(t, ErrInvalidSchedule, err)
+	}
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", FallbackURL: "not a url"})
+	assert.Equal(t, ErrInvalidFallback, err)
+}
+
+func TestURLService_Password(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:           "http://localhost:8080",
+		PasswordHashCost:  4,
+		UnlockMaxAttempts: 2,
+	})
+
+	protected, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com/internal", Password: "s3cret"})
+	require.NoError(t, err)
+	assert.True(t, protected.PasswordProtected)
+
+	_, err = service.GetOriginalURL(protected.ShortCode)
+	assert.Equal(t, ErrPasswordRequired, err)
+	_, err = service.GetUnlockedURL(protected.ShortCode, "bogus")
+	assert.Equal(t, ErrPasswordRequired, err)
+
+	// 不向没有密码的人透露目标地址
+	info, err := service.GetURLInfo(protected.ShortCode)
+	require.NoError(t, err)
+	assert.True(t, info.PasswordProtected)
+	assert.Empty(t, info.OriginalURL)
+
+	// 备用地址、转发和模板设置同样不透露，历史版本也一样
+	detailed, err := service.CreateShortURL(&models.ShortenRequest{
+		URL:              "https://www.example.com/{org}/{repo}",
+		Password:         "s3cret",
+		FallbackURL:      "https://www.example.com/closed",
+		QueryPassthrough: "keep",
+		Template:         true,
+	})
+	require.NoError(t, err)
+	info, err = service.GetURLInfo(detailed.ShortCode)
+	require.NoError(t, err)
+	assert.Empty(t, info.FallbackURL)
+	assert.Empty(t, info.QueryPassthrough)
+	assert.False(t, info.Template)
+	assert.Empty(t, info.TemplateVariables)
+	history, err := service.GetHistory(detailed.ShortCode)
+	require.NoError(t, err)
+	require.Len(t, history.Revisions, 1)
+	assert.True(t, history.Revisions[0].PasswordProtected)
+	assert.Empty(t, history.Revisions[0].OriginalURL)
+	assert.Empty(t, history.Revisions[0].FallbackURL)
+	assert.Empty(t, history.Revisions[0].QueryPassthrough)
+	assert.False(t, history.Revisions[0].Template)
+
+	token, expiresAt, err := service.Unlock(protected.ShortCode, "s3cret")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(defaultUnlockTTL), expiresAt, time.Second)
+
+	originalURL, err := service.GetUnlockedURL(protected.ShortCode, token)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/internal", originalURL)
+
+	// 凭证只对签发它的短链接有效
+	other, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com/other", Password: "s3cret"})
+	require.NoError(t, err)
+	_, err = service.GetUnlockedURL(other.ShortCode, token)
+	assert.Equal(t, ErrPasswordRequired, err)
+
+	// 输错次数过多后暂时拒绝，即使密码正确
+	for i := 0; i < 2; i++ {
+		_, _, err = service.Unlock(other.ShortCode, "wrong")
+		assert.Equal(t, ErrWrongPassword, err)
+	}
+	_, _, err = service.Unlock(other.ShortCode, "s3cret")
+	var tooMany *TooManyAttemptsError
+	require.ErrorAs(t, err, &tooMany)
+	assert.Greater(t, tooMany.RetryAfter, time.Duration(0))
+
+	plain, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+	_, _, err = service.Unlock(plain.ShortCode, "anything")
+	assert.Equal(t, ErrNoPassword, err)
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Password: strings.Repeat("x", 73)})
+	assert.Equal(t, ErrInvalidPassword, err)
+}
+
+func TestURLService_RedirectType(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:             "http://localhost:8080",
+		DefaultRedirectType: http.StatusPermanentRedirect,
+		RedirectMaxAge:      time.Hour,
+	})
+
+	// 没有单独设置时使用全局配置，永久重定向允许缓存
+	plain, err := service.ShortenURL("https://www.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPermanentRedirect, plain.RedirectType)
+	redirect, err := service.ResolveRedirect(plain.ShortCode, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPermanentRedirect, redirect.Status)
+	assert.Equal(t, "public, max-age=3600", redirect.CacheControl)
+
+	// 临时重定向不允许缓存，并且不与普通链接去重
+	temporary, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", RedirectType: http.StatusFound})
+	require.NoError(t, err)
+	assert.NotEqual(t, plain.ShortCode, temporary.ShortCode)
+	redirect, err = service.ResolveRedirect(temporary.ShortCode, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, redirect.Status)
+	assert.Equal(t, "no-store", redirect.CacheControl)
+
+	info, err := service.GetURLInfo(temporary.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, info.RedirectType)
+
+	// 有期限的链接默认临时重定向，指定永久重定向时缓存时间不超过剩余有效期
+	expiring, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", TTLSeconds: 60})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, expiring.RedirectType)
+	expiring, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", TTLSeconds: 60, RedirectType: http.StatusMovedPermanently})
+	require.NoError(t, err)
+	redirect, err = service.ResolveRedirect(expiring.ShortCode, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, redirect.Status)
+	assert.Contains(t, []string{"public, max-age=59", "public, max-age=60"}, redirect.CacheControl)
+
+	// 限制了次数的链接每次访问都要计数，不允许缓存
+	limited, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", MaxClicks: 5, RedirectType: http.StatusPermanentRedirect})
+	require.NoError(t, err)
+	redirect, err = service.ResolveRedirect(limited.ShortCode, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "no-store", redirect.CacheControl)
+
+	_, err = service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", RedirectType: http.StatusOK})
+	assert.Equal(t, ErrInvalidRedirect, err)
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+// maxUpdateAttempts 并发修改同一短链接导致版本冲突时的最大重试次数
+const maxUpdateAttempts = 3
+
+// Editor 发起修改的人，修改设置了密码的链接时需要提供链接当前的访问密码
+type Editor struct {
+	Name     string // 请求方声明的修改人，记录在修改历史中
+	Address  string // 客户端地址，与 Name 一起记录，不能由请求方指定
+	Password string
+}
+
+// UpdateURL 按 PATCH 请求修改短链接的可变字段，记录一个新版本并返回修改后的信息
+func (s *URLService) UpdateURL(shortCode string, req *models.UpdateRequest, editor Editor) (*models.URLInfoResponse, error) {
+	if req.Empty() {
+		return nil, ErrNoChanges
+	}
+
+	// 密码哈希的计算较慢，放在重试循环外只做一次
+	var passwordHash string
+	if req.Password.Set && req.Password.Value != nil {
+		hash, err := s.hashPassword(*req.Password.Value)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = hash
+	}
+
+	return s.modify(shortCode, models.RevisionUpdate, editor, 0, func(urlRecord *models.URL, _ []*models.Revision, now time.Time) error {
+		return s.applyUpdate(urlRecord, req, passwordHash, now)
+	})
+}
+
+// RevertURL 把短链接恢复到历史版本，恢复本身也会记录为一个新版本
+func (s *URLService) RevertURL(shortCode string, revision int, editor Editor) (*models.URLInfoResponse, error) {
+	return s.modify(shortCode, models.RevisionRevert, editor, revision, func(urlRecord *models.URL, history []*models.Revision, _ time.Time) error {
+		// 最新的版本就是当前状态，只能恢复到它之前的版本
+		if revision < 1 || revision >= len(history) {
+			return ErrInvalidRevision
+		}
+		history[revision-1].ApplyTo(urlRecord)
+		return nil
+	})
+}
+
+// GetHistory 获取短链接的修改历史，没有修改过的链接只有创建时的版本
+func (s *URLService) GetHistory(shortCode string) (*models.HistoryResponse, error) {
+	urlRecord, err := s.lookup(shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.history(urlRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.HistoryResponse{
+		ShortCode: shortCode,
+		Revisions: make([]*models.RevisionResponse, 0, len(history)),
+	}
+	for _, revision := range history {
+		response.Revisions = append(response.Revisions, revisionResponse(revision))
+	}
+
+	return response, nil
+}
+
+// modify 读取记录和修改历史，用 mutate 修改记录后连同新版本一起写回。
+// 设置了密码的链接需要 editor 提供当前的访问密码，见 authorize。
+// 回收站中的链接只能恢复，其他修改返回 ErrURLDeleted。
+// 其他请求同时修改了同一短链接时重新读取并重试。
+func (s *URLService) modify(shortCode, action string, editor Editor, revertedTo int,
+	mutate func(urlRecord *models.URL, history []*models.Revision, now time.Time) error) (*models.URLInfoResponse, error) {
+	// 已经校验过的密码哈希，重试时密码没有变化就不再重复计算 bcrypt
+	var authorized string
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		current, err := s.lookup(shortCode)
+		if err != nil {
+			return nil, err
+		}
+		if current.PasswordHash != "" && current.PasswordHash != authorized {
+			if err := s.authorize(current, editor.Password); err != nil {
+				return nil, err
+			}
+			authorized = current.PasswordHash
+		}
+		if current.DeletedAt != nil && action != models.RevisionRestore {
+			return nil, ErrURLDeleted
+		}
+
+		history, err := s.storage.GetRevisions(shortCode)
+		if err != nil {
+			return nil, err
+		}
+
+		// 第一次修改时把创建时的状态一并保存为版本 1
+		revisions := make([]*models.Revision, 0, 2)
+		if len(history) == 0 {
+			history = []*models.Revision{initialRevision(current)}
+			revisions = append(revisions, history[0])
+		}
+
+		now := time.Now()
+		next := current.Clone()
+		if err := mutate(next, history, now); err != nil {
+			return nil, err
+		}
+		// 给没有密码的链接加上密码等于占有它，之后其他人都无法再修改，只能在创建时设置
+		if current.PasswordHash == "" && next.PasswordHash != "" {
+			return nil, ErrCannotAddPassword
+		}
+		next.UpdatedAt = &now
+
+		revision := models.NewRevision(next, action, editor.Name, now)
+		revision.ActorIP = editor.Address
+		revision.Number = len(history) + 1
+		revision.RevertedTo = revertedTo
+		if action == models.RevisionDisable {
+			revision.Reason = next.DisabledReason
+		}
+		revisions = append(revisions, revision)
+
+		updated, err := s.storage.Update(next, revisions...)
+		if errors.Is(err, storage.ErrRevisionConflict) {
+			continue
+		}
+		if err != nil {
+			if errors.Is(err, storage.ErrURLNotFound) {
+				return nil, ErrURLNotFound
+			}
+			return nil, err
+		}
+
+		response := s.urlInfo(updated)
+		response.Revision = revision.Number
+		return response, nil
+	}
+
+	return nil, ErrRevisionConflict
+}
+
+// authorize 校验修改设置了密码的链接时提供的访问密码。
+// 校验的是链接当前的密码，取消密码或恢复到没有密码的版本同样需要；
+// 与 Unlock 共用输错次数的限制。
+func (s *URLService) authorize(urlRecord *models.URL, password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if allowed, retryAfter := s.attempts.Allow(urlRecord.ShortCode); !allowed {
+		return &TooManyAttemptsError{RetryAfter: retryAfter}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(urlRecord.PasswordHash), []byte(password)) != nil {
+		s.attempts.Fail(urlRecord.ShortCode)
+		return ErrWrongPassword
+	}
+	s.attempts.Reset(urlRecord.ShortCode)
+	return nil
+}
+
+// history 返回记录的完整修改历史；从未修改过的记录还没有保存历史，用当前状态生成版本 1
+func (s *URLService) history(urlRecord *models.URL) ([]*models.Revision, error) {
+	revisions, err := s.storage.GetRevisions(urlRecord.ShortCode)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		revisions = []*models.Revision{initialRevision(urlRecord)}
+	}
+
+	return revisions, nil
+}
+
+// initialRevision 用记录创建时的状态生成版本 1
+func initialRevision(urlRecord *models.URL) *models.Revision {
+	revision := models.NewRevision(urlRecord, models.RevisionCreate, "", urlRecord.CreatedAt)
+	revision.Number = 1
+	return revision
+}
+
+// applyUpdate 校验并应用 PATCH 请求中出现的字段，passwordHash 为预先计算好的新密码哈希
+func (s *URLService) applyUpdate(urlRecord *models.URL, req *models.UpdateRequest, passwordHash string, now time.Time) error {
+	if req.Template.Set {
+		urlRecord.Template = req.Template.Value != nil && *req.Template.Value
+	}
+	if req.URL.Set {
+		if req.URL.Value == nil {
+			return ErrInvalidURL
+		}
+		// 模板在最后和其他设置一起校验
+		if urlRecord.Template {
+			urlRecord.OriginalURL = *req.URL.Value
+		} else {
+			if err := s.validateURL(*req.URL.Value); err != nil {
+				return err
+			}
+			urlRecord.OriginalURL = s.normalizeURL(*req.URL.Value)
+		}
+	}
+
+	if req.ExpiresAt.Set {
+		if req.ExpiresAt.Value != nil && !req.ExpiresAt.Value.After(now) {
+			return ErrInvalidExpiration
+		}
+		urlRecord.ExpiresAt = req.ExpiresAt.Value
+	}
+
+	if req.MaxClicks.Set {
+		urlRecord.MaxClicks = 0
+		if req.MaxClicks.Value != nil {
+			urlRecord.MaxClicks = *req.MaxClicks.Value
+		}
+	}
+
+	if req.ActivateAt.Set {
+		urlRecord.ActivateAt = req.ActivateAt.Value
+	}
+	if req.DeactivateAt.Set {
+		urlRecord.DeactivateAt = req.DeactivateAt.Value
+	}
+	if req.FallbackURL.Set {
+		urlRecord.FallbackURL = ""
+		if req.FallbackURL.Value != nil && *req.FallbackURL.Value != "" {
+			if s.validateURL(*req.FallbackURL.Value) != nil {
+				return ErrInvalidFallback
+			}
+			urlRecord.FallbackURL = s.normalizeURL(*req.FallbackURL.Value)
+		}
+	}
+	// 只校验本次修改涉及的时间窗口，已经过去的停止时间不妨碍修改其他字段
+	if req.ActivateAt.Set || req.DeactivateAt.Set {
+		if err := s.validateSchedule(urlRecord.ActivateAt, urlRecord.DeactivateAt, "", now); err != nil {
+			return err
+		}
+	}
+
+	// 修改密码后之前签发的访问凭证随之失效
+	if req.Password.Set {
+		urlRecord.PasswordHash = passwordHash
+	}
+
+	if req.RedirectType.Set {
+		urlRecord.RedirectType = 0
+		if req.RedirectType.Value != nil {
+			if !isRedirectType(*req.RedirectType.Value) {
+				return ErrInvalidRedirect
+			}
+			urlRecord.RedirectType = *req.RedirectType.Value
+		}
+	}
+
+	if req.QueryPassthrough.Set {
+		urlRecord.QueryPassthrough = ""
+		if req.QueryPassthrough.Value != nil {
+			if !isQueryPassthrough(*req.QueryPassthrough.Value) {
+				return ErrInvalidQueryMode
+			}
+			urlRecord.QueryPassthrough = *req.QueryPassthrough.Value
+		}
+	}
+	if req.PathPassthrough.Set {
+		urlRecord.PathPassthrough = req.PathPassthrough.Value != nil && *req.PathPassthrough.Value
+	}
+
+	if req.Rules.Set {
+		urlRecord.Rules = nil
+		if req.Rules.Value != nil {
+			rules, err := s.validateRules(*req.Rules.Value)
+			if err != nil {
+				return err
+			}
+			urlRecord.Rules = rules
+		}
+	}
+
+	if req.Variants.Set {
+		urlRecord.Variants = nil
+		if req.Variants.Value != nil {
+			variants, err := s.validateVariants(*req.Variants.Value)
+			if err != nil {
+				return err
+			}
+			urlRecord.Variants = variants
+		}
+	}
+	if urlRecord.Template && len(urlRecord.Variants) > 0 {
+		return ErrInvalidVariants
+	}
+
+	if urlRecord.Template {
+		if req.URL.Set || req.Template.Set {
+			if err := s.validateTemplate(urlRecord.OriginalURL); err != nil {
+				return err
+			}
+		}
+		if urlRecord.PathPassthrough {
+			return ErrInvalidTemplate
+		}
+	}
+
+	return nil
+}
+
+// revisionResponse 构建历史版本的响应，与 GetURLInfo 一样不透露密码保护链接的目标地址
+func revisionResponse(revision *models.Revision) *models.RevisionResponse {
+	response := &models.RevisionResponse{
+		Revision:   revision.Number,
+		CreatedAt:  revision.CreatedAt,
+		Actor:      revision.Actor,
+		ActorIP:    revision.ActorIP,
+		Action:     revision.Action,
+		RevertedTo: revision.RevertedTo,
+		Reason:     revision.Reason,
+
+		OriginalURL:  revision.OriginalURL,
+		ExpiresAt:    revision.ExpiresAt,
+		MaxClicks:    revision.MaxClicks,
+		ActivateAt:   revision.ActivateAt,
+		DeactivateAt: revision.DeactivateAt,
+		FallbackURL:  revision.FallbackURL,
+		RedirectType: revision.RedirectType,
+
+		QueryPassthrough: revision.QueryPassthrough,
+		PathPassthrough:  revision.PathPassthrough,
+		Template:         revision.Template,
+
+		Rules:    revision.Rules,
+		Variants: revision.Variants,
+	}
+
+	if revision.PasswordHash != "" {
+		response.PasswordProtected = true
+		response.OriginalURL = ""
+		response.FallbackURL = ""
+		response.QueryPassthrough = ""
+		response.PathPassthrough = false
+		response.Template = false
+		response.Rules = nil
+		response.Variants = nil
+	}
+
+	return response
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+// patch 按 PATCH 请求体解析修改请求
+func patch(t *testing.T, body string) *models.UpdateRequest {
+	var req models.UpdateRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	return &req
+}
+
+func TestURLService_UpdateURL(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:          "http://localhost:8080",
+		PasswordHashCost: 4,
+	})
+
+	created, err := service.ShortenURL("https://www.exmaple.com")
+	require.NoError(t, err)
+
+	info, err := service.UpdateURL(created.ShortCode, patch(t, `{"url": "https://www.example.com"}`), Editor{Name: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com", info.OriginalURL)
+	assert.Equal(t, 2, info.Revision)
+	require.NotNil(t, info.UpdatedAt)
+
+	originalURL, err := service.GetOriginalURL(created.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com", originalURL)
+
+	// 修改过的链接不再参与去重
+	again, err := service.ShortenURL("https://www.exmaple.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, created.ShortCode, again.ShortCode)
+
+	// null 清除设置，未出现的字段保持不变
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"max_clicks": 10}`), Editor{Name: "bob"})
+	require.NoError(t, err)
+	info, err = service.UpdateURL(created.ShortCode, patch(t, `{"max_clicks": null}`), Editor{Name: "bob"})
+	require.NoError(t, err)
+	assert.Zero(t, info.MaxClicks)
+	assert.Equal(t, "https://www.example.com", info.OriginalURL)
+
+	history, err := service.GetHistory(created.ShortCode)
+	require.NoError(t, err)
+	require.Len(t, history.Revisions, 4)
+	assert.Equal(t, models.RevisionCreate, history.Revisions[0].Action)
+	assert.Equal(t, "https://www.exmaple.com", history.Revisions[0].OriginalURL)
+	assert.Equal(t, "alice", history.Revisions[1].Actor)
+	assert.Equal(t, uint64(10), history.Revisions[2].MaxClicks)
+
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{}`), Editor{Name: "alice"})
+	assert.Equal(t, ErrNoChanges, err)
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"url": null}`), Editor{Name: "alice"})
+	assert.Equal(t, ErrInvalidURL, err)
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"expires_at": "2000-01-01T00:00:00Z"}`), Editor{Name: "alice"})
+	assert.Equal(t, ErrInvalidExpiration, err)
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"redirect_type": 200}`), Editor{Name: "alice"})
+	assert.Equal(t, ErrInvalidRedirect, err)
+	_, err = service.UpdateURL("missing", patch(t, `{"url": "https://www.example.com"}`), Editor{Name: "alice"})
+	assert.Equal(t, ErrURLNotFound, err)
+
+	// 密码只能在创建时设置
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"password": "s3cret"}`), Editor{Name: "alice"})
+	assert.Equal(t, ErrCannotAddPassword, err)
+}
+
+func TestURLService_RevertURL(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL: "http://localhost:8080",
+	})
+
+	created, err := service.ShortenURL("https://www.example.com/v1")
+	require.NoError(t, err)
+
+	// 没有修改过的链接只有当前版本，无法恢复
+	_, err = service.RevertURL(created.ShortCode, 1, Editor{Name: "alice"})
+	assert.Equal(t, ErrInvalidRevision, err)
+
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"url": "https://www.example.com/v2"}`), Editor{Name: "alice"})
+	require.NoError(t, err)
+
+	info, err := service.RevertURL(created.ShortCode, 1, Editor{Name: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/v1", info.OriginalURL)
+	assert.Equal(t, 3, info.Revision)
+
+	history, err := service.GetHistory(created.ShortCode)
+	require.NoError(t, err)
+	require.Len(t, history.Revisions, 3)
+	assert.Equal(t, models.RevisionRevert, history.Revisions[2].Action)
+	assert.Equal(t, 1, history.Revisions[2].RevertedTo)
+	assert.Equal(t, "bob", history.Revisions[2].Actor)
+	assert.WithinDuration(t, time.Now(), history.Revisions[2].CreatedAt, time.Second)
+
+	_, err = service.RevertURL(created.ShortCode, 3, Editor{Name: "bob"})
+	assert.Equal(t, ErrInvalidRevision, err)
+	_, err = service.RevertURL(created.ShortCode, 0, Editor{Name: "bob"})
+	assert.Equal(t, ErrInvalidRevision, err)
+}
+
+func TestURLService_UpdateProtected(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:           "http://localhost:8080",
+		PasswordHashCost:  4,
+		UnlockMaxAttempts: 3,
+	})
+
+	created, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com/v1", Password: "s3cret"})
+	require.NoError(t, err)
+	owner := Editor{Name: "alice", Address: "192.0.2.1", Password: "s3cret"}
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"url": "https://www.example.com/v2"}`), owner)
+	require.NoError(t, err)
+
+	// 没有密码不能取消密码、恢复版本或做其他修改
+	mallory := Editor{Name: "alice", Address: "198.51.100.7"}
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"password": null}`), mallory)
+	assert.Equal(t, ErrPasswordRequired, err)
+	_, err = service.RevertURL(created.ShortCode, 1, mallory)
+	assert.Equal(t, ErrPasswordRequired, err)
+	_, err = service.DeleteURL(created.ShortCode, mallory)
+	assert.Equal(t, ErrPasswordRequired, err)
+	_, err = service.DisableURL(created.ShortCode, "", mallory)
+	assert.Equal(t, ErrPasswordRequired, err)
+	mallory.Password = "guess"
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"url": "https://evil.example.com"}`), mallory)
+	assert.Equal(t, ErrWrongPassword, err)
+
+	_, err = service.GetOriginalURL(created.ShortCode)
+	assert.Equal(t, ErrPasswordRequired, err)
+
+	// 历史中同样不透露目标地址，修改人的地址由服务端记录
+	history, err := service.GetHistory(created.ShortCode)
+	require.NoError(t, err)
+	require.Len(t, history.Revisions, 2)
+	latest := history.Revisions[1]
+	assert.True(t, latest.PasswordProtected)
+	assert.Empty(t, latest.OriginalURL)
+	assert.Equal(t, "alice", latest.Actor)
+	assert.Equal(t, "192.0.2.1", latest.ActorIP)
+
+	// 当前密码正确时可以取消密码
+	info, err := service.UpdateURL(created.ShortCode, patch(t, `{"password": null}`), owner)
+	require.NoError(t, err)
+	assert.False(t, info.PasswordProtected)
+	assert.Equal(t, "https://www.example.com/v2", info.OriginalURL)
+
+	// 取消之后不能再加上密码，也不能恢复到有密码的版本
+	_, err = service.UpdateURL(created.ShortCode, patch(t, `{"password": "mine"}`), Editor{Name: "mallory"})
+	assert.Equal(t, ErrCannotAddPassword, err)
+	_, err = service.RevertURL(created.ShortCode, 2, Editor{Name: "mallory"})
+	assert.Equal(t, ErrCannotAddPassword, err)
+
+	// 与解锁共用输错次数的限制
+	other, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com/other", Password: "an0ther"})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = service.EnableURL(other.ShortCode, Editor{Name: "mallory", Password: "guess"})
+		assert.Equal(t, ErrWrongPassword, err)
+	}
+	_, err = service.UpdateURL(other.ShortCode, patch(t, `{"password": null}`), Editor{Name: "alice", Password: "an0ther"})
+	var tooMany *TooManyAttemptsError
+	assert.ErrorAs(t, err, &tooMany)
+}
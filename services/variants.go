@@ -0,0 +1,130 @@
+package services
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"gin-url-shortener/models"
+)
+
+const (
+	// maxVariants 一个链接最多的 A/B 测试版本数
+	maxVariants = 10
+	// maxVariantWeight 单个版本的最大权重
+	maxVariantWeight = 10000
+)
+
+// variantName 版本名只包含小写字母、数字、- 和 _，会写入 Cookie
+var variantName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// validateVariants 校验并标准化 A/B 测试的版本：至少两个版本，版本名统一为小写且不重复，
+// 未命名的版本按顺序命名为 a、b、c……；权重之和必须大于 0，目标地址必须有效。请求中的访问次数被忽略。
+func (s *URLService) validateVariants(variants []models.Variant) ([]models.Variant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	if len(variants) < 2 || len(variants) > maxVariants {
+		return nil, ErrInvalidVariants
+	}
+
+	normalized := make([]models.Variant, 0, len(variants))
+	seen := make(map[string]bool, len(variants))
+	var total uint64
+	for i, variant := range variants {
+		name := strings.ToLower(strings.TrimSpace(variant.Name))
+		if name == "" {
+			name = string(rune('a' + i))
+		}
+		if !variantName.MatchString(name) || seen[name] {
+			return nil, ErrInvalidVariants
+		}
+		seen[name] = true
+
+		if variant.Weight > maxVariantWeight {
+			return nil, ErrInvalidVariants
+		}
+		total += variant.Weight
+
+		if s.validateURL(variant.URL) != nil {
+			return nil, ErrInvalidVariants
+		}
+
+		normalized = append(normalized, models.Variant{
+			Name:   name,
+			URL:    s.normalizeURL(variant.URL),
+			Weight: variant.Weight,
+		})
+	}
+	if total == 0 {
+		return nil, ErrInvalidVariants
+	}
+
+	return normalized, nil
+}
+
+// pickVariant 为访问者选择版本：Cookie 中记下的版本仍然存在且没有暂停时继续使用，
+// 否则按短码、IP 和 User-Agent 的哈希在权重区间中选择，同一访问者即使不带 Cookie 也落在同一个版本。
+// 没有访问请求信息时返回 nil。
+func pickVariant(shortCode string, variants []models.Variant, visit *Visit) *models.Variant {
+	if len(variants) == 0 || visit == nil {
+		return nil
+	}
+
+	var total uint64
+	for i := range variants {
+		if variants[i].Name == visit.Variant && variants[i].Weight > 0 {
+			return &variants[i]
+		}
+		total += variants[i].Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(shortCode + "\x00" + visit.ClientIP + "\x00" + visit.UserAgent))
+	point := hash.Sum64() % total
+	for i := range variants {
+		if point < variants[i].Weight {
+			return &variants[i]
+		}
+		point -= variants[i].Weight
+	}
+
+	return nil
+}
+
+// variantInfo 汇总各版本的权重占比和访问次数，hideURLs 为 true 时不返回目标地址
+func variantInfo(variants []models.Variant, hideURLs bool) []models.VariantInfo {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	var totalWeight, totalClicks uint64
+	for i := range variants {
+		totalWeight += variants[i].Weight
+		totalClicks += variants[i].LoadClicks()
+	}
+
+	info := make([]models.VariantInfo, 0, len(variants))
+	for i := range variants {
+		item := models.VariantInfo{
+			Name:   variants[i].Name,
+			Weight: variants[i].Weight,
+			Clicks: variants[i].LoadClicks(),
+		}
+		if !hideURLs {
+			item.URL = variants[i].URL
+		}
+		if totalWeight > 0 {
+			item.Share = float64(item.Weight) / float64(totalWeight)
+		}
+		if totalClicks > 0 {
+			item.ClickShare = float64(item.Clicks) / float64(totalClicks)
+		}
+		info = append(info, item)
+	}
+
+	return info
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/config"
+	"gin-url-shortener/models"
+	"gin-url-shortener/storage"
+)
+
+func TestURLService_Variants(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:        "http://localhost:8080",
+		RedirectMaxAge: time.Hour,
+	})
+
+	response, err := service.CreateShortURL(&models.ShortenRequest{
+		URL: "https://www.example.com/landing",
+		Variants: []models.Variant{
+			{Name: "Control", URL: "https://www.example.com/landing", Weight: 70},
+			{URL: "https://www.example.com/landing-new", Weight: 30},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Variants, 2)
+	assert.Equal(t, "control", response.Variants[0].Name)
+	assert.Equal(t, "b", response.Variants[1].Name)
+	assert.InDelta(t, 0.7, response.Variants[0].Share, 1e-9)
+
+	// 按权重分流，同一访问者每次都落在同一个版本
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		visit := &Visit{ClientIP: fmt.Sprintf("10.0.%d.%d", i/256, i%256), UserAgent: desktopUA}
+		redirect, err := service.ResolveRedirect(response.ShortCode, "", visit)
+		require.NoError(t, err)
+		counts[redirect.Variant]++
+
+		again, err := service.ResolveRedirect(response.ShortCode, "", visit)
+		require.NoError(t, err)
+		assert.Equal(t, redirect.URL, again.URL)
+		assert.Equal(t, "User-Agent, Cookie", redirect.Vary)
+		assert.Equal(t, "private, max-age=3600", redirect.CacheControl)
+	}
+	assert.InDelta(t, 700, counts["control"], 60)
+	assert.InDelta(t, 300, counts["b"], 60)
+
+	// Cookie 中记下的版本优先
+	redirect, err := service.ResolveRedirect(response.ShortCode, "", &Visit{Variant: "b"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/landing-new", redirect.URL)
+	assert.Equal(t, "b", redirect.Variant)
+
+	// 没有请求信息时跳转到默认地址，只计入链接本身的访问次数
+	original, err := service.GetOriginalURL(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/landing", original)
+
+	info, err := service.GetURLInfo(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2002), info.AccessCount)
+	require.Len(t, info.Variants, 2)
+	assert.Equal(t, uint64(2*counts["control"]), info.Variants[0].Clicks)
+	assert.Equal(t, uint64(2*counts["b"]+1), info.Variants[1].Clicks)
+	assert.InDelta(t, 1, info.Variants[0].ClickShare+info.Variants[1].ClickShare, 1e-9)
+
+	// 修改时同名版本保留访问次数；权重为 0 的版本暂停分流，Cookie 中的暂停版本也不再使用
+	variants := []models.Variant{
+		{Name: "control", URL: "https://www.example.com/landing", Weight: 0},
+		{Name: "b", URL: "https://www.example.com/landing-new", Weight: 1},
+	}
+	updated, err := service.UpdateURL(response.ShortCode, &models.UpdateRequest{Variants: models.Optional[[]models.Variant]{Set: true, Value: &variants}}, Editor{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2*counts["control"]), updated.Variants[0].Clicks)
+	redirect, err = service.ResolveRedirect(response.ShortCode, "", &Visit{Variant: "control"})
+	require.NoError(t, err)
+	assert.Equal(t, "b", redirect.Variant)
+
+	history, err := service.GetHistory(response.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "control", history.Revisions[0].Variants[0].Name)
+
+	// null 清除版本，之后与普通链接相同
+	updated, err = service.UpdateURL(response.ShortCode, &models.UpdateRequest{Variants: models.Optional[[]models.Variant]{Set: true}}, Editor{})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Variants)
+	redirect, err = service.ResolveRedirect(response.ShortCode, "", &Visit{Variant: "b"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/landing", redirect.URL)
+	assert.Empty(t, redirect.Variant)
+	assert.Empty(t, redirect.Vary)
+
+	invalid := [][]models.Variant{
+		{{URL: "https://www.example.com/a", Weight: 1}},
+		{{Name: "a", URL: "https://www.example.com/a", Weight: 1}, {Name: "A", URL: "https://www.example.com/b", Weight: 1}},
+		{{Name: "a b", URL: "https://www.example.com/a", Weight: 1}, {URL: "https://www.example.com/b", Weight: 1}},
+		{{URL: "https://www.example.com/a"}, {URL: "https://www.example.com/b"}},
+		{{URL: "https://www.example.com/a", Weight: maxVariantWeight + 1}, {URL: "https://www.example.com/b", Weight: 1}},
+		{{URL: "not a url", Weight: 1}, {URL: "https://www.example.com/b", Weight: 1}},
+	}
+	for _, variants := range invalid {
+		_, err := service.CreateShortURL(&models.ShortenRequest{URL: "https://www.example.com", Variants: variants})
+		assert.Equal(t, ErrInvalidVariants, err, variants)
+	}
+
+	// 版本的目标地址取代模板，两者不能同时使用
+	_, err = service.CreateShortURL(&models.ShortenRequest{
+		URL:      "https://www.example.com/{page}",
+		Template: true,
+		Variants: []models.Variant{{URL: "https://www.example.com/a", Weight: 1}, {URL: "https://www.example.com/b", Weight: 1}},
+	})
+	assert.Equal(t, ErrInvalidVariants, err)
+}
+
+func TestURLService_VariantsWithRules(t *testing.T) {
+	service := NewURLService(storage.NewMemoryStorage(), &config.Config{
+		BaseURL:          "http://localhost:8080",
+		PasswordHashCost: 4,
+	})
+
+	response, err := service.CreateShortURL(&models.ShortenRequest{
+		URL:      "https://www.example.com",
+		Rules:    []models.RedirectRule{{OS: "ios", URL: "https://apps.apple.com/app/id1"}},
+		Variants: []models.Variant{{URL: "https://www.example.com/a", Weight: 1}, {URL: "https://www.example.com/b", Weight: 1}},
+		Password: "secret",
+	})
+	require.NoError(t, err)
+
+	// 匹配的规则优先，不计入任何版本
+	redirect, err := service.ResolveRedirect(response.ShortCode, "", &Visit{UserAgent: iPhoneUA, Variant: "a"})
+	assert.Equal(t, ErrPasswordRequired, err)
+	assert.Nil(t, redirect)
+
+	token, _, err := service.Unlock(response.ShortCode, "secret")
+	require.NoError(t, err)
+	redirect, err = service.ResolveRedirect(response.ShortCode, token, &Visit{UserAgent: iPhoneUA, Variant: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://apps.apple.com/app/id1", redirect.URL)
+	assert.Empty(t, redirect.Variant)
+	assert.Equal(t, "User-Agent, Accept-Language, Cookie", redirect.Vary)
+
+	redirect, err = service.ResolveRedirect(response.ShortCode, token, &Visit{UserAgent: desktopUA, Variant: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/a", redirect.URL)
+
+	// 密码保护的链接不透露版本的目标地址
+	info, err := service.GetURLInfo(response.ShortCode)
+	require.NoError(t, err)
+	require.Len(t, info.Variants, 2)
+	assert.Empty(t, info.Variants[0].URL)
+	assert.Equal(t, uint64(1), info.Variants[0].Clicks)
+	assert.Equal(t, uint64(0), info.Variants[1].Clicks)
+}
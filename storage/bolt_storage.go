@@ -0,0 +1,546 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gin-url-shortener/models"
+)
+
+// bbolt 中使用的 bucket
+var (
+	boltURLsBucket      = []byte("urls")      // shortCode -> URL 记录（JSON），其 Sequence 作为 ID 序列
+	boltIDsBucket       = []byte("ids")       // id -> shortCode
+	boltOriginalsBucket = []byte("originals") // originalURL -> shortCode (用于去重，只含普通链接)
+	boltExpiryBucket    = []byte("expiry")    // 清理时间 + shortCode -> 空值，按过期或清除时间排序
+	boltRevisionsBucket = []byte("revisions") // shortCode -> 子 bucket（版本号 -> 历史版本 JSON），子 bucket 的 Sequence 为最新版本号
+	boltDeletedBucket   = []byte("deleted")   // 已删除的 shortCode -> 删除原因，这些短码不会再次分配
+)
+
+// BoltStorage 基于 bbolt 单文件键值库的持久化存储实现
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage 打开（或创建）bbolt 数据文件
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create database directory: %w", err)
+		}
+	}
+
+	// bbolt 通过文件锁保证单进程独占，设置超时避免另一个实例持有锁时无限等待
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltURLsBucket, boltIDsBucket, boltOriginalsBucket, boltExpiryBucket, boltRevisionsBucket, boltDeletedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create buckets: %w", err)
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+// NextID 从 urls bucket 的持久化序列号分配 ID，从 1 开始递增
+func (s *BoltStorage) NextID() (uint64, error) {
+	var id uint64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		id, err = tx.Bucket(boltURLsBucket).NextSequence()
+		return err
+	})
+	return id, err
+}
+
+// Save 保存 URL 记录
+func (s *BoltStorage) Save(url *models.URL) (*models.URL, error) {
+	saved := url
+
+	// bbolt 同一时刻只有一个写事务，去重检查、短码检查与写入天然是原子的
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+		originals := tx.Bucket(boltOriginalsBucket)
+
+		// 检查是否已存在相同的原始 URL，别名等带额外设置的链接不参与去重
+		if url.Deduplicable() {
+			if shortCode := originals.Get([]byte(url.OriginalURL)); shortCode != nil {
+				existingURL, err := getBoltURL(urls, shortCode)
+				if err != nil {
+					return err
+				}
+				saved = existingURL
+				return nil
+			}
+		}
+
+		if urls.Get([]byte(url.ShortCode)) != nil || tx.Bucket(boltDeletedBucket).Get([]byte(url.ShortCode)) != nil {
+			return ErrCodeExists
+		}
+
+		if err := putBoltURL(urls, url); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltIDsBucket).Put(boltID(url.ID), []byte(url.ShortCode)); err != nil {
+			return err
+		}
+		if url.ReapAt() != nil {
+			if err := tx.Bucket(boltExpiryBucket).Put(boltExpiryKey(url), nil); err != nil {
+				return err
+			}
+		}
+		if !url.Deduplicable() {
+			return nil
+		}
+		return originals.Put([]byte(url.OriginalURL), []byte(url.ShortCode))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// GetByShortCode 根据短码获取 URL 记录
+func (s *BoltStorage) GetByShortCode(shortCode string) (*models.URL, error) {
+	var url *models.URL
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		url, err = getBoltURL(tx.Bucket(boltURLsBucket), []byte(shortCode))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// GetByOriginalURL 根据原始 URL 获取 URL 记录
+func (s *BoltStorage) GetByOriginalURL(originalURL string) (*models.URL, error) {
+	var url *models.URL
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		shortCode := tx.Bucket(boltOriginalsBucket).Get([]byte(originalURL))
+		if shortCode == nil {
+			return ErrURLNotFound
+		}
+
+		var err error
+		url, err = getBoltURL(tx.Bucket(boltURLsBucket), shortCode)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// GetByID 根据 ID 获取 URL 记录
+func (s *BoltStorage) GetByID(id uint64) (*models.URL, error) {
+	var url *models.URL
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		shortCode := tx.Bucket(boltIDsBucket).Get(boltID(id))
+		if shortCode == nil {
+			return ErrURLNotFound
+		}
+
+		var err error
+		url, err = getBoltURL(tx.Bucket(boltURLsBucket), shortCode)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// IncrementAccessCount 在写事务中读取、修改并写回记录
+func (s *BoltStorage) IncrementAccessCount(shortCode string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+
+		url, err := getBoltURL(urls, []byte(shortCode))
+		if err != nil {
+			return err
+		}
+
+		if url.AddAccessCountWithin(1) == 0 {
+			return ErrClickLimitReached
+		}
+		return putBoltURL(urls, url)
+	})
+}
+
+// AddAccessCounts 在一个写事务中批量累加访问计数
+func (s *BoltStorage) AddAccessCounts(counts map[string]uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+
+		for shortCode, delta := range counts {
+			url, err := getBoltURL(urls, []byte(shortCode))
+			if errors.Is(err, ErrURLNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if url.AddAccessCountWithin(delta) == 0 {
+				continue
+			}
+			if err := putBoltURL(urls, url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// AddVariantClicks 在一个事务中批量累加各版本的访问次数
+func (s *BoltStorage) AddVariantClicks(counts map[string]map[string]uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+
+		for shortCode, variants := range counts {
+			url, err := getBoltURL(urls, []byte(shortCode))
+			if errors.Is(err, ErrURLNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			changed := false
+			for name, delta := range variants {
+				if delta > 0 && url.AddVariantClicks(name, delta) {
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+			if err := putBoltURL(urls, url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetStats 获取存储统计信息
+func (s *BoltStorage) GetStats() (map[string]interface{}, error) {
+	var stats map[string]interface{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+
+		// 回收站和禁用的数量需要遍历记录
+		var trashed, disabled int
+		err := urls.ForEach(func(shortCode, _ []byte) error {
+			url, err := getBoltURL(urls, shortCode)
+			if err != nil {
+				return err
+			}
+			if url.DeletedAt != nil {
+				trashed++
+			}
+			if url.DisabledAt != nil {
+				disabled++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		stats = map[string]interface{}{
+			"total_urls":    urls.Stats().KeyN,
+			"trashed_urls":  trashed,
+			"disabled_urls": disabled,
+			"deleted_codes": tx.Bucket(boltDeletedBucket).Stats().KeyN,
+			"next_id":       urls.Sequence() + 1,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetAllURLs 获取所有 URL 记录，按 ID 排序
+func (s *BoltStorage) GetAllURLs() ([]*models.URL, error) {
+	urls := make([]*models.URL, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(boltURLsBucket)
+
+		// ids bucket 的键是大端序 ID，遍历顺序即 ID 顺序
+		return tx.Bucket(boltIDsBucket).ForEach(func(_, shortCode []byte) error {
+			url, err := getBoltURL(records, shortCode)
+			if err != nil {
+				return err
+			}
+			urls = append(urls, url)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// Update 在一个写事务中替换记录、调整索引并追加修改历史
+func (s *BoltStorage) Update(url *models.URL, revisions ...*models.Revision) (*models.URL, error) {
+	var updated *models.URL
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+		current, err := getBoltURL(urls, []byte(url.ShortCode))
+		if err != nil {
+			return err
+		}
+
+		history, err := tx.Bucket(boltRevisionsBucket).CreateBucketIfNotExists([]byte(url.ShortCode))
+		if err != nil {
+			return err
+		}
+		if !nextRevisions(int(history.Sequence()), revisions) {
+			return ErrRevisionConflict
+		}
+		for _, revision := range revisions {
+			data, err := json.Marshal(revision)
+			if err != nil {
+				return err
+			}
+			if err := history.Put(boltID(uint64(revision.Number)), data); err != nil {
+				return err
+			}
+			if err := history.SetSequence(uint64(revision.Number)); err != nil {
+				return err
+			}
+		}
+
+		updated = url.Clone()
+		updated.ID = current.ID
+		updated.CreatedAt = current.CreatedAt
+		updated.Custom = current.Custom
+		updated.AccessCount = current.AccessCount
+		updated.CopyVariantClicks(current)
+		if err := putBoltURL(urls, updated); err != nil {
+			return err
+		}
+
+		expiry := tx.Bucket(boltExpiryBucket)
+		if current.ReapAt() != nil {
+			if err := expiry.Delete(boltExpiryKey(current)); err != nil {
+				return err
+			}
+		}
+		if updated.ReapAt() != nil {
+			if err := expiry.Put(boltExpiryKey(updated), nil); err != nil {
+				return err
+			}
+		}
+
+		// 修改过的记录离开去重索引
+		originals := tx.Bucket(boltOriginalsBucket)
+		if string(originals.Get([]byte(current.OriginalURL))) == url.ShortCode {
+			return originals.Delete([]byte(current.OriginalURL))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// GetRevisions 按版本号顺序读取修改历史
+func (s *BoltStorage) GetRevisions(shortCode string) ([]*models.Revision, error) {
+	revisions := make([]*models.Revision, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		history := tx.Bucket(boltRevisionsBucket).Bucket([]byte(shortCode))
+		if history == nil {
+			return nil
+		}
+
+		return history.ForEach(func(_, data []byte) error {
+			var revision models.Revision
+			if err := json.Unmarshal(data, &revision); err != nil {
+				return fmt.Errorf("decode revision of %q: %w", shortCode, err)
+			}
+			revisions = append(revisions, &revision)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Delete 删除 URL 记录及其索引和修改历史，并记下短码
+func (s *BoltStorage) Delete(shortCode string) error {
+	return s.delete(shortCode, time.Time{})
+}
+
+// DeleteIfDue 在同一个写事务中确认记录仍然需要清理后删除
+func (s *BoltStorage) DeleteIfDue(shortCode string, before time.Time) error {
+	return s.delete(shortCode, before)
+}
+
+// delete 删除记录，before 不为零值时只删除清理时间早于 before 的记录
+func (s *BoltStorage) delete(shortCode string, before time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		urls := tx.Bucket(boltURLsBucket)
+		url, err := getBoltURL(urls, []byte(shortCode))
+		if err != nil {
+			return err
+		}
+		if !isDue(url, before) {
+			return ErrNotDue
+		}
+
+		if err := urls.Delete([]byte(shortCode)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltIDsBucket).Delete(boltID(url.ID)); err != nil {
+			return err
+		}
+		if url.ReapAt() != nil {
+			if err := tx.Bucket(boltExpiryBucket).Delete(boltExpiryKey(url)); err != nil {
+				return err
+			}
+		}
+		reason := deletionReason(url, deletionTime(before))
+		if err := tx.Bucket(boltDeletedBucket).Put([]byte(shortCode), []byte(reason)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltRevisionsBucket).DeleteBucket([]byte(shortCode)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+
+		// 去重索引只在指向这条记录时才删除
+		originals := tx.Bucket(boltOriginalsBucket)
+		if string(originals.Get([]byte(url.OriginalURL))) == shortCode {
+			return originals.Delete([]byte(url.OriginalURL))
+		}
+		return nil
+	})
+}
+
+// DeletionReason 读取 deleted bucket 中记录的删除原因
+func (s *BoltStorage) DeletionReason(shortCode string) (string, error) {
+	var reason string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltDeletedBucket).Get([]byte(shortCode))
+		if value == nil {
+			return ErrURLNotFound
+		}
+		reason = string(value)
+		return nil
+	})
+	return reason, err
+}
+
+// ListExpired 按清理时间顺序遍历 expiry bucket，返回在 before 之前过期或应被清除的记录
+func (s *BoltStorage) ListExpired(before time.Time, limit int) ([]*models.URL, error) {
+	urls := make([]*models.URL, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltURLsBucket)
+		cursor := tx.Bucket(boltExpiryBucket).Cursor()
+		for key, _ := cursor.First(); key != nil && len(urls) < limit; key, _ = cursor.Next() {
+			if int64(binary.BigEndian.Uint64(key[:8])) >= before.UnixNano() {
+				break
+			}
+
+			url, err := getBoltURL(bucket, key[8:])
+			if err != nil {
+				return err
+			}
+			urls = append(urls, url)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// Close 关闭数据文件
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// getBoltURL 读取并解码一条记录
+func getBoltURL(bucket *bolt.Bucket, shortCode []byte) (*models.URL, error) {
+	data := bucket.Get(shortCode)
+	if data == nil {
+		return nil, ErrURLNotFound
+	}
+
+	var url models.URL
+	if err := json.Unmarshal(data, &url); err != nil {
+		return nil, fmt.Errorf("decode record %q: %w", shortCode, err)
+	}
+
+	return &url, nil
+}
+
+// putBoltURL 编码并写入一条记录
+func putBoltURL(bucket *bolt.Bucket, url *models.URL) error {
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put([]byte(url.ShortCode), data)
+}
+
+// boltID 将 ID 编码为 8 字节大端序，保证键的字典序与数值顺序一致
+func boltID(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// boltExpiryKey 过期索引的键：8 字节大端序的清理时间（Unix 纳秒）加短码
+func boltExpiryKey(url *models.URL) []byte {
+	key := make([]byte, 8, 8+len(url.ShortCode))
+	binary.BigEndian.PutUint64(key, uint64(url.ReapAt().UnixNano()))
+	return append(key, url.ShortCode...)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStorage(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		store, err := NewBoltStorage(filepath.Join(t.TempDir(), "test.bolt"))
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestBoltStorage_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "test.bolt")
+
+	store, err := NewBoltStorage(path)
+	require.NoError(t, err)
+	saved, err := saveURL(store, "https://www.example.com")
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(saved.ShortCode))
+	require.NoError(t, store.Close())
+
+	store, err = NewBoltStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	record, err := store.GetByID(saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, saved.ShortCode, record.ShortCode)
+	assert.Equal(t, uint64(1), record.AccessCount)
+
+	// 持久化的序列号在重启后继续递增
+	next, err := saveURL(store, "https://www.example.com/next")
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID+1, next.ID)
+
+	again, err := saveURL(store, "https://www.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID, again.ID)
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/utils"
+)
+
+// cacheGenerationStripes 缓存版本号的分段数，必须是 2 的幂
+const cacheGenerationStripes = 256
+
+// CacheConfig 读缓存配置
+type CacheConfig struct {
+	Size        int           // 最多缓存的短码数量
+	TTL         time.Duration // 命中记录的有效期，0 表示不过期
+	NegativeTTL time.Duration // 不存在的短码的缓存有效期，0 表示不缓存
+}
+
+// InvalidationBus 在共用同一后端的多个实例之间广播缓存失效
+type InvalidationBus interface {
+	// PublishInvalidation 通知所有实例（包括自己）短码的记录已修改
+	PublishInvalidation(shortCode string) error
+
+	// SubscribeInvalidations 开始接收失效通知，返回的函数用于取消订阅。
+	// 每次（重新）订阅成功后以空短码调用 handler，表示断线期间可能漏掉了通知，所有缓存都应失效
+	SubscribeInvalidations(handler func(shortCode string)) (unsubscribe func())
+}
+
+// CachedStore 为任意 Store 加上一层进程内读缓存。
+// 按短码缓存记录的副本；不存在的短码也会短暂缓存，避免扫描式请求打穿到后端；
+// 同一短码的并发未命中只会查询一次后端。
+// 底层存储实现了 InvalidationBus 时（如 Redis），修改和删除会通知共用后端的其他实例失效缓存；
+// 否则缓存只在本进程内失效，其他进程最多在 TTL 内读到旧记录。
+// 访问计数只同步到本进程的缓存，不会通知其他实例，其他实例缓存中的访问次数最多在 TTL 内偏低。
+type CachedStore struct {
+	inner       Store
+	config      CacheConfig
+	cache       *utils.LRU[string, *models.URL] // 值为 nil 表示短码不存在
+	group       singleflight.Group
+	bus         InvalidationBus // 为 nil 时不与其他实例同步
+	unsubscribe func()
+
+	// generations 按短码哈希分段的版本号，修改未缓存的记录或失效缓存时递增对应分段。
+	// 加载前后版本号不一致说明期间同一分段发生过写入，加载结果可能已过时，不再写入缓存；
+	// 其他短码的写入不会让进行中的加载作废
+	generations [cacheGenerationStripes]uint64
+
+	hits          uint64
+	negativeHits  uint64
+	misses        uint64
+	invalidations uint64 // 收到的失效通知数
+}
+
+// NewCachedStore 创建带读缓存的存储，底层存储实现了 InvalidationBus 时订阅其他实例的失效通知
+func NewCachedStore(inner Store, config CacheConfig) *CachedStore {
+	store := &CachedStore{
+		inner:  inner,
+		config: config,
+		cache:  utils.NewLRU[string, *models.URL](config.Size),
+	}
+
+	if bus, ok := inner.(InvalidationBus); ok {
+		store.bus = bus
+		store.unsubscribe = bus.SubscribeInvalidations(store.handleInvalidation)
+	}
+
+	return store
+}
+
+// NextID 分配新的 ID
+func (s *CachedStore) NextID() (uint64, error) {
+	return s.inner.NextID()
+}
+
+// Save 保存 URL 记录，并把结果写入缓存（覆盖可能存在的“不存在”记录）
+func (s *CachedStore) Save(url *models.URL) (*models.URL, error) {
+	saved, err := s.inner.Save(url)
+	if err != nil {
+		return nil, err
+	}
+
+	s.bump(saved.ShortCode)
+	s.cache.Add(saved.ShortCode, saved.Clone(), s.config.TTL)
+	// 其他实例可能缓存了这个短码不存在
+	s.publish(saved.ShortCode)
+
+	return saved, nil
+}
+
+// GetByShortCode 优先从缓存读取，未命中时合并并发请求后查询底层存储
+func (s *CachedStore) GetByShortCode(shortCode string) (*models.URL, error) {
+	if url, ok := s.cache.Get(shortCode); ok {
+		if url == nil {
+			atomic.AddUint64(&s.negativeHits, 1)
+			return nil, ErrURLNotFound
+		}
+		atomic.AddUint64(&s.hits, 1)
+		return url.Clone(), nil
+	}
+
+	atomic.AddUint64(&s.misses, 1)
+
+	value, err, _ := s.group.Do(shortCode, func() (interface{}, error) {
+		generation := atomic.LoadUint64(s.generation(shortCode))
+
+		url, err := s.inner.GetByShortCode(shortCode)
+		if err != nil && !errors.Is(err, ErrURLNotFound) {
+			return nil, err
+		}
+
+		if atomic.LoadUint64(s.generation(shortCode)) == generation {
+			if url != nil {
+				s.cache.Add(shortCode, url.Clone(), s.config.TTL)
+			} else if s.config.NegativeTTL > 0 {
+				s.cache.Add(shortCode, nil, s.config.NegativeTTL)
+			}
+		}
+
+		return url, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一次加载的结果会返回给多个调用方，各自拿一份副本
+	return value.(*models.URL).Clone(), nil
+}
+
+// GetByOriginalURL 根据原始 URL 获取 URL 记录，不经过缓存
+func (s *CachedStore) GetByOriginalURL(originalURL string) (*models.URL, error) {
+	return s.inner.GetByOriginalURL(originalURL)
+}
+
+// GetByID 根据 ID 获取 URL 记录，不经过缓存
+func (s *CachedStore) GetByID(id uint64) (*models.URL, error) {
+	return s.inner.GetByID(id)
+}
+
+// IncrementAccessCount 增加访问计数，成功后同步更新缓存中的计数
+func (s *CachedStore) IncrementAccessCount(shortCode string) error {
+	if err := s.inner.IncrementAccessCount(shortCode); err != nil {
+		return err
+	}
+
+	s.addCachedCount(shortCode, 1)
+	return nil
+}
+
+// AddAccessCounts 批量累加访问计数，成功后同步更新缓存中的计数
+func (s *CachedStore) AddAccessCounts(counts map[string]uint64) error {
+	if err := s.inner.AddAccessCounts(counts); err != nil {
+		// 不知道哪些短码已经写入，让正在加载和已缓存的计数都失效
+		var partial *PartialCountError
+		if errors.As(err, &partial) {
+			for shortCode := range counts {
+				s.Invalidate(shortCode)
+			}
+		}
+		return err
+	}
+
+	for shortCode, delta := range counts {
+		s.addCachedCount(shortCode, delta)
+	}
+	return nil
+}
+
+// AddVariantClicks 批量累加各版本的访问次数，成功后同步更新缓存中的计数
+func (s *CachedStore) AddVariantClicks(counts map[string]map[string]uint64) error {
+	if err := s.inner.AddVariantClicks(counts); err != nil {
+		return err
+	}
+
+	for shortCode, variants := range counts {
+		url, ok := s.cache.Get(shortCode)
+		if !ok || url == nil {
+			s.bump(shortCode)
+			continue
+		}
+		for name, delta := range variants {
+			url.AddVariantClicks(name, delta)
+		}
+	}
+	return nil
+}
+
+// Update 修改 URL 记录并失效缓存，下次读取时重新加载
+func (s *CachedStore) Update(url *models.URL, revisions ...*models.Revision) (*models.URL, error) {
+	s.Invalidate(url.ShortCode)
+	defer s.Invalidate(url.ShortCode)
+
+	updated, err := s.inner.Update(url, revisions...)
+	if err == nil {
+		s.publish(url.ShortCode)
+	}
+	return updated, err
+}
+
+// GetRevisions 直接查询底层存储
+func (s *CachedStore) GetRevisions(shortCode string) ([]*models.Revision, error) {
+	return s.inner.GetRevisions(shortCode)
+}
+
+// Delete 删除 URL 记录并失效缓存
+func (s *CachedStore) Delete(shortCode string) error {
+	// 删除前后各失效一次：之前的避免删除期间读到旧记录，之后的清掉删除期间被加载进来的记录
+	s.Invalidate(shortCode)
+	defer s.Invalidate(shortCode)
+
+	if err := s.inner.Delete(shortCode); err != nil {
+		return err
+	}
+	s.publish(shortCode)
+	return nil
+}
+
+// DeleteIfDue 按条件删除 URL 记录并失效缓存
+func (s *CachedStore) DeleteIfDue(shortCode string, before time.Time) error {
+	s.Invalidate(shortCode)
+	defer s.Invalidate(shortCode)
+
+	if err := s.inner.DeleteIfDue(shortCode, before); err != nil {
+		return err
+	}
+	s.publish(shortCode)
+	return nil
+}
+
+// DeletionReason 直接查询底层存储，已删除的短码不会再出现在缓存中
+func (s *CachedStore) DeletionReason(shortCode string) (string, error) {
+	return s.inner.DeletionReason(shortCode)
+}
+
+// ListExpired 直接查询底层存储
+func (s *CachedStore) ListExpired(before time.Time, limit int) ([]*models.URL, error) {
+	return s.inner.ListExpired(before, limit)
+}
+
+// Invalidate 使短码的缓存失效，底层记录被其他途径修改后调用
+func (s *CachedStore) Invalidate(shortCode string) {
+	s.bump(shortCode)
+	s.cache.Remove(shortCode)
+}
+
+// handleInvalidation 处理其他实例的失效通知，空短码表示清空整个缓存
+func (s *CachedStore) handleInvalidation(shortCode string) {
+	atomic.AddUint64(&s.invalidations, 1)
+	if shortCode == "" {
+		for i := range s.generations {
+			atomic.AddUint64(&s.generations[i], 1)
+		}
+		s.cache.Purge()
+		return
+	}
+	s.Invalidate(shortCode)
+}
+
+// publish 通知其他实例失效短码的缓存，失败时其他实例最多在 TTL 内读到旧记录
+func (s *CachedStore) publish(shortCode string) {
+	if s.bus == nil {
+		return
+	}
+	if err := s.bus.PublishInvalidation(shortCode); err != nil {
+		log.Printf("cache: failed to publish invalidation for %s: %v", shortCode, err)
+	}
+}
+
+// GetStats 获取存储统计信息，附带缓存命中情况
+func (s *CachedStore) GetStats() (map[string]interface{}, error) {
+	stats, err := s.inner.GetStats()
+	if err != nil {
+		return nil, err
+	}
+
+	stats["cache"] = map[string]interface{}{
+		"hits":          atomic.LoadUint64(&s.hits),
+		"negative_hits": atomic.LoadUint64(&s.negativeHits),
+		"misses":        atomic.LoadUint64(&s.misses),
+		"size":          s.cache.Len(),
+		"capacity":      s.cache.Capacity(),
+		"invalidations": atomic.LoadUint64(&s.invalidations),
+	}
+
+	return stats, nil
+}
+
+// GetAllURLs 获取所有 URL 记录，不经过缓存
+func (s *CachedStore) GetAllURLs() ([]*models.URL, error) {
+	return s.inner.GetAllURLs()
+}
+
+// Close 取消失效通知的订阅并关闭底层存储
+func (s *CachedStore) Close() error {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+	return s.inner.Close()
+}
+
+// addCachedCount 累加缓存中记录的访问计数；记录不在缓存中时让进行中的加载作废
+func (s *CachedStore) addCachedCount(shortCode string, delta uint64) {
+	if url, ok := s.cache.Get(shortCode); ok && url != nil {
+		url.AddAccessCountWithin(delta)
+		return
+	}
+
+	s.bump(shortCode)
+}
+
+// generation 返回短码所在分段的版本号
+func (s *CachedStore) generation(shortCode string) *uint64 {
+	return &s.generations[hashString(shortCode)&(cacheGenerationStripes-1)]
+}
+
+// bump 让短码（以及同一分段的其他短码）进行中的加载作废
+func (s *CachedStore) bump(shortCode string) {
+	atomic.AddUint64(s.generation(shortCode), 1)
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/utils"
+)
+
+// countingStore 统计 GetByShortCode 调用次数，并可让查询阻塞以模拟慢后端
+type countingStore struct {
+	*MemoryStorage
+	lookups uint64
+	release chan struct{}
+}
+
+func (s *countingStore) GetByShortCode(shortCode string) (*models.URL, error) {
+	atomic.AddUint64(&s.lookups, 1)
+	if s.release != nil {
+		<-s.release
+	}
+	return s.MemoryStorage.GetByShortCode(shortCode)
+}
+
+func newTestCachedStore(inner Store) *CachedStore {
+	return NewCachedStore(inner, CacheConfig{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute})
+}
+
+func TestCachedStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return newTestCachedStore(NewMemoryStorage())
+	})
+}
+
+func TestCachedStore_HitsAndNegativeCaching(t *testing.T) {
+	inner := &countingStore{MemoryStorage: NewMemoryStorage()}
+	store := newTestCachedStore(inner)
+
+	saved, err := saveURL(store, "https://www.example.com")
+	require.NoError(t, err)
+
+	// Save 已经写入缓存，读取不再访问后端
+	for i := 0; i < 3; i++ {
+		url, err := store.GetByShortCode(saved.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, saved.OriginalURL, url.OriginalURL)
+	}
+
+	// 不存在的短码只查询一次后端
+	for i := 0; i < 3; i++ {
+		_, err := store.GetByShortCode("missing")
+		assert.Equal(t, ErrURLNotFound, err)
+	}
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&inner.lookups))
+
+	stats, err := store.GetStats()
+	require.NoError(t, err)
+	cacheStats := stats["cache"].(map[string]interface{})
+	assert.Equal(t, uint64(3), cacheStats["hits"])
+	assert.Equal(t, uint64(2), cacheStats["negative_hits"])
+	assert.Equal(t, uint64(1), cacheStats["misses"])
+}
+
+func TestCachedStore_CollapsesConcurrentMisses(t *testing.T) {
+	inner := &countingStore{MemoryStorage: NewMemoryStorage(), release: make(chan struct{})}
+	saved, err := saveURL(inner, "https://www.example.com")
+	require.NoError(t, err)
+
+	store := newTestCachedStore(inner)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			url, err := store.GetByShortCode(saved.ShortCode)
+			assert.NoError(t, err)
+			assert.Equal(t, saved.OriginalURL, url.OriginalURL)
+		}()
+	}
+
+	// 等第一个请求进入后端后再放行，其余请求应等待同一次查询的结果
+	require.Eventually(t, func() bool { return atomic.LoadUint64(&inner.lookups) > 0 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&inner.lookups))
+}
+
+func TestCachedStore_WritesOnlyCancelSameCode(t *testing.T) {
+	inner := &countingStore{MemoryStorage: NewMemoryStorage()}
+	loading, err := saveURL(inner, "https://www.example.com/a")
+	require.NoError(t, err)
+	clicked, err := saveURL(inner, "https://www.example.com/b")
+	require.NoError(t, err)
+
+	store := newTestCachedStore(inner)
+	require.NotSame(t, store.generation(loading.ShortCode), store.generation(clicked.ShortCode))
+
+	// 加载期间其他短码的点击不会让这次加载作废
+	inner.release = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := store.GetByShortCode(loading.ShortCode)
+		assert.NoError(t, err)
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadUint64(&inner.lookups) > 0 }, time.Second, time.Millisecond)
+	require.NoError(t, store.AddAccessCounts(map[string]uint64{clicked.ShortCode: 1}))
+	close(inner.release)
+	<-done
+
+	_, err = store.GetByShortCode(loading.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&inner.lookups))
+
+	// 同一短码的点击让进行中的加载作废，下次读取重新加载
+	inner.release = make(chan struct{})
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := store.GetByShortCode(clicked.ShortCode)
+		assert.NoError(t, err)
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadUint64(&inner.lookups) > 1 }, time.Second, time.Millisecond)
+	require.NoError(t, store.AddAccessCounts(map[string]uint64{clicked.ShortCode: 1}))
+	close(inner.release)
+	<-done
+
+	url, err := store.GetByShortCode(clicked.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), url.AccessCount)
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&inner.lookups))
+}
+
+func TestCachedStore_Invalidation(t *testing.T) {
+	inner := NewMemoryStorage()
+	store := newTestCachedStore(inner)
+
+	saved, err := saveURL(store, "https://www.example.com")
+	require.NoError(t, err)
+
+	// 访问计数同步到缓存中的记录
+	require.NoError(t, store.AddAccessCounts(map[string]uint64{saved.ShortCode: 2}))
+	url, err := store.GetByShortCode(saved.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), url.AccessCount)
+
+	// 返回的是副本，调用方修改不影响缓存
+	url.OriginalURL = "https://www.changed.com"
+	url, err = store.GetByShortCode(saved.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, saved.OriginalURL, url.OriginalURL)
+
+	// 删除后不再命中缓存
+	require.NoError(t, store.Delete(saved.ShortCode))
+	_, err = store.GetByShortCode(saved.ShortCode)
+	assert.Equal(t, ErrURLNotFound, err)
+
+	// 重新保存覆盖“不存在”的缓存记录
+	nextCode := utils.EncodeBase62(saved.ID + 1)
+	_, err = store.GetByShortCode(nextCode)
+	require.Equal(t, ErrURLNotFound, err)
+	again, err := saveURL(store, "https://www.example.com")
+	require.NoError(t, err)
+	url, err = store.GetByShortCode(again.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, nextCode, again.ShortCode)
+	assert.Equal(t, again.ID, url.ID)
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"gin-url-shortener/models"
+)
+
+// expiryIndex 内存存储的过期索引：按清理时间（过期时间和回收站清除时间中较早者）排序的最小堆，
+// 只包含需要清理的记录。删除或替换记录时不修改堆，取出时再核对记录是否仍在存储中。
+type expiryIndex struct {
+	mutex sync.Mutex
+	items expiryHeap
+}
+
+// add 加入一条需要清理的记录
+func (x *expiryIndex) add(url *models.URL) {
+	if url.ReapAt() == nil {
+		return
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	heap.Push(&x.items, url)
+}
+
+// due 按清理时间顺序返回最多 limit 条在 before 之前到期、且 alive 返回 true 的记录。
+// 返回的记录仍保留在索引中，直到被删除后再次被取到时才清理。
+func (x *expiryIndex) due(before time.Time, limit int, alive func(url *models.URL) bool) []*models.URL {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	var urls []*models.URL
+	for len(urls) < limit && x.items.Len() > 0 && x.items[0].ReapAt().Before(before) {
+		url := heap.Pop(&x.items).(*models.URL)
+		if alive(url) {
+			urls = append(urls, url)
+		}
+	}
+
+	for _, url := range urls {
+		heap.Push(&x.items, url)
+	}
+
+	return urls
+}
+
+// expiryHeap 实现 heap.Interface
+type expiryHeap []*models.URL
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].ReapAt().Before(*h[j].ReapAt()) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *expiryHeap) Push(x interface{}) {
+	*h = append(*h, x.(*models.URL))
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	url := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return url
+}
@@ -0,0 +1,526 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gin-url-shortener/models"
+)
+
+// SyncPolicy 日志刷盘策略
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // 每次写入后 fsync，最安全也最慢
+	SyncInterval SyncPolicy = "interval" // 按固定间隔批量 fsync
+	SyncNever    SyncPolicy = "never"    // 从不主动 fsync，交给操作系统
+)
+
+// JournalConfig 内存存储持久化配置
+type JournalConfig struct {
+	Dir              string        // 日志与快照所在目录
+	SyncPolicy       SyncPolicy    // 刷盘策略
+	SyncInterval     time.Duration // SyncInterval 策略下的刷盘间隔
+	SnapshotInterval time.Duration // 定期压缩快照的间隔，0 表示只在关闭时生成快照
+}
+
+const (
+	snapshotFileName = "snapshot.json"
+	journalPrefix    = "journal-"
+	journalSuffix    = ".log"
+
+	// 每条记录的头部：4 字节长度 + 4 字节 CRC32
+	recordHeaderSize = 8
+	// 单条记录的长度上限，超过视为损坏
+	maxRecordSize = 1 << 20
+)
+
+// 日志操作类型
+const (
+	opSave      = "save"
+	opIncrement = "incr"
+	opDelete    = "delete"
+	opUpdate    = "update"
+	opVariant   = "variant"
+)
+
+// journalEntry 一条日志记录
+type journalEntry struct {
+	Op        string      `json:"op"`
+	URL       *models.URL `json:"url,omitempty"`
+	ShortCode string      `json:"short_code,omitempty"`
+	Delta     uint64      `json:"delta,omitempty"`   // 计数增量，为 0 时表示 1
+	Variant   string      `json:"variant,omitempty"` // variant 累加访问次数的版本名
+	Reason    string      `json:"reason,omitempty"`  // delete 的删除原因
+
+	Revisions []*models.Revision `json:"revisions,omitempty"` // update 追加的修改历史
+}
+
+// snapshot 某一时刻内存存储的完整状态
+type snapshot struct {
+	Generation uint64        `json:"generation"`
+	NextID     uint64        `json:"next_id"`
+	URLs       []*models.URL `json:"urls"`
+
+	Revisions map[string][]*models.Revision `json:"revisions,omitempty"` // shortCode -> 修改历史
+	Deleted   []string                      `json:"deleted,omitempty"`   // 已删除的短码
+
+	DeletionReasons map[string]string `json:"deletion_reasons,omitempty"` // 已删除短码 -> 删除原因
+}
+
+// journal 追加写日志。每次压缩都会切换到新一代日志文件 journal-<generation>.log，
+// snapshot.json 记录它包含了哪一代之前的全部数据，启动时从快照加上之后各代日志恢复。
+type journal struct {
+	config     JournalConfig
+	mutex      sync.Mutex
+	file       *os.File
+	generation uint64
+	dirty      bool // 自上次 fsync 以来是否有新的写入
+
+	compactMutex sync.Mutex // 串行化快照写入
+	compactedGen uint64     // 已写入快照的最新代数
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+}
+
+// openJournal 读取快照并回放日志，返回恢复出的状态和可继续写入的日志
+func openJournal(config JournalConfig) (*journal, *snapshot, error) {
+	switch config.SyncPolicy {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, nil, fmt.Errorf("unknown journal sync policy: %q", config.SyncPolicy)
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("create journal directory: %w", err)
+	}
+
+	state, err := readSnapshot(filepath.Join(config.Dir, snapshotFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	generations, err := listJournalGenerations(config.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 回放快照之后的各代日志，早于快照的日志已被压缩，可以删除
+	entries := make([]journalEntry, 0)
+	for _, gen := range generations {
+		path := journalPath(config.Dir, gen)
+		if gen < state.Generation {
+			os.Remove(path)
+			continue
+		}
+
+		genEntries, err := readJournal(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, genEntries...)
+	}
+	applyEntries(state, entries)
+
+	// 新的写入追加到最新一代日志中
+	generation := state.Generation
+	if len(generations) > 0 && generations[len(generations)-1] > generation {
+		generation = generations[len(generations)-1]
+	}
+
+	file, err := os.OpenFile(journalPath(config.Dir, generation), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open journal: %w", err)
+	}
+
+	j := &journal{
+		config:       config,
+		file:         file,
+		generation:   generation,
+		compactedGen: state.Generation,
+		stop:         make(chan struct{}),
+	}
+
+	return j, state, nil
+}
+
+// append 追加一条日志记录，SyncAlways 策略下写入后立即刷盘
+func (j *journal) append(entry journalEntry) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if _, err := j.file.Write(record); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	if j.config.SyncPolicy == SyncAlways {
+		return j.file.Sync()
+	}
+	j.dirty = true
+
+	return nil
+}
+
+// sync 将尚未刷盘的写入同步到磁盘
+func (j *journal) sync() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if !j.dirty {
+		return nil
+	}
+	j.dirty = false
+
+	return j.file.Sync()
+}
+
+// rotate 切换到新一代日志文件，返回新的代数。
+// 调用方需要保证切换期间没有并发写入，以便与快照内容保持一致。
+func (j *journal) rotate() (uint64, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	next := j.generation + 1
+	file, err := os.OpenFile(journalPath(j.config.Dir, next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("open journal: %w", err)
+	}
+
+	// 旧日志在快照写入成功前仍需保留，这里只保证已写内容落盘
+	if j.config.SyncPolicy != SyncNever {
+		j.file.Sync()
+	}
+	j.file.Close()
+
+	j.file = file
+	j.generation = next
+	j.dirty = false
+
+	return next, nil
+}
+
+// compact 写入快照并删除已被快照覆盖的旧日志
+func (j *journal) compact(state *snapshot) error {
+	j.compactMutex.Lock()
+	defer j.compactMutex.Unlock()
+
+	// 并发压缩时不能让较旧的状态覆盖较新的快照
+	if state.Generation <= j.compactedGen {
+		return nil
+	}
+
+	if err := writeSnapshot(filepath.Join(j.config.Dir, snapshotFileName), state); err != nil {
+		return err
+	}
+
+	generations, err := listJournalGenerations(j.config.Dir)
+	if err != nil {
+		return err
+	}
+	for _, gen := range generations {
+		if gen < state.Generation {
+			os.Remove(journalPath(j.config.Dir, gen))
+		}
+	}
+	j.compactedGen = state.Generation
+
+	return nil
+}
+
+// run 启动后台刷盘和定期压缩任务
+func (j *journal) run(takeSnapshot func() error) {
+	if j.config.SyncPolicy == SyncInterval && j.config.SyncInterval > 0 {
+		j.done.Add(1)
+		go j.loop(j.config.SyncInterval, func() {
+			if err := j.sync(); err != nil {
+				log.Printf("journal: sync failed: %v", err)
+			}
+		})
+	}
+
+	if j.config.SnapshotInterval > 0 {
+		j.done.Add(1)
+		go j.loop(j.config.SnapshotInterval, func() {
+			if err := takeSnapshot(); err != nil {
+				log.Printf("journal: snapshot failed: %v", err)
+			}
+		})
+	}
+}
+
+// loop 按固定间隔执行任务，直到日志关闭
+func (j *journal) loop(interval time.Duration, task func()) {
+	defer j.done.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			task()
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// stopBackground 停止后台刷盘和压缩任务
+func (j *journal) stopBackground() {
+	j.stopOnce.Do(func() { close(j.stop) })
+	j.done.Wait()
+}
+
+// close 停止后台任务并关闭日志文件
+func (j *journal) close() error {
+	j.stopBackground()
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.config.SyncPolicy != SyncNever {
+		if err := j.file.Sync(); err != nil {
+			j.file.Close()
+			return err
+		}
+	}
+
+	return j.file.Close()
+}
+
+// applyEntries 将日志记录依次应用到快照状态上
+func applyEntries(state *snapshot, entries []journalEntry) {
+	index := make(map[string]int, len(state.URLs))
+	for i, url := range state.URLs {
+		index[url.ShortCode] = i
+	}
+
+	for _, entry := range entries {
+		switch entry.Op {
+		case opSave:
+			if entry.URL == nil {
+				continue
+			}
+			index[entry.URL.ShortCode] = len(state.URLs)
+			state.URLs = append(state.URLs, entry.URL)
+			if entry.URL.ID >= state.NextID {
+				state.NextID = entry.URL.ID + 1
+			}
+		case opIncrement:
+			if i, ok := index[entry.ShortCode]; ok && state.URLs[i] != nil {
+				delta := entry.Delta
+				if delta == 0 {
+					delta = 1
+				}
+				state.URLs[i].AccessCount += delta
+			}
+		case opVariant:
+			if i, ok := index[entry.ShortCode]; ok && state.URLs[i] != nil {
+				state.URLs[i].AddVariantClicks(entry.Variant, entry.Delta)
+			}
+		case opUpdate:
+			if entry.URL == nil {
+				continue
+			}
+			if i, ok := index[entry.URL.ShortCode]; ok && state.URLs[i] != nil {
+				// 访问次数以回放出的计数为准，写日志时已在计数中的访问都有各自的 incr 和 variant 记录
+				entry.URL.AccessCount = state.URLs[i].AccessCount
+				entry.URL.CopyVariantClicks(state.URLs[i])
+				state.URLs[i] = entry.URL
+				if state.Revisions == nil {
+					state.Revisions = make(map[string][]*models.Revision)
+				}
+				state.Revisions[entry.URL.ShortCode] = append(state.Revisions[entry.URL.ShortCode], entry.Revisions...)
+			}
+		case opDelete:
+			if i, ok := index[entry.ShortCode]; ok {
+				state.URLs[i] = nil
+				delete(index, entry.ShortCode)
+				delete(state.Revisions, entry.ShortCode)
+				state.Deleted = append(state.Deleted, entry.ShortCode)
+				if entry.Reason != "" {
+					if state.DeletionReasons == nil {
+						state.DeletionReasons = make(map[string]string)
+					}
+					state.DeletionReasons[entry.ShortCode] = entry.Reason
+				}
+			}
+		}
+	}
+
+	// 去掉已删除的记录
+	urls := state.URLs[:0]
+	for _, url := range state.URLs {
+		if url != nil {
+			urls = append(urls, url)
+		}
+	}
+	state.URLs = urls
+}
+
+// readSnapshot 读取快照文件，文件不存在时返回空状态
+func readSnapshot(path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &snapshot{NextID: 1}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var state snapshot
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	if state.NextID == 0 {
+		state.NextID = 1
+	}
+
+	return &state, nil
+}
+
+// writeSnapshot 原子地写入快照：先写临时文件并刷盘，再重命名覆盖
+func writeSnapshot(path string, state *snapshot) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+
+	if err := json.NewEncoder(file).Encode(state); err != nil {
+		file.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+
+	// 同步目录项，保证重命名本身落盘
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+// readJournal 读取一个日志文件中的全部记录。
+// 进程崩溃可能留下写了一半的末尾记录，遇到不完整或校验失败的记录时
+// 丢弃它及之后的内容，并把文件截断到最后一条完整记录处。
+func readJournal(path string) ([]journalEntry, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	entries := make([]journalEntry, 0)
+	header := make([]byte, recordHeaderSize)
+	var offset int64
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return entries, truncateJournal(file, path, offset, err)
+		}
+
+		length := binary.LittleEndian.Uint32(header[0:4])
+		checksum := binary.LittleEndian.Uint32(header[4:8])
+		if length > maxRecordSize {
+			return entries, truncateJournal(file, path, offset, errors.New("record too large"))
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return entries, truncateJournal(file, path, offset, err)
+		}
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return entries, truncateJournal(file, path, offset, errors.New("checksum mismatch"))
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return entries, truncateJournal(file, path, offset, err)
+		}
+
+		entries = append(entries, entry)
+		offset += int64(recordHeaderSize) + int64(length)
+	}
+}
+
+// truncateJournal 丢弃损坏的日志尾部
+func truncateJournal(file *os.File, path string, offset int64, cause error) error {
+	log.Printf("journal: discarding torn record in %s at offset %d: %v", path, offset, cause)
+
+	if err := file.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+
+	return nil
+}
+
+// listJournalGenerations 列出目录中所有日志文件的代数，按从小到大排序
+func listJournalGenerations(dir string) ([]uint64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("list journal directory: %w", err)
+	}
+
+	generations := make([]uint64, 0)
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, journalPrefix) || !strings.HasSuffix(name, journalSuffix) {
+			continue
+		}
+
+		gen, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, journalPrefix), journalSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		generations = append(generations, gen)
+	}
+
+	sort.Slice(generations, func(i, j int) bool { return generations[i] < generations[j] })
+	return generations, nil
+}
+
+// journalPath 返回指定代数的日志文件路径
+func journalPath(dir string, generation uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d%s", journalPrefix, generation, journalSuffix))
+}
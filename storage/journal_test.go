@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/models"
+)
+
+// openTestJournalStorage 打开持久化内存存储，不启动后台任务，便于模拟崩溃
+func openTestJournalStorage(t *testing.T, dir string) *MemoryStorage {
+	store, err := OpenMemoryStorage(JournalConfig{
+		Dir:        dir,
+		SyncPolicy: SyncAlways,
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func TestJournalMemoryStorage(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		store := openTestJournalStorage(t, t.TempDir())
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestJournal_ReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openTestJournalStorage(t, dir)
+	first, err := saveURL(store, "https://www.example.com/1")
+	require.NoError(t, err)
+	second, err := saveURL(store, "https://www.example.com/2")
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(first.ShortCode))
+	require.NoError(t, store.IncrementAccessCount(first.ShortCode))
+	require.NoError(t, store.Delete(second.ShortCode))
+
+	// 不调用 Close，直接从磁盘恢复，相当于进程崩溃
+	recovered := openTestJournalStorage(t, dir)
+
+	record, err := recovered.GetByShortCode(first.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), record.AccessCount)
+
+	_, err = recovered.GetByShortCode(second.ShortCode)
+	assert.Equal(t, ErrURLNotFound, err)
+
+	// 删除后 ID 不会被复用
+	third, err := saveURL(recovered, "https://www.example.com/3")
+	require.NoError(t, err)
+	assert.Equal(t, second.ID+1, third.ID)
+
+	// 删除过的短码在回放和快照之后仍然不能再使用
+	reused := &models.URL{ID: third.ID + 1, OriginalURL: "https://www.example.com/4", ShortCode: second.ShortCode, CreatedAt: time.Now()}
+	_, err = recovered.Save(reused)
+	assert.Equal(t, ErrCodeExists, err)
+
+	require.NoError(t, recovered.Close())
+	reopened := openTestJournalStorage(t, dir)
+	defer reopened.Close()
+	_, err = reopened.Save(reused)
+	assert.Equal(t, ErrCodeExists, err)
+
+	// 删除原因在回放和快照之后保留
+	reason, err := reopened.DeletionReason(second.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, DeletionRemoved, reason)
+}
+
+func TestJournal_ReplayUpdate(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openTestJournalStorage(t, dir)
+	saved, err := saveURL(store, "https://www.example.com/typo")
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(saved.ShortCode))
+
+	edit := saved.Clone()
+	edit.OriginalURL = "https://www.example.com/fixed"
+	revision := models.NewRevision(edit, models.RevisionUpdate, "alice", time.Now())
+	revision.Number = 1
+	_, err = store.Update(edit, revision)
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(saved.ShortCode))
+
+	recovered := openTestJournalStorage(t, dir)
+	defer recovered.Close()
+
+	record, err := recovered.GetByShortCode(saved.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/fixed", record.OriginalURL)
+	assert.Equal(t, uint64(2), record.AccessCount)
+
+	revisions, err := recovered.GetRevisions(saved.ShortCode)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "alice", revisions[0].Actor)
+
+	// 快照同样保存修改历史
+	require.NoError(t, recovered.Snapshot())
+	reopened := openTestJournalStorage(t, dir)
+	defer reopened.Close()
+
+	revisions, err = reopened.GetRevisions(saved.ShortCode)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 1)
+}
+
+func TestJournal_ReplayVariantClicks(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openTestJournalStorage(t, dir)
+	saved, err := store.Save(&models.URL{
+		ID:          1,
+		OriginalURL: "https://www.example.com",
+		ShortCode:   "split",
+		CreatedAt:   time.Now(),
+		Variants: []models.Variant{
+			{Name: "a", URL: "https://a.example.com", Weight: 1},
+			{Name: "b", URL: "https://b.example.com", Weight: 1},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.AddVariantClicks(map[string]map[string]uint64{"split": {"a": 2, "b": 1}}))
+
+	// 修改之后的计数同样回放，修改前的计数按版本名保留
+	edit := saved.Clone()
+	edit.Variants = []models.Variant{{Name: "b", URL: "https://b.example.com", Weight: 1}}
+	_, err = store.Update(edit)
+	require.NoError(t, err)
+	require.NoError(t, store.AddVariantClicks(map[string]map[string]uint64{"split": {"b": 4}}))
+
+	recovered := openTestJournalStorage(t, dir)
+	record, err := recovered.GetByShortCode("split")
+	require.NoError(t, err)
+	require.Len(t, record.Variants, 1)
+	assert.Equal(t, uint64(5), record.Variants[0].Clicks)
+
+	// 快照中保存各版本的访问次数
+	require.NoError(t, recovered.Close())
+	reopened := openTestJournalStorage(t, dir)
+	defer reopened.Close()
+	record, err = reopened.GetByShortCode("split")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), record.Variants[0].Clicks)
+}
+
+func TestJournal_SnapshotAndTail(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openTestJournalStorage(t, dir)
+	first, err := saveURL(store, "https://www.example.com/1")
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(first.ShortCode))
+	require.NoError(t, store.Snapshot())
+
+	// 快照之后的修改只存在于日志中
+	second, err := saveURL(store, "https://www.example.com/2")
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(first.ShortCode))
+
+	generations, err := listJournalGenerations(dir)
+	require.NoError(t, err)
+	assert.Len(t, generations, 1, "old journals should be removed after compaction")
+
+	recovered := openTestJournalStorage(t, dir)
+
+	record, err := recovered.GetByShortCode(first.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), record.AccessCount)
+
+	record, err = recovered.GetByID(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, second.ShortCode, record.ShortCode)
+
+	// 去重索引同样被恢复
+	again, err := saveURL(recovered, "https://www.example.com/1")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID)
+}
+
+func TestJournal_TornFinalRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openTestJournalStorage(t, dir)
+	saved, err := saveURL(store, "https://www.example.com")
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(saved.ShortCode))
+
+	// 模拟写了一半的记录：完整的头部加上不完整的内容
+	path := journalPath(dir, 0)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0x40, 0, 0, 0, 0xde, 0xad, 0xbe, 0xef, '{', '"'})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	recovered := openTestJournalStorage(t, dir)
+
+	record, err := recovered.GetByShortCode(saved.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), record.AccessCount)
+
+	// 损坏的尾部被截断，之后的写入可以正常回放
+	truncated, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+
+	require.NoError(t, recovered.IncrementAccessCount(saved.ShortCode))
+	require.NoError(t, recovered.Close())
+
+	reopened := openTestJournalStorage(t, dir)
+	defer reopened.Close()
+
+	record, err = reopened.GetByShortCode(saved.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), record.AccessCount)
+}
+
+func TestJournal_InvalidSyncPolicy(t *testing.T) {
+	_, err := OpenMemoryStorage(JournalConfig{Dir: t.TempDir(), SyncPolicy: "sometimes"})
+	assert.Error(t, err)
+}
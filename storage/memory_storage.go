@@ -3,70 +3,158 @@ package storage
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gin-url-shortener/models"
-	"gin-url-shortener/utils"
 )
 
 var (
 	ErrURLNotFound = errors.New("URL not found")
 	ErrURLExists   = errors.New("URL already exists")
+	ErrCodeExists  = errors.New("short code already exists")
+
+	ErrClickLimitReached = errors.New("click limit reached")
+	ErrRevisionConflict  = errors.New("revision conflict")
+	ErrNotDue            = errors.New("URL is not due for reaping")
 )
 
-// MemoryStorage 内存存储实现
+// defaultShardCount 默认分片数量
+const defaultShardCount = 64
+
+// MemoryStorage 内存存储实现。
+// 三个索引分别按键哈希分片，不同短码上的读写互不阻塞；
+// ID 通过原子操作分配，访问计数直接原子地累加在记录上。
 type MemoryStorage struct {
-	urls       map[string]*models.URL // shortCode -> URL
-	urlsByID   map[uint64]*models.URL // id -> URL
-	urlsByOrig map[string]*models.URL // originalURL -> URL (用于去重)
-	nextID     uint64
-	mutex      sync.RWMutex
+	urls       *shardedMap[string] // shortCode -> URL
+	urlsByID   *shardedMap[uint64] // id -> URL
+	urlsByOrig *shardedMap[string] // originalURL -> URL (用于去重，只含普通链接)
+	expiry     expiryIndex         // 带过期时间的记录
+	lastID     uint64              // 最近分配的 ID，原子访问
+	journal    *journal            // 持久化日志，为 nil 时只保存在内存中
+
+	historyMutex sync.RWMutex
+	history      map[string][]*models.Revision // shortCode -> 修改历史
+
+	deletedMutex sync.RWMutex
+	deleted      map[string]string // 已删除的短码 -> 删除原因，这些短码不会再次分配
+
+	// persistMutex 仅在启用持久化时使用：修改操作持有读锁，
+	// 生成快照时持有写锁，保证快照与日志切换点一致
+	persistMutex sync.RWMutex
 }
 
 // NewMemoryStorage 创建新的内存存储实例
 func NewMemoryStorage() *MemoryStorage {
+	return NewShardedMemoryStorage(defaultShardCount)
+}
+
+// NewShardedMemoryStorage 创建指定分片数量的内存存储实例
+func NewShardedMemoryStorage(shardCount int) *MemoryStorage {
 	return &MemoryStorage{
-		urls:       make(map[string]*models.URL),
-		urlsByID:   make(map[uint64]*models.URL),
-		urlsByOrig: make(map[string]*models.URL),
-		nextID:     1,
+		urls:       newShardedMap[string](shardCount, hashString),
+		urlsByID:   newShardedMap[uint64](shardCount, hashID),
+		urlsByOrig: newShardedMap[string](shardCount, hashString),
+		history:    make(map[string][]*models.Revision),
+		deleted:    make(map[string]string),
+	}
+}
+
+// OpenMemoryStorage 创建带持久化的内存存储实例。
+// 启动时从最近的快照和之后的日志恢复数据，运行期间所有修改先写日志再更新内存。
+func OpenMemoryStorage(config JournalConfig) (*MemoryStorage, error) {
+	j, state, err := openJournal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewMemoryStorage()
+	s.lastID = state.NextID - 1
+	for _, url := range state.URLs {
+		s.urls.set(url.ShortCode, url)
+		s.urlsByID.set(url.ID, url)
+		if url.Deduplicable() {
+			s.urlsByOrig.set(url.OriginalURL, url)
+		}
+		s.expiry.add(url)
 	}
+	for shortCode, revisions := range state.Revisions {
+		s.history[shortCode] = revisions
+	}
+	for _, shortCode := range state.Deleted {
+		s.deleted[shortCode] = state.DeletionReasons[shortCode]
+	}
+
+	s.journal = j
+	j.run(s.Snapshot)
+
+	return s, nil
+}
+
+// NextID 无锁分配 ID
+func (s *MemoryStorage) NextID() (uint64, error) {
+	return atomic.AddUint64(&s.lastID, 1), nil
 }
 
 // Save 保存 URL 记录
-func (s *MemoryStorage) Save(originalURL string) (*models.URL, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+func (s *MemoryStorage) Save(url *models.URL) (*models.URL, error) {
+	if s.journal != nil {
+		s.persistMutex.RLock()
+		defer s.persistMutex.RUnlock()
+	}
+
+	// 持有原始 URL 所在分片的写锁，保证相同 URL 的去重检查和写入是原子的；
+	// 别名等带额外设置的链接不参与去重
+	var origShard *mapShard[string]
+	if url.Deduplicable() {
+		origShard = s.urlsByOrig.shard(url.OriginalURL)
+		origShard.mutex.Lock()
+		defer origShard.mutex.Unlock()
 
-	// 检查是否已存在相同的原始 URL
-	if existingURL, exists := s.urlsByOrig[originalURL]; exists {
-		return existingURL, nil
+		// 检查是否已存在相同的原始 URL
+		if existingURL, exists := origShard.items[url.OriginalURL]; exists {
+			return existingURL, nil
+		}
 	}
 
-	// 生成新的 URL 记录
-	url := &models.URL{
-		ID:          s.nextID,
-		OriginalURL: originalURL,
-		ShortCode:   utils.EncodeBase62(s.nextID),
-		CreatedAt:   time.Now(),
-		AccessCount: 0,
+	// 持有短码所在分片的写锁，保证短码的占用检查和写入是原子的
+	codeShard := s.urls.shard(url.ShortCode)
+	codeShard.mutex.Lock()
+	defer codeShard.mutex.Unlock()
+
+	if _, exists := codeShard.items[url.ShortCode]; exists || s.isDeleted(url.ShortCode) {
+		return nil, ErrCodeExists
+	}
+
+	// 先写日志，写入失败时不修改内存状态
+	if err := s.appendJournal(journalEntry{Op: opSave, URL: url}); err != nil {
+		return nil, err
 	}
 
-	// 保存到各个映射中
-	s.urls[url.ShortCode] = url
-	s.urlsByID[url.ID] = url
-	s.urlsByOrig[originalURL] = url
+	// 保存到各个索引中
+	codeShard.items[url.ShortCode] = url
+	s.urlsByID.set(url.ID, url)
+	if origShard != nil {
+		origShard.items[url.OriginalURL] = url
+	}
+	s.expiry.add(url)
 
-	s.nextID++
 	return url, nil
 }
 
 // GetByShortCode 根据短码获取 URL 记录
 func (s *MemoryStorage) GetByShortCode(shortCode string) (*models.URL, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	url, exists := s.urls.get(shortCode)
+	if !exists {
+		return nil, ErrURLNotFound
+	}
 
-	url, exists := s.urls[shortCode]
+	return url, nil
+}
+
+// GetByOriginalURL 根据原始 URL 获取 URL 记录
+func (s *MemoryStorage) GetByOriginalURL(originalURL string) (*models.URL, error) {
+	url, exists := s.urlsByOrig.get(originalURL)
 	if !exists {
 		return nil, ErrURLNotFound
 	}
@@ -76,10 +164,7 @@ func (s *MemoryStorage) GetByShortCode(shortCode string) (*models.URL, error) {
 
 // GetByID 根据 ID 获取 URL 记录
 func (s *MemoryStorage) GetByID(id uint64) (*models.URL, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	url, exists := s.urlsByID[id]
+	url, exists := s.urlsByID.get(id)
 	if !exists {
 		return nil, ErrURLNotFound
 	}
@@ -87,40 +172,343 @@ func (s *MemoryStorage) GetByID(id uint64) (*models.URL, error) {
 	return url, nil
 }
 
-// IncrementAccessCount 增加访问计数
+// IncrementAccessCount 增加访问计数，只需要分片读锁，计数本身是原子操作
 func (s *MemoryStorage) IncrementAccessCount(shortCode string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	if s.journal != nil {
+		s.persistMutex.RLock()
+		defer s.persistMutex.RUnlock()
+	}
+
+	// 在分片读锁内累加，Update 替换记录时不会丢失正在进行的计数
+	shard := s.urls.shard(shortCode)
+	shard.mutex.RLock()
+	url, exists := shard.items[shortCode]
+	if !exists {
+		shard.mutex.RUnlock()
+		return ErrURLNotFound
+	}
+
+	// 先原子地占用一次访问，并发请求不会超过次数限制
+	added := url.AddAccessCountWithin(1)
+	shard.mutex.RUnlock()
+	if added == 0 {
+		return ErrClickLimitReached
+	}
+
+	if err := s.appendJournal(journalEntry{Op: opIncrement, ShortCode: shortCode}); err != nil {
+		url.AddAccessCount(^uint64(0)) // 写日志失败，撤销占用的访问
+		return err
+	}
+
+	return nil
+}
+
+// AddAccessCounts 批量累加访问计数
+func (s *MemoryStorage) AddAccessCounts(counts map[string]uint64) error {
+	if s.journal != nil {
+		s.persistMutex.RLock()
+		defer s.persistMutex.RUnlock()
+	}
+
+	var applied uint64
+	for shortCode, delta := range counts {
+		if delta == 0 {
+			continue
+		}
+
+		shard := s.urls.shard(shortCode)
+		shard.mutex.RLock()
+		url, exists := shard.items[shortCode]
+		added := uint64(0)
+		if exists {
+			added = url.AddAccessCountWithin(delta)
+		}
+		shard.mutex.RUnlock()
+
+		if added > 0 {
+			if err := s.appendJournal(journalEntry{Op: opIncrement, ShortCode: shortCode, Delta: added}); err != nil {
+				url.AddAccessCount(-added) // 写日志失败，撤销本次累加
+				if applied > 0 {
+					return &PartialCountError{Applied: applied, Err: err}
+				}
+				return err
+			}
+		}
+		applied += added
+	}
+
+	return nil
+}
+
+// AddVariantClicks 批量累加各版本的访问次数
+func (s *MemoryStorage) AddVariantClicks(counts map[string]map[string]uint64) error {
+	if s.journal != nil {
+		s.persistMutex.RLock()
+		defer s.persistMutex.RUnlock()
+	}
+
+	for shortCode, variants := range counts {
+		shard := s.urls.shard(shortCode)
+		for name, delta := range variants {
+			if delta == 0 {
+				continue
+			}
+
+			shard.mutex.RLock()
+			url, exists := shard.items[shortCode]
+			added := exists && url.AddVariantClicks(name, delta)
+			shard.mutex.RUnlock()
+			if !added {
+				continue
+			}
+
+			if err := s.appendJournal(journalEntry{Op: opVariant, ShortCode: shortCode, Variant: name, Delta: delta}); err != nil {
+				url.AddVariantClicks(name, -delta) // 写日志失败，撤销本次累加
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Update 替换记录的可变字段并追加修改历史。
+// 记录本身不可变地替换为新的对象，并发读取拿到的旧对象不受影响。
+func (s *MemoryStorage) Update(url *models.URL, revisions ...*models.Revision) (*models.URL, error) {
+	if s.journal != nil {
+		s.persistMutex.RLock()
+		defer s.persistMutex.RUnlock()
+	}
+
+	// 持有短码分片的写锁，同一短码的修改串行进行，也不会与计数交错
+	shard := s.urls.shard(url.ShortCode)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
-	url, exists := s.urls[shortCode]
+	current, exists := shard.items[url.ShortCode]
 	if !exists {
+		return nil, ErrURLNotFound
+	}
+
+	s.historyMutex.Lock()
+	defer s.historyMutex.Unlock()
+
+	history := s.history[url.ShortCode]
+	if !nextRevisions(len(history), revisions) {
+		return nil, ErrRevisionConflict
+	}
+
+	updated := url.Clone()
+	updated.ID = current.ID
+	updated.CreatedAt = current.CreatedAt
+	updated.Custom = current.Custom
+	updated.AccessCount = current.LoadAccessCount()
+	updated.CopyVariantClicks(current)
+
+	if err := s.appendJournal(journalEntry{Op: opUpdate, URL: updated, Revisions: revisions}); err != nil {
+		return nil, err
+	}
+
+	shard.items[url.ShortCode] = updated
+	s.urlsByID.set(updated.ID, updated)
+	s.urlsByOrig.remove(current.OriginalURL, current)
+	s.expiry.add(updated)
+	s.history[url.ShortCode] = append(history, revisions...)
+
+	return updated, nil
+}
+
+// GetRevisions 获取修改历史
+func (s *MemoryStorage) GetRevisions(shortCode string) ([]*models.Revision, error) {
+	s.historyMutex.RLock()
+	defer s.historyMutex.RUnlock()
+
+	return append([]*models.Revision(nil), s.history[shortCode]...), nil
+}
+
+// Delete 删除 URL 记录
+func (s *MemoryStorage) Delete(shortCode string) error {
+	return s.delete(shortCode, time.Time{})
+}
+
+// DeleteIfDue 在短码分片的写锁内确认记录仍然需要清理后删除
+func (s *MemoryStorage) DeleteIfDue(shortCode string, before time.Time) error {
+	return s.delete(shortCode, before)
+}
+
+// delete 删除记录，before 不为零值时只删除清理时间早于 before 的记录
+func (s *MemoryStorage) delete(shortCode string, before time.Time) error {
+	if s.journal != nil {
+		s.persistMutex.RLock()
+		defer s.persistMutex.RUnlock()
+	}
+
+	// 在短码分片的写锁内完成查找和删除，避免重复删除
+	shard := s.urls.shard(shortCode)
+	shard.mutex.Lock()
+	url, exists := shard.items[shortCode]
+	if !exists {
+		shard.mutex.Unlock()
 		return ErrURLNotFound
 	}
+	if !isDue(url, before) {
+		shard.mutex.Unlock()
+		return ErrNotDue
+	}
+
+	reason := deletionReason(url, deletionTime(before))
+	if err := s.appendJournal(journalEntry{Op: opDelete, ShortCode: shortCode, Reason: reason}); err != nil {
+		shard.mutex.Unlock()
+		return err
+	}
+
+	delete(shard.items, shortCode)
+	s.deletedMutex.Lock()
+	s.deleted[shortCode] = reason
+	s.deletedMutex.Unlock()
+	shard.mutex.Unlock()
+
+	s.urlsByID.remove(url.ID, url)
+	s.urlsByOrig.remove(url.OriginalURL, url)
+
+	s.historyMutex.Lock()
+	delete(s.history, shortCode)
+	s.historyMutex.Unlock()
 
-	url.AccessCount++
 	return nil
 }
 
+// isDeleted 判断短码是否被删除过
+func (s *MemoryStorage) isDeleted(shortCode string) bool {
+	s.deletedMutex.RLock()
+	defer s.deletedMutex.RUnlock()
+
+	_, deleted := s.deleted[shortCode]
+	return deleted
+}
+
+// DeletionReason 返回已删除短码记录的删除原因
+func (s *MemoryStorage) DeletionReason(shortCode string) (string, error) {
+	s.deletedMutex.RLock()
+	defer s.deletedMutex.RUnlock()
+
+	reason, deleted := s.deleted[shortCode]
+	if !deleted {
+		return "", ErrURLNotFound
+	}
+	return reason, nil
+}
+
+// ListExpired 从过期索引中取出已过期或应从回收站清除的记录
+func (s *MemoryStorage) ListExpired(before time.Time, limit int) ([]*models.URL, error) {
+	urls := s.expiry.due(before, limit, func(url *models.URL) bool {
+		current, exists := s.urls.get(url.ShortCode)
+		return exists && current == url
+	})
+
+	return urls, nil
+}
+
 // GetStats 获取存储统计信息
-func (s *MemoryStorage) GetStats() map[string]interface{} {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+func (s *MemoryStorage) GetStats() (map[string]interface{}, error) {
+	var trashed, disabled int
+	s.urls.each(func(url *models.URL) {
+		if url.DeletedAt != nil {
+			trashed++
+		}
+		if url.DisabledAt != nil {
+			disabled++
+		}
+	})
+
+	s.deletedMutex.RLock()
+	deleted := len(s.deleted)
+	s.deletedMutex.RUnlock()
 
 	return map[string]interface{}{
-		"total_urls": len(s.urls),
-		"next_id":    s.nextID,
-	}
+		"total_urls":    s.urls.len(),
+		"trashed_urls":  trashed,
+		"disabled_urls": disabled,
+		"deleted_codes": deleted,
+		"next_id":       atomic.LoadUint64(&s.lastID) + 1,
+		"shards":        len(s.urls.shards),
+	}, nil
 }
 
 // GetAllURLs 获取所有 URL 记录（用于测试和调试）
-func (s *MemoryStorage) GetAllURLs() []*models.URL {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	urls := make([]*models.URL, 0, len(s.urls))
-	for _, url := range s.urls {
+func (s *MemoryStorage) GetAllURLs() ([]*models.URL, error) {
+	urls := make([]*models.URL, 0, s.urls.len())
+	s.urls.each(func(url *models.URL) {
 		urls = append(urls, url)
+	})
+
+	return urls, nil
+}
+
+// Snapshot 生成压缩快照并清理旧日志，未启用持久化时不做任何事
+func (s *MemoryStorage) Snapshot() error {
+	if s.journal == nil {
+		return nil
+	}
+
+	// 切换日志和复制状态需要在同一把写锁内完成，保证快照与新日志衔接
+	s.persistMutex.Lock()
+	generation, err := s.journal.rotate()
+	if err != nil {
+		s.persistMutex.Unlock()
+		return err
+	}
+
+	state := &snapshot{
+		Generation: generation,
+		NextID:     atomic.LoadUint64(&s.lastID) + 1,
+		URLs:       make([]*models.URL, 0, s.urls.len()),
+	}
+	s.urls.each(func(url *models.URL) {
+		state.URLs = append(state.URLs, url.Clone())
+	})
+	s.historyMutex.RLock()
+	state.Revisions = make(map[string][]*models.Revision, len(s.history))
+	for shortCode, revisions := range s.history {
+		state.Revisions[shortCode] = append([]*models.Revision(nil), revisions...)
+	}
+	s.historyMutex.RUnlock()
+	s.deletedMutex.RLock()
+	state.Deleted = make([]string, 0, len(s.deleted))
+	state.DeletionReasons = make(map[string]string, len(s.deleted))
+	for shortCode, reason := range s.deleted {
+		state.Deleted = append(state.Deleted, shortCode)
+		if reason != "" {
+			state.DeletionReasons[shortCode] = reason
+		}
+	}
+	s.deletedMutex.RUnlock()
+	s.persistMutex.Unlock()
+
+	// 写快照较慢，放在锁外进行
+	return s.journal.compact(state)
+}
+
+// Close 关闭存储，启用持久化时会先生成一次快照以加快下次启动
+func (s *MemoryStorage) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+
+	s.journal.stopBackground()
+	if err := s.Snapshot(); err != nil {
+		s.journal.close()
+		return err
+	}
+
+	return s.journal.close()
+}
+
+// appendJournal 在启用持久化时追加日志，调用方需持有 persistMutex 读锁
+func (s *MemoryStorage) appendJournal(entry journalEntry) error {
+	if s.journal == nil {
+		return nil
 	}
 
-	return urls
+	return s.journal.append(entry)
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
 )
 
@@ -13,7 +14,7 @@ func BenchmarkMemoryStorage_Save(b *testing.B) {
 		i := 0
 		for pb.Next() {
 			url := fmt.Sprintf("https://www.example%d.com", i)
-			_, err := storage.Save(url)
+			_, err := saveURL(storage, url)
 			if err != nil {
 				b.Errorf("Save failed: %v", err)
 			}
@@ -29,7 +30,7 @@ func BenchmarkMemoryStorage_GetByShortCode(b *testing.B) {
 	shortCodes := make([]string, 1000)
 	for i := 0; i < 1000; i++ {
 		url := fmt.Sprintf("https://www.example%d.com", i)
-		urlRecord, err := storage.Save(url)
+		urlRecord, err := saveURL(storage, url)
 		if err != nil {
 			b.Fatalf("Failed to save URL: %v", err)
 		}
@@ -57,7 +58,7 @@ func BenchmarkMemoryStorage_IncrementAccessCount(b *testing.B) {
 	shortCodes := make([]string, 100)
 	for i := 0; i < 100; i++ {
 		url := fmt.Sprintf("https://www.example%d.com", i)
-		urlRecord, err := storage.Save(url)
+		urlRecord, err := saveURL(storage, url)
 		if err != nil {
 			b.Fatalf("Failed to save URL: %v", err)
 		}
@@ -77,3 +78,58 @@ func BenchmarkMemoryStorage_IncrementAccessCount(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkMemoryStorage_ParallelRedirect 模拟重定向热路径（查找 + 计数）。
+// 使用 -cpu=1,2,4,8 运行，对比单分片（等价于全局锁）与默认分片的吞吐随核数的变化。
+func BenchmarkMemoryStorage_ParallelRedirect(b *testing.B) {
+	for _, shards := range []int{1, defaultShardCount} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			storage := NewShardedMemoryStorage(shards)
+
+			shortCodes := make([]string, 1000)
+			for i := range shortCodes {
+				urlRecord, err := saveURL(storage, fmt.Sprintf("https://www.example%d.com", i))
+				if err != nil {
+					b.Fatalf("Failed to save URL: %v", err)
+				}
+				shortCodes[i] = urlRecord.ShortCode
+			}
+
+			// 每个 goroutine 从不同的位置开始，避免所有 goroutine 同时争用同一条记录
+			var offset uint64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddUint64(&offset, 97))
+				for pb.Next() {
+					shortCode := shortCodes[i%len(shortCodes)]
+					if _, err := storage.GetByShortCode(shortCode); err != nil {
+						b.Errorf("GetByShortCode failed: %v", err)
+					}
+					if err := storage.IncrementAccessCount(shortCode); err != nil {
+						b.Errorf("IncrementAccessCount failed: %v", err)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMemoryStorage_ParallelHotKey 所有 goroutine 访问同一个短码，衡量原子计数的开销
+func BenchmarkMemoryStorage_ParallelHotKey(b *testing.B) {
+	storage := NewMemoryStorage()
+	urlRecord, err := saveURL(storage, "https://www.example.com")
+	if err != nil {
+		b.Fatalf("Failed to save URL: %v", err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := storage.IncrementAccessCount(urlRecord.ShortCode); err != nil {
+				b.Errorf("IncrementAccessCount failed: %v", err)
+			}
+		}
+	})
+}
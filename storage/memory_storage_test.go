@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return NewMemoryStorage()
+	})
+}
+
+func TestMemoryStorage_ConcurrentSaveDeduplicates(t *testing.T) {
+	storage := NewShardedMemoryStorage(4)
+
+	// 同一个原始 URL 并发保存，只能生成一条记录
+	var wg sync.WaitGroup
+	ids := make([]uint64, 20)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url, err := saveURL(storage, "https://www.example.com")
+			require.NoError(t, err)
+			ids[i] = url.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		assert.Equal(t, ids[0], id)
+	}
+
+	urls, err := storage.GetAllURLs()
+	require.NoError(t, err)
+	assert.Len(t, urls, 1)
+}
+
+func TestMemoryStorage_Delete(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	saved, err := saveURL(storage, "https://www.example.com")
+	require.NoError(t, err)
+	require.NoError(t, storage.Delete(saved.ShortCode))
+
+	_, err = storage.GetByShortCode(saved.ShortCode)
+	assert.Equal(t, ErrURLNotFound, err)
+	_, err = storage.GetByID(saved.ID)
+	assert.Equal(t, ErrURLNotFound, err)
+	assert.Equal(t, ErrURLNotFound, storage.Delete(saved.ShortCode))
+
+	// 删除后重新保存会分配新的 ID
+	again, err := saveURL(storage, "https://www.example.com")
+	require.NoError(t, err)
+	assert.Greater(t, again.ID, saved.ID)
+}
@@ -0,0 +1,787 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gin-url-shortener/models"
+)
+
+// redisSaveScript 原子地完成去重检查、短码占用检查和写入。
+// 原始 URL 已存在时返回已有的短码，短码已被占用或删除过时返回 nil，否则写入新记录并返回新短码。
+// 别名等带额外设置的链接不参与去重。
+//
+// KEYS[1] 原始 URL 索引，KEYS[2] ID 索引，KEYS[3] 记录哈希，KEYS[4] 过期索引，KEYS[5] 修改历史列表，
+// KEYS[6] 已删除短码集合，KEYS[7] 回收站集合，KEYS[8] 禁用集合，KEYS[9] 已删除短码的删除原因哈希
+// ARGV[1] 原始 URL，ARGV[2] 短码，ARGV[3] ID，ARGV[4] 是否参与去重（0/1），
+// ARGV[5] 清理时间（Unix 毫秒，空表示不清理），ARGV[6...] 记录哈希的字段和值
+var redisSaveScript = redis.NewScript(`
+local dedup = ARGV[4] == '1'
+if dedup then
+	local existing = redis.call('HGET', KEYS[1], ARGV[1])
+	if existing then
+		return existing
+	end
+end
+if redis.call('EXISTS', KEYS[3]) == 1 or redis.call('SISMEMBER', KEYS[6], ARGV[2]) == 1 then
+	return false
+end
+redis.call('HSET', KEYS[3], unpack(ARGV, 6))
+if redis.call('HEXISTS', KEYS[3], 'deleted_at') == 1 then
+	redis.call('SADD', KEYS[7], ARGV[2])
+end
+if redis.call('HEXISTS', KEYS[3], 'disabled_at') == 1 then
+	redis.call('SADD', KEYS[8], ARGV[2])
+end
+redis.call('HSET', KEYS[2], ARGV[3], ARGV[2])
+if dedup then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+if ARGV[5] ~= '' then
+	redis.call('ZADD', KEYS[4], ARGV[5], ARGV[2])
+end
+return ARGV[2]
+`)
+
+// redisDeleteScript 原子地删除记录及其所有索引并记下短码和删除原因，记录不存在时返回 0，
+// 指定了清理时间上限而记录的清理时间不早于它时返回 -1。
+// 不在回收站中的记录的清理时间就是过期时间，据此与 deletionReason 一样判断原因。
+//
+// KEYS 同 redisSaveScript
+// ARGV[1] 短码，ARGV[2] 清理时间上限（Unix 毫秒，空表示不检查），ARGV[3] 判断是否已过期的时间（Unix 毫秒）
+var redisDeleteScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[3], 'id', 'original_url', 'deleted_at')
+if not fields[1] then
+	return 0
+end
+local score = redis.call('ZSCORE', KEYS[4], ARGV[1])
+if ARGV[2] ~= '' then
+	if not score or tonumber(score) >= tonumber(ARGV[2]) then
+		return -1
+	end
+end
+local reason = 'removed'
+if fields[3] then
+	reason = 'purged'
+elseif score and tonumber(score) <= tonumber(ARGV[3]) then
+	reason = 'expired'
+end
+redis.call('HSET', KEYS[9], ARGV[1], reason)
+redis.call('DEL', KEYS[3], KEYS[5])
+redis.call('HDEL', KEYS[2], fields[1])
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('SREM', KEYS[7], ARGV[1])
+redis.call('SREM', KEYS[8], ARGV[1])
+redis.call('SADD', KEYS[6], ARGV[1])
+if redis.call('HGET', KEYS[1], fields[2]) == ARGV[1] then
+	redis.call('HDEL', KEYS[1], fields[2])
+end
+return 1
+`)
+
+// redisUpdateScript 原子地替换记录的可变字段、调整索引并追加修改历史。
+// 记录不存在返回 -1，历史版本数与预期不符返回 -2，成功返回 1。修改过的记录离开去重索引。
+//
+// KEYS 同 redisSaveScript
+// ARGV[1] 短码，ARGV[2] 已有的历史版本数（空表示不检查），ARGV[3] 追加的版本数 n，
+// ARGV[4...3+n] 各版本的 JSON，ARGV[4+n] 清理时间（Unix 毫秒，空表示不清理），之后为可变字段和值
+var redisUpdateScript = redis.NewScript(`
+local original = redis.call('HGET', KEYS[3], 'original_url')
+if not original then
+	return -1
+end
+if ARGV[2] ~= '' and redis.call('LLEN', KEYS[5]) ~= tonumber(ARGV[2]) then
+	return -2
+end
+local n = tonumber(ARGV[3])
+for i = 1, n do
+	redis.call('RPUSH', KEYS[5], ARGV[3 + i])
+end
+if redis.call('HGET', KEYS[1], original) == ARGV[1] then
+	redis.call('HDEL', KEYS[1], original)
+end
+redis.call('HDEL', KEYS[3], 'expires_at', 'activate_at', 'deactivate_at', 'fallback_url', 'password_hash', 'redirect_type', 'updated_at',
+	'deleted_at', 'purge_at', 'disabled_at', 'disabled_reason', 'query_passthrough', 'path_passthrough', 'template', 'rules', 'variants')
+redis.call('HSET', KEYS[3], unpack(ARGV, 5 + n))
+local variants = redis.call('HGET', KEYS[3], 'variants') or ''
+for _, field in ipairs(redis.call('HKEYS', KEYS[3])) do
+	if string.sub(field, 1, 15) == 'variant_clicks:' and not string.find(variants, '"name":"' .. string.sub(field, 16) .. '"', 1, true) then
+		redis.call('HDEL', KEYS[3], field)
+	end
+end
+redis.call('ZREM', KEYS[4], ARGV[1])
+if ARGV[4 + n] ~= '' then
+	redis.call('ZADD', KEYS[4], ARGV[4 + n], ARGV[1])
+end
+if redis.call('HEXISTS', KEYS[3], 'deleted_at') == 1 then
+	redis.call('SADD', KEYS[7], ARGV[1])
+else
+	redis.call('SREM', KEYS[7], ARGV[1])
+end
+if redis.call('HEXISTS', KEYS[3], 'disabled_at') == 1 then
+	redis.call('SADD', KEYS[8], ARGV[1])
+else
+	redis.call('SREM', KEYS[8], ARGV[1])
+end
+return 1
+`)
+
+// redisIncrementScript 只对已存在的记录执行 HINCRBY，避免为不存在的短码创建空哈希。
+// 限制了访问次数的记录最多累加到 max_clicks，返回实际累加的次数；记录不存在返回 -1，次数已用完返回 -2。
+//
+// KEYS[1] 记录哈希
+// ARGV[1] 增量
+var redisIncrementScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'access_count', 'max_clicks')
+if not fields[1] then
+	return -1
+end
+local delta = tonumber(ARGV[1])
+local maxClicks = tonumber(fields[2] or '0')
+if maxClicks > 0 then
+	local remaining = maxClicks - tonumber(fields[1])
+	if remaining <= 0 then
+		return -2
+	end
+	if delta > remaining then
+		delta = remaining
+	end
+end
+redis.call('HINCRBY', KEYS[1], 'access_count', delta)
+return delta
+`)
+
+// redisVariantScript 只对已存在的记录中已有的版本执行 HINCRBY，记录或版本不存在时返回 -1。
+// 版本名只包含小写字母、数字、- 和 _，在版本列表的 JSON 中以 "name":"<版本名>" 原样出现。
+//
+// KEYS[1] 记录哈希
+// ARGV[1] 版本名，ARGV[2] 增量
+var redisVariantScript = redis.NewScript(`
+local variants = redis.call('HGET', KEYS[1], 'variants')
+if not variants or not string.find(variants, '"name":"' .. ARGV[1] .. '"', 1, true) then
+	return -1
+end
+return redis.call('HINCRBY', KEYS[1], 'variant_clicks:' .. ARGV[1], ARGV[2])
+`)
+
+// redisVariantClicksPrefix 记录哈希中保存各版本访问次数的字段名前缀，后面是版本名
+const redisVariantClicksPrefix = "variant_clicks:"
+
+// redisInvalidationRetry 失效通知的订阅连接中断后重试的间隔
+const redisInvalidationRetry = time.Second
+
+// RedisStorage 基于 Redis 的共享存储实现，多个实例可以共用同一份数据
+type RedisStorage struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStorage 创建 Redis 存储实例，并检查连接是否可用
+func NewRedisStorage(client *redis.Client, prefix string) (*RedisStorage, error) {
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("connect redis: %w", err)
+	}
+
+	return &RedisStorage{
+		client: client,
+		prefix: prefix,
+	}, nil
+}
+
+// NextID 通过 INCR 在所有实例之间分配全局唯一的 ID
+func (s *RedisStorage) NextID() (uint64, error) {
+	return s.client.Incr(context.Background(), s.key("next_id")).Uint64()
+}
+
+// Save 保存 URL 记录
+func (s *RedisStorage) Save(url *models.URL) (*models.URL, error) {
+	ctx := context.Background()
+
+	fields := []interface{}{
+		"id", url.ID,
+		"short_code", url.ShortCode,
+		"created_at", url.CreatedAt.Format(time.RFC3339Nano),
+		"access_count", url.AccessCount,
+		"custom", url.Custom,
+	}
+	for i := range url.Variants {
+		if clicks := url.Variants[i].LoadClicks(); clicks > 0 {
+			fields = append(fields, redisVariantClicksPrefix+url.Variants[i].Name, clicks)
+		}
+	}
+	fields = append(fields, redisMutableFields(url)...)
+
+	args := append([]interface{}{url.OriginalURL, url.ShortCode, url.ID, url.Deduplicable(), redisExpiryScore(url)}, fields...)
+	savedCode, err := redisSaveScript.Run(ctx, s.client, s.indexKeys(url.ShortCode), args...).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCodeExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 相同的原始 URL 已经保存过（可能是其他实例），返回已有的记录
+	if savedCode != url.ShortCode {
+		return s.GetByShortCode(savedCode)
+	}
+
+	return url, nil
+}
+
+// GetByShortCode 根据短码获取 URL 记录
+func (s *RedisStorage) GetByShortCode(shortCode string) (*models.URL, error) {
+	fields, err := s.client.HGetAll(context.Background(), s.urlKey(shortCode)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRedisURL(fields)
+}
+
+// GetByOriginalURL 根据原始 URL 获取 URL 记录
+func (s *RedisStorage) GetByOriginalURL(originalURL string) (*models.URL, error) {
+	shortCode, err := s.client.HGet(context.Background(), s.key("originals"), originalURL).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByShortCode(shortCode)
+}
+
+// GetByID 根据 ID 获取 URL 记录
+func (s *RedisStorage) GetByID(id uint64) (*models.URL, error) {
+	shortCode, err := s.client.HGet(context.Background(), s.key("ids"), strconv.FormatUint(id, 10)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByShortCode(shortCode)
+}
+
+// IncrementAccessCount 使用 HINCRBY 原子地增加访问计数
+func (s *RedisStorage) IncrementAccessCount(shortCode string) error {
+	count, err := redisIncrementScript.Run(context.Background(), s.client, []string{s.urlKey(shortCode)}, 1).Int64()
+	if err != nil {
+		return err
+	}
+	switch count {
+	case -1:
+		return ErrURLNotFound
+	case -2:
+		return ErrClickLimitReached
+	}
+
+	return nil
+}
+
+// AddAccessCounts 通过 pipeline 一次往返批量累加访问计数
+func (s *RedisStorage) AddAccessCounts(counts map[string]uint64) error {
+	ctx := context.Background()
+
+	// 确保脚本已加载，pipeline 中的 EVALSHA 才不会因为 NOSCRIPT 失败
+	if err := redisIncrementScript.Load(ctx, s.client).Err(); err != nil {
+		return err
+	}
+
+	cmds, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for shortCode, delta := range counts {
+			redisIncrementScript.EvalSha(ctx, pipe, []string{s.urlKey(shortCode)}, delta)
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	// pipeline 中的命令各自执行，统计出错前后实际写入的部分
+	var applied uint64
+	for _, cmd := range cmds {
+		if cmd, ok := cmd.(*redis.Cmd); ok {
+			if added, err := cmd.Int64(); err == nil && added > 0 {
+				applied += uint64(added)
+			}
+		}
+	}
+	if applied > 0 {
+		return &PartialCountError{Applied: applied, Err: err}
+	}
+	return err
+}
+
+// AddVariantClicks 通过 pipeline 一次往返批量累加各版本的访问次数
+func (s *RedisStorage) AddVariantClicks(counts map[string]map[string]uint64) error {
+	ctx := context.Background()
+
+	if err := redisVariantScript.Load(ctx, s.client).Err(); err != nil {
+		return err
+	}
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for shortCode, variants := range counts {
+			for name, delta := range variants {
+				redisVariantScript.EvalSha(ctx, pipe, []string{s.urlKey(shortCode)}, name, delta)
+			}
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Update 替换记录的可变字段并追加修改历史，版本的访问次数字段不在可变字段中，同名版本的计数因此保留
+func (s *RedisStorage) Update(url *models.URL, revisions ...*models.Revision) (*models.URL, error) {
+	ctx := context.Background()
+
+	expected := ""
+	if len(revisions) > 0 {
+		if !nextRevisions(revisions[0].Number-1, revisions) {
+			return nil, ErrRevisionConflict
+		}
+		expected = strconv.Itoa(revisions[0].Number - 1)
+	}
+
+	args := []interface{}{url.ShortCode, expected, len(revisions)}
+	for _, revision := range revisions {
+		data, err := json.Marshal(revision)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, data)
+	}
+	args = append(args, redisExpiryScore(url))
+	args = append(args, redisMutableFields(url)...)
+
+	result, err := redisUpdateScript.Run(ctx, s.client, s.indexKeys(url.ShortCode), args...).Int()
+	if err != nil {
+		return nil, err
+	}
+	switch result {
+	case -1:
+		return nil, ErrURLNotFound
+	case -2:
+		return nil, ErrRevisionConflict
+	}
+
+	return s.GetByShortCode(url.ShortCode)
+}
+
+// GetRevisions 读取修改历史列表
+func (s *RedisStorage) GetRevisions(shortCode string) ([]*models.Revision, error) {
+	items, err := s.client.LRange(context.Background(), s.revisionsKey(shortCode), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*models.Revision, 0, len(items))
+	for _, item := range items {
+		var revision models.Revision
+		if err := json.Unmarshal([]byte(item), &revision); err != nil {
+			return nil, fmt.Errorf("decode revision of %q: %w", shortCode, err)
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, nil
+}
+
+// Delete 删除 URL 记录及其索引和修改历史，并记下短码
+func (s *RedisStorage) Delete(shortCode string) error {
+	return s.delete(shortCode, time.Time{})
+}
+
+// DeleteIfDue 在删除脚本中按过期索引的分数确认记录仍然需要清理
+func (s *RedisStorage) DeleteIfDue(shortCode string, before time.Time) error {
+	return s.delete(shortCode, before)
+}
+
+// delete 执行删除脚本，before 不为零值时只删除清理时间早于 before 的记录
+func (s *RedisStorage) delete(shortCode string, before time.Time) error {
+	var limit string
+	if !before.IsZero() {
+		limit = strconv.FormatInt(before.UnixMilli(), 10)
+	}
+	now := strconv.FormatInt(deletionTime(before).UnixMilli(), 10)
+	deleted, err := redisDeleteScript.Run(context.Background(), s.client, s.indexKeys(shortCode), shortCode, limit, now).Int()
+	if err != nil {
+		return err
+	}
+	switch deleted {
+	case 0:
+		return ErrURLNotFound
+	case -1:
+		return ErrNotDue
+	}
+
+	return nil
+}
+
+// DeletionReason 读取删除原因哈希，早期版本删除的短码只在已删除集合中
+func (s *RedisStorage) DeletionReason(shortCode string) (string, error) {
+	ctx := context.Background()
+
+	reason, err := s.client.HGet(ctx, s.key("deletion_reasons"), shortCode).Result()
+	if err == nil {
+		return reason, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+
+	deleted, err := s.client.SIsMember(ctx, s.key("deleted"), shortCode).Result()
+	if err != nil {
+		return "", err
+	}
+	if !deleted {
+		return "", ErrURLNotFound
+	}
+	return "", nil
+}
+
+// ListExpired 从过期索引（有序集合）中按清理时间顺序取出在 before 之前过期或应被清除的记录
+func (s *RedisStorage) ListExpired(before time.Time, limit int) ([]*models.URL, error) {
+	ctx := context.Background()
+
+	shortCodes, err := s.client.ZRangeByScore(ctx, s.key("expiry"), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(before.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*models.URL, 0, len(shortCodes))
+	for _, shortCode := range shortCodes {
+		url, err := s.GetByShortCode(shortCode)
+		if errors.Is(err, ErrURLNotFound) {
+			// 记录已被其他途径删除，清掉残留的索引项，避免一直占用批次
+			if err := s.client.ZRem(ctx, s.key("expiry"), shortCode).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// GetStats 获取存储统计信息
+func (s *RedisStorage) GetStats() (map[string]interface{}, error) {
+	ctx := context.Background()
+
+	total, err := s.client.HLen(ctx, s.key("ids")).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := s.client.Get(ctx, s.key("next_id")).Uint64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var trashed, disabled, deleted *redis.IntCmd
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		trashed = pipe.SCard(ctx, s.key("trash"))
+		disabled = pipe.SCard(ctx, s.key("disabled"))
+		deleted = pipe.SCard(ctx, s.key("deleted"))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"total_urls":    total,
+		"trashed_urls":  trashed.Val(),
+		"disabled_urls": disabled.Val(),
+		"deleted_codes": deleted.Val(),
+		"next_id":       lastID + 1,
+	}, nil
+}
+
+// GetAllURLs 获取所有 URL 记录，按 ID 排序
+func (s *RedisStorage) GetAllURLs() ([]*models.URL, error) {
+	ctx := context.Background()
+
+	shortCodes, err := s.client.HVals(ctx, s.key("ids")).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用 pipeline 批量读取，避免逐条往返
+	cmds := make([]*redis.MapStringStringCmd, len(shortCodes))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, shortCode := range shortCodes {
+			cmds[i] = pipe.HGetAll(ctx, s.urlKey(shortCode))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*models.URL, 0, len(cmds))
+	for _, cmd := range cmds {
+		url, err := parseRedisURL(cmd.Val())
+		if errors.Is(err, ErrURLNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	return urls, nil
+}
+
+// Close 关闭 Redis 连接
+func (s *RedisStorage) Close() error {
+	return s.client.Close()
+}
+
+// PublishInvalidation 通过 Pub/Sub 通知共用同一 Redis 的所有实例短码的记录已修改
+func (s *RedisStorage) PublishInvalidation(shortCode string) error {
+	return s.client.Publish(context.Background(), s.key("invalidations"), shortCode).Err()
+}
+
+// SubscribeInvalidations 订阅失效通知。连接中断后 go-redis 会重新订阅，
+// 每次订阅成功时以空短码调用 handler，因为中断期间的通知已经丢失
+func (s *RedisStorage) SubscribeInvalidations(handler func(shortCode string)) func() {
+	ctx := context.Background()
+	pubsub := s.client.Subscribe(ctx, s.key("invalidations"))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			message, err := pubsub.Receive(ctx)
+			if err != nil {
+				if errors.Is(err, redis.ErrClosed) {
+					return
+				}
+				select {
+				case <-stop:
+					return
+				case <-time.After(redisInvalidationRetry):
+				}
+				continue
+			}
+
+			switch message := message.(type) {
+			case *redis.Subscription:
+				if message.Kind == "subscribe" {
+					handler("")
+				}
+			case *redis.Message:
+				handler(message.Payload)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		pubsub.Close()
+		<-done
+	}
+}
+
+// key 为键名加上命名空间前缀
+func (s *RedisStorage) key(name string) string {
+	return s.prefix + name
+}
+
+// indexKeys 返回写入、修改和删除脚本使用的键：原始 URL 索引、ID 索引、记录哈希、过期索引、修改历史，
+// 以及已删除短码、回收站和禁用集合
+func (s *RedisStorage) indexKeys(shortCode string) []string {
+	return []string{
+		s.key("originals"), s.key("ids"), s.urlKey(shortCode), s.key("expiry"), s.revisionsKey(shortCode),
+		s.key("deleted"), s.key("trash"), s.key("disabled"), s.key("deletion_reasons"),
+	}
+}
+
+// revisionsKey 返回修改历史列表的键名
+func (s *RedisStorage) revisionsKey(shortCode string) string {
+	return s.key("revisions:" + shortCode)
+}
+
+// redisMutableFields 返回记录哈希中可以通过 Update 修改的字段和值，未设置的可选字段不写入
+func redisMutableFields(url *models.URL) []interface{} {
+	fields := []interface{}{
+		"original_url", url.OriginalURL,
+		"max_clicks", url.MaxClicks,
+	}
+	for name, value := range map[string]*time.Time{
+		"expires_at":    url.ExpiresAt,
+		"activate_at":   url.ActivateAt,
+		"deactivate_at": url.DeactivateAt,
+		"updated_at":    url.UpdatedAt,
+		"deleted_at":    url.DeletedAt,
+		"purge_at":      url.PurgeAt,
+		"disabled_at":   url.DisabledAt,
+	} {
+		if value != nil {
+			fields = append(fields, name, value.Format(time.RFC3339Nano))
+		}
+	}
+	if url.FallbackURL != "" {
+		fields = append(fields, "fallback_url", url.FallbackURL)
+	}
+	if url.PasswordHash != "" {
+		fields = append(fields, "password_hash", url.PasswordHash)
+	}
+	if url.RedirectType != 0 {
+		fields = append(fields, "redirect_type", url.RedirectType)
+	}
+	if url.DisabledReason != "" {
+		fields = append(fields, "disabled_reason", url.DisabledReason)
+	}
+	if url.QueryPassthrough != "" {
+		fields = append(fields, "query_passthrough", url.QueryPassthrough)
+	}
+	if url.PathPassthrough {
+		fields = append(fields, "path_passthrough", url.PathPassthrough)
+	}
+	if url.Template {
+		fields = append(fields, "template", url.Template)
+	}
+	// 规则和版本只包含字符串和整数，编码不会失败；版本的访问次数单独保存在 variant_clicks:<版本名> 字段中
+	if rules, _ := encodeJSONArray(url.Rules); rules != "" {
+		fields = append(fields, "rules", rules)
+	}
+	if variants, _ := encodeJSONArray(models.CloneVariants(url.Variants, false)); variants != "" {
+		fields = append(fields, "variants", variants)
+	}
+
+	return fields
+}
+
+// redisExpiryScore 返回过期索引中的分数（清理时间的 Unix 毫秒），不需要清理时为空
+func redisExpiryScore(url *models.URL) string {
+	reapAt := url.ReapAt()
+	if reapAt == nil {
+		return ""
+	}
+	return strconv.FormatInt(reapAt.UnixMilli(), 10)
+}
+
+// urlKey 返回记录哈希的键名
+func (s *RedisStorage) urlKey(shortCode string) string {
+	return s.key("url:" + shortCode)
+}
+
+// parseRedisURL 将哈希字段解析为 URL 记录
+func parseRedisURL(fields map[string]string) (*models.URL, error) {
+	if len(fields) == 0 {
+		return nil, ErrURLNotFound
+	}
+
+	id, err := strconv.ParseUint(fields["id"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse id: %w", err)
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, fields["created_at"])
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at: %w", err)
+	}
+
+	accessCount, err := strconv.ParseUint(fields["access_count"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse access_count: %w", err)
+	}
+
+	url := &models.URL{
+		ID:          id,
+		OriginalURL: fields["original_url"],
+		ShortCode:   fields["short_code"],
+		CreatedAt:   createdAt,
+		AccessCount: accessCount,
+		Custom:      fields["custom"] == "1",
+		FallbackURL: fields["fallback_url"],
+
+		PasswordHash: fields["password_hash"],
+
+		DisabledReason: fields["disabled_reason"],
+
+		QueryPassthrough: fields["query_passthrough"],
+		PathPassthrough:  fields["path_passthrough"] == "1",
+
+		Template: fields["template"] == "1",
+	}
+
+	if value, ok := fields["rules"]; ok {
+		if err := json.Unmarshal([]byte(value), &url.Rules); err != nil {
+			return nil, fmt.Errorf("parse rules: %w", err)
+		}
+	}
+
+	if value, ok := fields["variants"]; ok {
+		if err := json.Unmarshal([]byte(value), &url.Variants); err != nil {
+			return nil, fmt.Errorf("parse variants: %w", err)
+		}
+		for i := range url.Variants {
+			clicks, ok := fields[redisVariantClicksPrefix+url.Variants[i].Name]
+			if !ok {
+				continue
+			}
+			if url.Variants[i].Clicks, err = strconv.ParseUint(clicks, 10, 64); err != nil {
+				return nil, fmt.Errorf("parse variant clicks: %w", err)
+			}
+		}
+	}
+
+	if value, ok := fields["max_clicks"]; ok {
+		if url.MaxClicks, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("parse max_clicks: %w", err)
+		}
+	}
+
+	if value, ok := fields["redirect_type"]; ok {
+		if url.RedirectType, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("parse redirect_type: %w", err)
+		}
+	}
+
+	for name, dest := range map[string]**time.Time{
+		"expires_at":    &url.ExpiresAt,
+		"activate_at":   &url.ActivateAt,
+		"deactivate_at": &url.DeactivateAt,
+		"updated_at":    &url.UpdatedAt,
+		"deleted_at":    &url.DeletedAt,
+		"purge_at":      &url.PurgeAt,
+		"disabled_at":   &url.DisabledAt,
+	} {
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		*dest = &parsed
+	}
+
+	return url, nil
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/utils"
+)
+
+func newTestRedisStorage(t *testing.T, server *miniredis.Miniredis) *RedisStorage {
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	store, err := NewRedisStorage(client, "test:")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRedisStorage(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return newTestRedisStorage(t, miniredis.RunT(t))
+	})
+}
+
+func TestRedisStorage_SharedAcrossInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := newTestRedisStorage(t, server)
+	second := newTestRedisStorage(t, server)
+
+	// 两个实例分配的 ID 不会冲突
+	a, err := saveURL(first, "https://www.example.com/a")
+	require.NoError(t, err)
+	b, err := saveURL(second, "https://www.example.com/b")
+	require.NoError(t, err)
+	assert.NotEqual(t, a.ShortCode, b.ShortCode)
+
+	// 在一个实例上创建的链接可以在另一个实例上访问和计数
+	require.NoError(t, second.IncrementAccessCount(a.ShortCode))
+	record, err := first.GetByShortCode(a.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, a.OriginalURL, record.OriginalURL)
+	assert.Equal(t, uint64(1), record.AccessCount)
+
+	// 去重同样跨实例生效
+	again, err := saveURL(second, "https://www.example.com/a")
+	require.NoError(t, err)
+	assert.Equal(t, a.ID, again.ID)
+}
+
+func TestRedisStorage_PartialAccessCounts(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := newTestRedisStorage(t, server)
+
+	a, err := saveURL(store, "https://www.example.com/a")
+	require.NoError(t, err)
+	// 类型错误的键让 pipeline 中的一条命令失败，其余命令照常执行
+	require.NoError(t, server.Set(store.urlKey("broken"), "not a hash"))
+
+	// 不存在的短码被忽略，不计入已写入的点击
+	err = store.AddAccessCounts(map[string]uint64{a.ShortCode: 2, "broken": 3, "missing": 4})
+	var partial *PartialCountError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, uint64(2), partial.Applied)
+
+	record, err := store.GetByShortCode(a.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), record.AccessCount)
+}
+
+func TestRedisStorage_CrossInstanceCacheInvalidation(t *testing.T) {
+	server := miniredis.RunT(t)
+	config := CacheConfig{Size: 100, TTL: time.Hour, NegativeTTL: time.Hour}
+	first := NewCachedStore(newTestRedisStorage(t, server), config)
+	second := NewCachedStore(newTestRedisStorage(t, server), config)
+	t.Cleanup(func() {
+		first.Close()
+		second.Close()
+	})
+
+	// 第二个实例先缓存“不存在”，第一个实例创建后通知它失效
+	id, err := first.NextID()
+	require.NoError(t, err)
+	code := utils.EncodeBase62(id)
+	_, err = second.GetByShortCode(code)
+	require.Equal(t, ErrURLNotFound, err)
+	saved, err := first.Save(&models.URL{ID: id, OriginalURL: "https://www.example.com", ShortCode: code, CreatedAt: time.Now()})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := second.GetByShortCode(code)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// 在第一个实例上修改，第二个实例不会一直读到缓存中的旧记录
+	changed := saved.Clone()
+	changed.OriginalURL = "https://www.example.com/changed"
+	_, err = first.Update(changed)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		url, err := second.GetByShortCode(code)
+		return err == nil && url.OriginalURL == changed.OriginalURL
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, first.Delete(code))
+	assert.Eventually(t, func() bool {
+		_, err := second.GetByShortCode(code)
+		return err == ErrURLNotFound
+	}, time.Second, 10*time.Millisecond)
+
+	stats, err := second.GetStats()
+	require.NoError(t, err)
+	assert.NotZero(t, stats["cache"].(map[string]interface{})["invalidations"])
+}
+
+func TestRedisStorage_Unreachable(t *testing.T) {
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+	server.Close()
+
+	_, err := NewRedisStorage(redis.NewClient(&redis.Options{Addr: addr}), "test:")
+	assert.Error(t, err)
+}
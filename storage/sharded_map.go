@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"sync"
+
+	"gin-url-shortener/models"
+)
+
+// mapShard 分片映射中的一个分片，拥有独立的读写锁
+type mapShard[K comparable] struct {
+	mutex sync.RWMutex
+	items map[K]*models.URL
+
+	// 填充到 64 字节，让每个分片独占一个缓存行，避免相邻分片的锁互相干扰（false sharing）
+	_ [32]byte
+}
+
+// shardedMap 按键哈希分片的并发安全映射，不同分片上的操作互不阻塞
+type shardedMap[K comparable] struct {
+	shards []mapShard[K]
+	mask   uint64
+	hash   func(K) uint64
+}
+
+// newShardedMap 创建分片映射，分片数量会向上取整为 2 的幂
+func newShardedMap[K comparable](shardCount int, hash func(K) uint64) *shardedMap[K] {
+	size := 1
+	for size < shardCount {
+		size <<= 1
+	}
+
+	m := &shardedMap[K]{
+		shards: make([]mapShard[K], size),
+		mask:   uint64(size - 1),
+		hash:   hash,
+	}
+	for i := range m.shards {
+		m.shards[i].items = make(map[K]*models.URL)
+	}
+
+	return m
+}
+
+// shard 返回键所在的分片
+func (m *shardedMap[K]) shard(key K) *mapShard[K] {
+	return &m.shards[m.hash(key)&m.mask]
+}
+
+// get 读取键对应的记录
+func (m *shardedMap[K]) get(key K) (*models.URL, bool) {
+	shard := m.shard(key)
+	shard.mutex.RLock()
+	url, exists := shard.items[key]
+	shard.mutex.RUnlock()
+
+	return url, exists
+}
+
+// set 写入键对应的记录
+func (m *shardedMap[K]) set(key K, url *models.URL) {
+	shard := m.shard(key)
+	shard.mutex.Lock()
+	shard.items[key] = url
+	shard.mutex.Unlock()
+}
+
+// remove 删除键对应的记录，只有当前值就是 url 时才删除
+func (m *shardedMap[K]) remove(key K, url *models.URL) {
+	shard := m.shard(key)
+	shard.mutex.Lock()
+	if shard.items[key] == url {
+		delete(shard.items, key)
+	}
+	shard.mutex.Unlock()
+}
+
+// len 返回所有分片的记录总数
+func (m *shardedMap[K]) len() int {
+	total := 0
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mutex.RLock()
+		total += len(shard.items)
+		shard.mutex.RUnlock()
+	}
+
+	return total
+}
+
+// each 依次遍历所有记录，遍历期间逐个持有分片读锁
+func (m *shardedMap[K]) each(fn func(url *models.URL)) {
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mutex.RLock()
+		for _, url := range shard.items {
+			fn(url)
+		}
+		shard.mutex.RUnlock()
+	}
+}
+
+// hashString FNV-1a 字符串哈希
+func hashString(s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	hash := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= prime64
+	}
+
+	return hash
+}
+
+// hashID 顺序 ID 本身分布均匀，直接使用
+func hashID(id uint64) uint64 {
+	return id
+}
@@ -0,0 +1,662 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"gin-url-shortener/models"
+)
+
+// sqliteMigrations 按顺序执行的数据库迁移，已执行的版本记录在 PRAGMA user_version 中。
+// 只能在末尾追加新的迁移，不能修改已发布的迁移。
+var sqliteMigrations = []string{
+	// 1: 初始表结构，AUTOINCREMENT 保证删除后 ID 不会被复用
+	`CREATE TABLE urls (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		original_url TEXT     NOT NULL,
+		short_code   TEXT     UNIQUE,
+		created_at   DATETIME NOT NULL,
+		access_count INTEGER  NOT NULL DEFAULT 0
+	);
+	CREATE UNIQUE INDEX idx_urls_original_url ON urls (original_url);`,
+
+	// 2: 短码改由调用方生成，ID 从独立的序列表分配，不再依赖插入时的自增
+	`CREATE TABLE id_sequence (value INTEGER NOT NULL);
+	INSERT INTO id_sequence (value)
+		SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'urls'), 0);`,
+
+	// 3: 自定义别名不参与原始 URL 去重，唯一索引只约束普通链接
+	`ALTER TABLE urls ADD COLUMN custom INTEGER NOT NULL DEFAULT 0;
+	DROP INDEX idx_urls_original_url;
+	CREATE UNIQUE INDEX idx_urls_original_url ON urls (original_url) WHERE custom = 0;`,
+
+	// 4: 链接过期时间；带过期时间的链接同样不参与去重，改用 dedup 列标记参与去重的记录
+	`ALTER TABLE urls ADD COLUMN expires_at DATETIME;
+	ALTER TABLE urls ADD COLUMN dedup INTEGER NOT NULL DEFAULT 1;
+	UPDATE urls SET dedup = 0 WHERE custom = 1;
+	DROP INDEX idx_urls_original_url;
+	CREATE UNIQUE INDEX idx_urls_original_url ON urls (original_url) WHERE dedup = 1;
+	CREATE INDEX idx_urls_expires_at ON urls (expires_at) WHERE expires_at IS NOT NULL;`,
+
+	// 5: 访问次数限制，0 表示不限
+	`ALTER TABLE urls ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0;`,
+
+	// 6: 生效时间窗口和窗口外的跳转地址
+	`ALTER TABLE urls ADD COLUMN activate_at DATETIME;
+	ALTER TABLE urls ADD COLUMN deactivate_at DATETIME;
+	ALTER TABLE urls ADD COLUMN fallback_url TEXT NOT NULL DEFAULT '';`,
+
+	// 7: 访问密码的哈希
+	`ALTER TABLE urls ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';`,
+
+	// 8: 重定向状态码，0 表示使用全局配置
+	`ALTER TABLE urls ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 0;`,
+
+	// 9: 修改时间和修改历史，历史版本以 JSON 保存，随记录一起删除
+	`ALTER TABLE urls ADD COLUMN updated_at DATETIME;
+	CREATE TABLE url_revisions (
+		short_code TEXT    NOT NULL REFERENCES urls (short_code) ON DELETE CASCADE,
+		revision   INTEGER NOT NULL,
+		data       TEXT    NOT NULL,
+		PRIMARY KEY (short_code, revision)
+	);`,
+
+	// 10: 回收站和禁用状态；后台清理改按 reap_at（过期与清除时间中较早者）查询，
+	// 已删除的短码记录在 deleted_codes 中，不会再次分配
+	`ALTER TABLE urls ADD COLUMN deleted_at DATETIME;
+	ALTER TABLE urls ADD COLUMN purge_at DATETIME;
+	ALTER TABLE urls ADD COLUMN disabled_at DATETIME;
+	ALTER TABLE urls ADD COLUMN disabled_reason TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN reap_at DATETIME;
+	UPDATE urls SET reap_at = expires_at;
+	DROP INDEX idx_urls_expires_at;
+	CREATE INDEX idx_urls_reap_at ON urls (reap_at) WHERE reap_at IS NOT NULL;
+	CREATE TABLE deleted_codes (short_code TEXT PRIMARY KEY);`,
+
+	// 11: 转发访问请求中的查询参数和路径
+	`ALTER TABLE urls ADD COLUMN query_passthrough TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN path_passthrough INTEGER NOT NULL DEFAULT 0;`,
+
+	// 12: 带占位符的模板目标地址
+	`ALTER TABLE urls ADD COLUMN template INTEGER NOT NULL DEFAULT 0;`,
+
+	// 13: 跳转规则，以 JSON 数组保存
+	`ALTER TABLE urls ADD COLUMN rules TEXT NOT NULL DEFAULT '';`,
+
+	// 14: A/B 测试的版本，以 JSON 数组保存，各版本的访问次数也在其中
+	`ALTER TABLE urls ADD COLUMN variants TEXT NOT NULL DEFAULT '';`,
+
+	// 15: 已删除短码的删除原因，之前删除的短码为空
+	`ALTER TABLE deleted_codes ADD COLUMN reason TEXT NOT NULL DEFAULT '';`,
+}
+
+// sqliteURLColumns 读取 URL 记录时查询的列，顺序与 scanURL 一致
+const sqliteURLColumns = "id, original_url, short_code, created_at, access_count, custom, expires_at, max_clicks, activate_at, deactivate_at, fallback_url, password_hash, redirect_type, updated_at, deleted_at, purge_at, disabled_at, disabled_reason, query_passthrough, path_passthrough, template, rules, variants"
+
+// SQLiteStorage 基于嵌入式 SQLite 文件的持久化存储实现
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteStorage 打开（或创建）SQLite 数据库文件并执行未完成的迁移
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create database directory: %w", err)
+		}
+	}
+
+	// WAL 模式允许读写并发；_txlock=immediate 让写事务一开始就获取写锁，
+	// 避免 Save 中“先查后插”在并发下升级锁失败
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate&_foreign_keys=on", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// migrate 执行尚未应用的迁移
+func (s *SQLiteStorage) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(sqliteMigrations))
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("begin migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+
+		// PRAGMA 不支持参数绑定
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// NextID 从序列表分配 ID
+func (s *SQLiteStorage) NextID() (uint64, error) {
+	var id uint64
+	err := s.db.QueryRow("UPDATE id_sequence SET value = value + 1 RETURNING value").Scan(&id)
+	return id, err
+}
+
+// Save 保存 URL 记录
+func (s *SQLiteStorage) Save(url *models.URL) (*models.URL, error) {
+	rules, err := encodeJSONArray(url.Rules)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := encodeJSONArray(url.Variants)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 检查是否已存在相同的原始 URL，别名等带额外设置的链接不参与去重
+	dedup := url.Deduplicable()
+	if dedup {
+		existingURL, err := scanURL(tx.QueryRow(
+			"SELECT "+sqliteURLColumns+" FROM urls WHERE original_url = ? AND dedup = 1",
+			url.OriginalURL,
+		))
+		if err == nil {
+			return existingURL, nil
+		}
+		if !errors.Is(err, ErrURLNotFound) {
+			return nil, err
+		}
+	}
+
+	// 写事务一开始就持有写锁，检查短码占用和插入之间不会有其他写入；已删除的短码同样视为占用
+	var taken bool
+	if err := tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM urls WHERE short_code = ?1) OR EXISTS (SELECT 1 FROM deleted_codes WHERE short_code = ?1)",
+		url.ShortCode,
+	).Scan(&taken); err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrCodeExists
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO urls ("+sqliteURLColumns+", dedup, reap_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		url.ID, url.OriginalURL, url.ShortCode, url.CreatedAt, url.AccessCount, url.Custom, utcTime(url.ExpiresAt), url.MaxClicks,
+		utcTime(url.ActivateAt), utcTime(url.DeactivateAt), url.FallbackURL, url.PasswordHash, url.RedirectType, utcTime(url.UpdatedAt),
+		utcTime(url.DeletedAt), utcTime(url.PurgeAt), utcTime(url.DisabledAt), url.DisabledReason, url.QueryPassthrough, url.PathPassthrough,
+		url.Template, rules, variants, dedup, utcTime(url.ReapAt()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+// GetByShortCode 根据短码获取 URL 记录
+func (s *SQLiteStorage) GetByShortCode(shortCode string) (*models.URL, error) {
+	return scanURL(s.db.QueryRow(
+		"SELECT "+sqliteURLColumns+" FROM urls WHERE short_code = ?",
+		shortCode,
+	))
+}
+
+// GetByOriginalURL 根据原始 URL 获取 URL 记录
+func (s *SQLiteStorage) GetByOriginalURL(originalURL string) (*models.URL, error) {
+	return scanURL(s.db.QueryRow(
+		"SELECT "+sqliteURLColumns+" FROM urls WHERE original_url = ? AND dedup = 1",
+		originalURL,
+	))
+}
+
+// GetByID 根据 ID 获取 URL 记录
+func (s *SQLiteStorage) GetByID(id uint64) (*models.URL, error) {
+	return scanURL(s.db.QueryRow(
+		"SELECT "+sqliteURLColumns+" FROM urls WHERE id = ?",
+		id,
+	))
+}
+
+// IncrementAccessCount 增加访问计数，单条 UPDATE 语句保证原子性，次数限制在同一条语句中检查
+func (s *SQLiteStorage) IncrementAccessCount(shortCode string) error {
+	result, err := s.db.Exec(
+		"UPDATE urls SET access_count = access_count + 1 WHERE short_code = ? AND (max_clicks = 0 OR access_count < max_clicks)",
+		shortCode,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// 没有更新任何行：要么记录不存在，要么次数已用完
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM urls WHERE short_code = ?)", shortCode).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrURLNotFound
+	}
+	return ErrClickLimitReached
+}
+
+// AddAccessCounts 在一个事务中批量累加访问计数
+func (s *SQLiteStorage) AddAccessCounts(counts map[string]uint64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE urls SET access_count = CASE
+		WHEN max_clicks = 0 THEN access_count + ?1
+		ELSE MAX(access_count, MIN(access_count + ?1, max_clicks))
+	END WHERE short_code = ?2`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for shortCode, delta := range counts {
+		if _, err := stmt.Exec(delta, shortCode); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddVariantClicks 在一个事务中批量累加各版本的访问次数
+func (s *SQLiteStorage) AddVariantClicks(counts map[string]map[string]uint64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for shortCode, deltas := range counts {
+		variants, err := s.variantsTx(tx, shortCode)
+		if errors.Is(err, ErrURLNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		url := &models.URL{Variants: variants}
+		changed := false
+		for name, delta := range deltas {
+			if delta > 0 && url.AddVariantClicks(name, delta) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		encoded, err := encodeJSONArray(url.Variants)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE urls SET variants = ? WHERE short_code = ?", encoded, shortCode); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// variantsTx 在事务中读取记录当前的版本列表
+func (s *SQLiteStorage) variantsTx(tx *sql.Tx, shortCode string) ([]models.Variant, error) {
+	var encoded string
+	err := tx.QueryRow("SELECT variants FROM urls WHERE short_code = ?", shortCode).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []models.Variant
+	if encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &variants); err != nil {
+			return nil, fmt.Errorf("decode variants: %w", err)
+		}
+	}
+	return variants, nil
+}
+
+// Update 在一个事务中修改记录并追加修改历史，修改过的记录不再参与去重
+func (s *SQLiteStorage) Update(url *models.URL, revisions ...*models.Revision) (*models.URL, error) {
+	rules, err := encodeJSONArray(url.Rules)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := encodeJSONArray(url.Variants)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 写事务一开始就持有写锁，版本号检查之后不会有其他写入
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM url_revisions WHERE short_code = ?", url.ShortCode).Scan(&count); err != nil {
+		return nil, err
+	}
+	if !nextRevisions(count, revisions) {
+		return nil, ErrRevisionConflict
+	}
+
+	// 同名版本保留已有的访问次数
+	if len(url.Variants) > 0 {
+		current, err := s.variantsTx(tx, url.ShortCode)
+		if err != nil {
+			return nil, err
+		}
+		merged := &models.URL{Variants: models.CloneVariants(url.Variants, false)}
+		merged.CopyVariantClicks(&models.URL{Variants: current})
+		if variants, err = encodeJSONArray(merged.Variants); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := tx.Exec(
+		`UPDATE urls SET original_url = ?, expires_at = ?, max_clicks = ?, activate_at = ?, deactivate_at = ?,
+			fallback_url = ?, password_hash = ?, redirect_type = ?, updated_at = ?, deleted_at = ?, purge_at = ?,
+			disabled_at = ?, disabled_reason = ?, query_passthrough = ?, path_passthrough = ?, template = ?, rules = ?, variants = ?, reap_at = ?, dedup = 0
+		WHERE short_code = ?`,
+		url.OriginalURL, utcTime(url.ExpiresAt), url.MaxClicks, utcTime(url.ActivateAt), utcTime(url.DeactivateAt),
+		url.FallbackURL, url.PasswordHash, url.RedirectType, utcTime(url.UpdatedAt), utcTime(url.DeletedAt), utcTime(url.PurgeAt),
+		utcTime(url.DisabledAt), url.DisabledReason, url.QueryPassthrough, url.PathPassthrough, url.Template,
+		rules, variants, utcTime(url.ReapAt()), url.ShortCode,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, ErrURLNotFound
+	}
+
+	for _, revision := range revisions {
+		data, err := json.Marshal(revision)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO url_revisions (short_code, revision, data) VALUES (?, ?, ?)",
+			url.ShortCode, revision.Number, string(data),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := scanURL(tx.QueryRow("SELECT "+sqliteURLColumns+" FROM urls WHERE short_code = ?", url.ShortCode))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// GetRevisions 按版本号顺序读取修改历史
+func (s *SQLiteStorage) GetRevisions(shortCode string) ([]*models.Revision, error) {
+	rows, err := s.db.Query("SELECT data FROM url_revisions WHERE short_code = ? ORDER BY revision", shortCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]*models.Revision, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var revision models.Revision
+		if err := json.Unmarshal([]byte(data), &revision); err != nil {
+			return nil, fmt.Errorf("decode revision: %w", err)
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// Delete 删除 URL 记录并记下短码，修改历史通过外键级联删除
+func (s *SQLiteStorage) Delete(shortCode string) error {
+	return s.delete(shortCode, time.Time{})
+}
+
+// DeleteIfDue 在同一条 DELETE 中检查 reap_at，记录在列出之后被延期时不删除
+func (s *SQLiteStorage) DeleteIfDue(shortCode string, before time.Time) error {
+	return s.delete(shortCode, before)
+}
+
+// delete 删除记录，before 不为零值时只删除 reap_at 早于 before 的记录
+func (s *SQLiteStorage) delete(shortCode string, before time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 删除原因在同一条语句中按被删除的行判断，与 deletionReason 一致
+	const returning = ` RETURNING CASE WHEN deleted_at IS NOT NULL THEN '` + DeletionPurged +
+		`' WHEN expires_at <= ?2 THEN '` + DeletionExpired + `' ELSE '` + DeletionRemoved + `' END`
+	var reason string
+	if before.IsZero() {
+		err = tx.QueryRow("DELETE FROM urls WHERE short_code = ?1"+returning, shortCode, time.Now().UTC()).Scan(&reason)
+	} else {
+		err = tx.QueryRow("DELETE FROM urls WHERE short_code = ?1 AND reap_at < ?2"+returning, shortCode, before.UTC()).Scan(&reason)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM urls WHERE short_code = ?", shortCode).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrNotDue
+		}
+		return ErrURLNotFound
+	}
+
+	if _, err := tx.Exec("INSERT OR IGNORE INTO deleted_codes (short_code, reason) VALUES (?, ?)", shortCode, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeletionReason 查询 deleted_codes 中记录的删除原因
+func (s *SQLiteStorage) DeletionReason(shortCode string) (string, error) {
+	var reason string
+	err := s.db.QueryRow("SELECT reason FROM deleted_codes WHERE short_code = ?", shortCode).Scan(&reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrURLNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return reason, nil
+}
+
+// ListExpired 按清理时间顺序查询已过期或应从回收站清除的记录，走 reap_at 上的部分索引
+func (s *SQLiteStorage) ListExpired(before time.Time, limit int) ([]*models.URL, error) {
+	return s.queryURLs(
+		"SELECT "+sqliteURLColumns+" FROM urls WHERE reap_at < ? ORDER BY reap_at LIMIT ?",
+		before.UTC(), limit,
+	)
+}
+
+// GetStats 获取存储统计信息
+func (s *SQLiteStorage) GetStats() (map[string]interface{}, error) {
+	var total, trashed, disabled, deleted int
+	if err := s.db.QueryRow(
+		`SELECT COUNT(*), COUNT(deleted_at), COUNT(disabled_at), (SELECT COUNT(*) FROM deleted_codes) FROM urls`,
+	).Scan(&total, &trashed, &disabled, &deleted); err != nil {
+		return nil, err
+	}
+
+	var lastID uint64
+	if err := s.db.QueryRow("SELECT value FROM id_sequence").Scan(&lastID); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"total_urls":    total,
+		"trashed_urls":  trashed,
+		"disabled_urls": disabled,
+		"deleted_codes": deleted,
+		"next_id":       lastID + 1,
+	}, nil
+}
+
+// GetAllURLs 获取所有 URL 记录
+func (s *SQLiteStorage) GetAllURLs() ([]*models.URL, error) {
+	return s.queryURLs("SELECT " + sqliteURLColumns + " FROM urls ORDER BY id")
+}
+
+// queryURLs 执行查询并读取所有 URL 记录
+func (s *SQLiteStorage) queryURLs(query string, args ...interface{}) ([]*models.URL, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := make([]*models.URL, 0)
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+// Close 关闭数据库连接
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanURL 从查询结果中读取一条 URL 记录
+func scanURL(row rowScanner) (*models.URL, error) {
+	var url models.URL
+	var rules, variants string
+	err := row.Scan(
+		&url.ID, &url.OriginalURL, &url.ShortCode, &url.CreatedAt, &url.AccessCount, &url.Custom, &url.ExpiresAt, &url.MaxClicks,
+		&url.ActivateAt, &url.DeactivateAt, &url.FallbackURL, &url.PasswordHash, &url.RedirectType, &url.UpdatedAt,
+		&url.DeletedAt, &url.PurgeAt, &url.DisabledAt, &url.DisabledReason, &url.QueryPassthrough, &url.PathPassthrough,
+		&url.Template, &rules, &variants,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rules != "" {
+		if err := json.Unmarshal([]byte(rules), &url.Rules); err != nil {
+			return nil, fmt.Errorf("decode rules: %w", err)
+		}
+	}
+	if variants != "" {
+		if err := json.Unmarshal([]byte(variants), &url.Variants); err != nil {
+			return nil, fmt.Errorf("decode variants: %w", err)
+		}
+	}
+
+	return &url, nil
+}
+
+// utcTime 统一以 UTC 写入时间，保证数据库中按字符串比较的顺序与时间顺序一致
+func utcTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// encodeJSONArray 把跳转规则、A/B 测试版本等列表编码为 JSON 数组，列表为空时为空字符串
+func encodeJSONArray[T any](items []T) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
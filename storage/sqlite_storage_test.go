@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLiteStorage(t *testing.T, path string) *SQLiteStorage {
+	store, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	return store
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestSQLiteStorage_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "test.db")
+
+	store := newTestSQLiteStorage(t, path)
+	saved, err := saveURL(store, "https://www.example.com")
+	require.NoError(t, err)
+	require.NoError(t, store.IncrementAccessCount(saved.ShortCode))
+	require.NoError(t, store.Close())
+
+	// 重新打开后数据仍然存在，迁移不会重复执行
+	store = newTestSQLiteStorage(t, path)
+	defer store.Close()
+
+	record, err := store.GetByShortCode(saved.ShortCode)
+	require.NoError(t, err)
+	assert.Equal(t, saved.OriginalURL, record.OriginalURL)
+	assert.Equal(t, uint64(1), record.AccessCount)
+
+	// ID 序列继续递增
+	next, err := saveURL(store, "https://www.example.com/next")
+	require.NoError(t, err)
+	assert.Equal(t, saved.ID+1, next.ID)
+}
+
+func TestSQLiteStorage_SchemaVersion(t *testing.T) {
+	store := newTestSQLiteStorage(t, filepath.Join(t.TempDir(), "test.db"))
+	defer store.Close()
+
+	var version int
+	require.NoError(t, store.db.QueryRow("PRAGMA user_version").Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+
+	// 数据库版本高于程序支持的版本时拒绝启动
+	_, err := store.db.Exec("PRAGMA user_version = 999")
+	require.NoError(t, err)
+	assert.Error(t, store.migrate())
+}
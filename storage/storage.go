@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gin-url-shortener/models"
+)
+
+// Store 短链接存储接口，所有存储后端都需要实现该接口
+type Store interface {
+	// NextID 分配一个新的全局唯一 ID，未使用的 ID 不会被回收
+	NextID() (uint64, error)
+
+	// Save 保存由调用方生成好 ID 和短码的记录。
+	// 相同的原始 URL 返回已存在的记录（自定义别名除外）；短码已被占用或删除过时返回 ErrCodeExists
+	Save(url *models.URL) (*models.URL, error)
+
+	// GetByOriginalURL 根据原始 URL 获取非别名的 URL 记录，不存在时返回 ErrURLNotFound
+	GetByOriginalURL(originalURL string) (*models.URL, error)
+
+	// GetByShortCode 根据短码获取 URL 记录，不存在时返回 ErrURLNotFound
+	GetByShortCode(shortCode string) (*models.URL, error)
+
+	// GetByID 根据 ID 获取 URL 记录，不存在时返回 ErrURLNotFound
+	GetByID(id uint64) (*models.URL, error)
+
+	// IncrementAccessCount 原子地增加访问计数；
+	// 访问次数已达到 MaxClicks 时不增加并返回 ErrClickLimitReached
+	IncrementAccessCount(shortCode string) error
+
+	// AddAccessCounts 批量累加访问计数（shortCode -> 增量），不存在的短码会被忽略，
+	// 限制了访问次数的记录最多累加到 MaxClicks。部分短码已经写入后出错时返回 *PartialCountError
+	AddAccessCounts(counts map[string]uint64) error
+
+	// AddVariantClicks 批量累加 A/B 测试各版本的访问次数（shortCode -> 版本名 -> 增量），
+	// 不存在的短码和版本会被忽略；链接本身的访问次数由 AddAccessCounts 单独累加
+	AddVariantClicks(counts map[string]map[string]uint64) error
+
+	// Update 用 url 的可变字段替换同一短码的记录，并追加 revisions 到修改历史，两者原子地完成。
+	// ID、创建时间和访问次数保持存储中的值，A/B 测试各版本的访问次数按版本名保留；记录会离开原始 URL 去重索引。
+	// revisions 的版本号必须紧接在已有历史之后，否则返回 ErrRevisionConflict；不存在时返回 ErrURLNotFound
+	Update(url *models.URL, revisions ...*models.Revision) (*models.URL, error)
+
+	// GetRevisions 按版本号从小到大返回短码的修改历史，没有修改过的记录返回空列表
+	GetRevisions(shortCode string) ([]*models.Revision, error)
+
+	// Delete 永久删除 URL 记录、修改历史及其所有索引，短码之后不会再被分配；不存在时返回 ErrURLNotFound
+	Delete(shortCode string) error
+
+	// DeleteIfDue 与 Delete 相同，但只在记录的清理时间（URL.ReapAt）仍早于 before 时删除，检查和删除原子地完成；
+	// 记录在列出之后被延期、恢复或取消了过期时间时返回 ErrNotDue
+	DeleteIfDue(shortCode string, before time.Time) error
+
+	// DeletionReason 返回短码被永久删除的原因（DeletionExpired 等），
+	// 没有被删除过时返回 ErrURLNotFound，早期版本删除的短码没有记录原因，返回空字符串
+	DeletionReason(shortCode string) (string, error)
+
+	// ListExpired 按清理时间（URL.ReapAt）从早到晚返回最多 limit 条在 before 之前过期或应从回收站清除的记录
+	ListExpired(before time.Time, limit int) ([]*models.URL, error)
+
+	// GetStats 获取存储统计信息，包括记录总数、回收站和禁用的记录数以及已删除的短码数
+	GetStats() (map[string]interface{}, error)
+
+	// GetAllURLs 获取所有 URL 记录
+	GetAllURLs() ([]*models.URL, error)
+
+	// Close 释放存储占用的资源（文件句柄、连接等）
+	Close() error
+}
+
+// 短码被永久删除的原因，与已删除的短码一起保存
+const (
+	DeletionExpired = "expired" // 过期后被清理
+	DeletionPurged  = "purged"  // 在回收站中超过保留期
+	DeletionRemoved = "removed" // 其他情况下被直接删除
+)
+
+// PartialCountError 批量累加访问计数时部分短码已经写入后出错，
+// Applied 为已经写入的点击数，其余的点击（包括因短码不存在或达到 MaxClicks 被忽略的）没有写入
+type PartialCountError struct {
+	Applied uint64
+	Err     error
+}
+
+func (e *PartialCountError) Error() string {
+	return fmt.Sprintf("%v (%d clicks applied)", e.Err, e.Applied)
+}
+
+func (e *PartialCountError) Unwrap() error {
+	return e.Err
+}
+
+// 编译期检查各实现是否满足 Store 接口
+var (
+	_ Store = (*MemoryStorage)(nil)
+	_ Store = (*SQLiteStorage)(nil)
+	_ Store = (*BoltStorage)(nil)
+	_ Store = (*RedisStorage)(nil)
+	_ Store = (*CachedStore)(nil)
+)
+
+// isDue 判断记录的清理时间是否早于 before，before 为零值时总是返回 true
+func isDue(url *models.URL, before time.Time) bool {
+	if before.IsZero() {
+		return true
+	}
+	reapAt := url.ReapAt()
+	return reapAt != nil && reapAt.Before(before)
+}
+
+// deletionReason 返回在 now 永久删除记录的原因
+func deletionReason(url *models.URL, now time.Time) string {
+	switch {
+	case url.DeletedAt != nil:
+		return DeletionPurged
+	case url.IsExpired(now):
+		return DeletionExpired
+	default:
+		return DeletionRemoved
+	}
+}
+
+// deletionTime 删除时判断原因用的时间，before 为零值时使用当前时间
+func deletionTime(before time.Time) time.Time {
+	if before.IsZero() {
+		return time.Now()
+	}
+	return before
+}
+
+// nextRevisions 检查 revisions 的版本号是否从已有的 count 个版本之后连续递增
+func nextRevisions(count int, revisions []*models.Revision) bool {
+	for i, revision := range revisions {
+		if revision.Number != count+i+1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,624 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gin-url-shortener/models"
+	"gin-url-shortener/utils"
+)
+
+// saveURL 按服务层的方式分配 ID、生成顺序短码后保存
+func saveURL(store Store, originalURL string) (*models.URL, error) {
+	id, err := store.NextID()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Save(&models.URL{
+		ID:          id,
+		OriginalURL: originalURL,
+		ShortCode:   utils.EncodeBase62(id),
+		CreatedAt:   time.Now(),
+	})
+}
+
+// testStore 存储后端一致性测试套件，每个 Store 实现都应通过
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("Save assigns sequential IDs", func(t *testing.T) {
+		store := newStore(t)
+
+		first, err := saveURL(store, "https://www.example.com/1")
+		require.NoError(t, err)
+		second, err := saveURL(store, "https://www.example.com/2")
+		require.NoError(t, err)
+
+		assert.NotZero(t, first.ID)
+		assert.Equal(t, first.ID+1, second.ID)
+		assert.NotEmpty(t, first.ShortCode)
+		assert.NotEqual(t, first.ShortCode, second.ShortCode)
+		assert.Equal(t, "https://www.example.com/1", first.OriginalURL)
+		assert.False(t, first.CreatedAt.IsZero())
+		assert.Equal(t, uint64(0), first.AccessCount)
+	})
+
+	t.Run("Save deduplicates original URL", func(t *testing.T) {
+		store := newStore(t)
+
+		first, err := saveURL(store, "https://www.duplicate.com")
+		require.NoError(t, err)
+		second, err := saveURL(store, "https://www.duplicate.com")
+		require.NoError(t, err)
+
+		assert.Equal(t, first.ID, second.ID)
+		assert.Equal(t, first.ShortCode, second.ShortCode)
+	})
+
+	t.Run("Save rejects taken short code", func(t *testing.T) {
+		store := newStore(t)
+
+		saved, err := saveURL(store, "https://www.example.com/1")
+		require.NoError(t, err)
+
+		id, err := store.NextID()
+		require.NoError(t, err)
+		_, err = store.Save(&models.URL{
+			ID:          id,
+			OriginalURL: "https://www.example.com/2",
+			ShortCode:   saved.ShortCode,
+			CreatedAt:   time.Now(),
+		})
+		assert.Equal(t, ErrCodeExists, err)
+
+		// 失败的保存不会留下任何记录
+		_, err = store.GetByOriginalURL("https://www.example.com/2")
+		assert.Equal(t, ErrURLNotFound, err)
+		_, err = store.GetByID(id)
+		assert.Equal(t, ErrURLNotFound, err)
+	})
+
+	t.Run("Custom short code", func(t *testing.T) {
+		store := newStore(t)
+
+		id, err := store.NextID()
+		require.NoError(t, err)
+		saved, err := store.Save(&models.URL{
+			ID:          id,
+			OriginalURL: "https://www.example.com",
+			ShortCode:   "aBc123",
+			CreatedAt:   time.Now(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "aBc123", saved.ShortCode)
+
+		byOrig, err := store.GetByOriginalURL("https://www.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "aBc123", byOrig.ShortCode)
+		assert.Equal(t, id, byOrig.ID)
+	})
+
+	t.Run("Custom aliases skip deduplication", func(t *testing.T) {
+		store := newStore(t)
+
+		plain, err := saveURL(store, "https://www.example.com")
+		require.NoError(t, err)
+
+		id, err := store.NextID()
+		require.NoError(t, err)
+		alias, err := store.Save(&models.URL{
+			ID:          id,
+			OriginalURL: "https://www.example.com",
+			ShortCode:   "launch-2026",
+			CreatedAt:   time.Now(),
+			Custom:      true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, id, alias.ID)
+
+		record, err := store.GetByShortCode("launch-2026")
+		require.NoError(t, err)
+		assert.True(t, record.Custom)
+
+		// 去重只返回普通链接
+		byOrig, err := store.GetByOriginalURL("https://www.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, plain.ShortCode, byOrig.ShortCode)
+		again, err := saveURL(store, "https://www.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, plain.ShortCode, again.ShortCode)
+	})
+
+	t.Run("Get by short code and ID", func(t *testing.T) {
+		store := newStore(t)
+
+		saved, err := saveURL(store, "https://www.example.com")
+		require.NoError(t, err)
+
+		byCode, err := store.GetByShortCode(saved.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, saved.ID, byCode.ID)
+		assert.Equal(t, saved.OriginalURL, byCode.OriginalURL)
+
+		byID, err := store.GetByID(saved.ID)
+		require.NoError(t, err)
+		assert.Equal(t, saved.ShortCode, byID.ShortCode)
+	})
+
+	t.Run("Missing records", func(t *testing.T) {
+		store := newStore(t)
+
+		_, err := store.GetByShortCode("missing")
+		assert.Equal(t, ErrURLNotFound, err)
+
+		_, err = store.GetByID(12345)
+		assert.Equal(t, ErrURLNotFound, err)
+
+		err = store.IncrementAccessCount("missing")
+		assert.Equal(t, ErrURLNotFound, err)
+	})
+
+	t.Run("Concurrent access count", func(t *testing.T) {
+		store := newStore(t)
+
+		saved, err := saveURL(store, "https://www.example.com/counter")
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, store.IncrementAccessCount(saved.ShortCode))
+			}()
+		}
+		wg.Wait()
+
+		record, err := store.GetByShortCode(saved.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(50), record.AccessCount)
+	})
+
+	t.Run("Batch access counts", func(t *testing.T) {
+		store := newStore(t)
+
+		first, err := saveURL(store, "https://www.example.com/1")
+		require.NoError(t, err)
+		second, err := saveURL(store, "https://www.example.com/2")
+		require.NoError(t, err)
+
+		err = store.AddAccessCounts(map[string]uint64{
+			first.ShortCode:  3,
+			second.ShortCode: 1,
+			"missing":        5, // 不存在的短码被忽略
+		})
+		require.NoError(t, err)
+
+		record, err := store.GetByShortCode(first.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), record.AccessCount)
+
+		record, err = store.GetByShortCode(second.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), record.AccessCount)
+
+		_, err = store.GetByShortCode("missing")
+		assert.Equal(t, ErrURLNotFound, err)
+	})
+
+	t.Run("Variant clicks", func(t *testing.T) {
+		store := newStore(t)
+
+		id, err := store.NextID()
+		require.NoError(t, err)
+		_, err = store.Save(&models.URL{
+			ID:          id,
+			OriginalURL: "https://www.example.com",
+			ShortCode:   "split",
+			CreatedAt:   time.Now(),
+			Variants: []models.Variant{
+				{Name: "a", URL: "https://a.example.com", Weight: 70},
+				{Name: "b", URL: "https://b.example.com", Weight: 30},
+			},
+		})
+		require.NoError(t, err)
+
+		err = store.AddVariantClicks(map[string]map[string]uint64{
+			"split":   {"a": 3, "b": 1, "c": 5}, // 不存在的版本被忽略
+			"missing": {"a": 1},
+		})
+		require.NoError(t, err)
+
+		record, err := store.GetByShortCode("split")
+		require.NoError(t, err)
+		require.Len(t, record.Variants, 2)
+		assert.Equal(t, uint64(3), record.Variants[0].Clicks)
+		assert.Equal(t, uint64(1), record.Variants[1].Clicks)
+		assert.Equal(t, uint64(0), record.AccessCount)
+
+		// 修改时同名版本保留访问次数，请求中的计数被忽略，新版本从 0 开始
+		update := record.Clone()
+		update.Variants = []models.Variant{
+			{Name: "b", URL: "https://b.example.com", Weight: 50, Clicks: 9},
+			{Name: "c", URL: "https://c.example.com", Weight: 50},
+		}
+		_, err = store.Update(update)
+		require.NoError(t, err)
+		record, err = store.GetByShortCode("split")
+		require.NoError(t, err)
+		require.Len(t, record.Variants, 2)
+		assert.Equal(t, uint64(1), record.Variants[0].Clicks)
+		assert.Equal(t, uint64(0), record.Variants[1].Clicks)
+
+		// 删除后重新加入的版本从 0 开始
+		update.Variants = []models.Variant{
+			{Name: "a", URL: "https://a.example.com", Weight: 50},
+			{Name: "b", URL: "https://b.example.com", Weight: 50},
+		}
+		_, err = store.Update(update)
+		require.NoError(t, err)
+		require.NoError(t, store.AddVariantClicks(map[string]map[string]uint64{"split": {"b": 2}}))
+		record, err = store.GetByShortCode("split")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), record.Variants[0].Clicks)
+		assert.Equal(t, uint64(3), record.Variants[1].Clicks)
+	})
+
+	t.Run("Delete removes record and indexes", func(t *testing.T) {
+		store := newStore(t)
+
+		saved, err := saveURL(store, "https://www.example.com")
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(saved.ShortCode))
+		assert.Equal(t, ErrURLNotFound, store.Delete(saved.ShortCode))
+
+		_, err = store.GetByShortCode(saved.ShortCode)
+		assert.Equal(t, ErrURLNotFound, err)
+		_, err = store.GetByID(saved.ID)
+		assert.Equal(t, ErrURLNotFound, err)
+		_, err = store.GetByOriginalURL(saved.OriginalURL)
+		assert.Equal(t, ErrURLNotFound, err)
+
+		// 删除后相同的原始 URL 会生成新的记录
+		again, err := saveURL(store, "https://www.example.com")
+		require.NoError(t, err)
+		assert.NotEqual(t, saved.ID, again.ID)
+	})
+
+	t.Run("Update replaces fields and appends revisions", func(t *testing.T) {
+		store := newStore(t)
+
+		saved, err := saveURL(store, "https://www.example.com/typo")
+		require.NoError(t, err)
+		require.NoError(t, store.IncrementAccessCount(saved.ShortCode))
+
+		now := time.Now()
+		expiresAt := now.Add(-time.Minute)
+		edit := saved.Clone()
+		edit.OriginalURL = "https://www.example.com/fixed"
+		edit.ExpiresAt = &expiresAt
+		edit.UpdatedAt = &now
+		edit.AccessCount = 0
+
+		initial := models.NewRevision(saved, models.RevisionCreate, "", saved.CreatedAt)
+		initial.Number = 1
+		change := models.NewRevision(edit, models.RevisionUpdate, "alice", now)
+		change.Number = 2
+
+		updated, err := store.Update(edit, initial, change)
+		require.NoError(t, err)
+		assert.Equal(t, saved.ID, updated.ID)
+		assert.Equal(t, "https://www.example.com/fixed", updated.OriginalURL)
+		assert.Equal(t, uint64(1), updated.LoadAccessCount(), "update must keep the stored access count")
+
+		record, err := store.GetByShortCode(saved.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, "https://www.example.com/fixed", record.OriginalURL)
+		require.NotNil(t, record.UpdatedAt)
+
+		// 修改过的记录离开去重索引，新旧地址都会创建新的链接
+		_, err = store.GetByOriginalURL("https://www.example.com/typo")
+		assert.Equal(t, ErrURLNotFound, err)
+		_, err = store.GetByOriginalURL("https://www.example.com/fixed")
+		assert.Equal(t, ErrURLNotFound, err)
+
+		// 过期索引随之更新
+		expired, err := store.ListExpired(now, 10)
+		require.NoError(t, err)
+		require.Len(t, expired, 1)
+		assert.Equal(t, saved.ShortCode, expired[0].ShortCode)
+
+		revisions, err := store.GetRevisions(saved.ShortCode)
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, "https://www.example.com/typo", revisions[0].OriginalURL)
+		assert.Equal(t, "alice", revisions[1].Actor)
+		assert.Equal(t, "https://www.example.com/fixed", revisions[1].OriginalURL)
+
+		// 版本号必须紧接在已有历史之后
+		stale := models.NewRevision(edit, models.RevisionUpdate, "bob", now)
+		stale.Number = 2
+		_, err = store.Update(edit, stale)
+		assert.Equal(t, ErrRevisionConflict, err)
+
+		missing := edit.Clone()
+		missing.ShortCode = "missing"
+		_, err = store.Update(missing)
+		assert.Equal(t, ErrURLNotFound, err)
+
+		// 删除记录时一并删除修改历史
+		require.NoError(t, store.Delete(saved.ShortCode))
+		revisions, err = store.GetRevisions(saved.ShortCode)
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+	})
+
+	t.Run("Expiring links", func(t *testing.T) {
+		store := newStore(t)
+
+		now := time.Now()
+		saveExpiring := func(shortCode string, expiresAt time.Time) *models.URL {
+			id, err := store.NextID()
+			require.NoError(t, err)
+			saved, err := store.Save(&models.URL{
+				ID:          id,
+				OriginalURL: "https://www.example.com",
+				ShortCode:   shortCode,
+				CreatedAt:   now,
+				ExpiresAt:   &expiresAt,
+			})
+			require.NoError(t, err)
+			return saved
+		}
+
+		plain, err := saveURL(store, "https://www.example.com")
+		require.NoError(t, err)
+		saveExpiring("later", now.Add(-time.Minute))
+		saveExpiring("first", now.Add(-time.Hour))
+		saveExpiring("future", now.Add(time.Hour))
+
+		// 带过期时间的链接不参与去重
+		byOrig, err := store.GetByOriginalURL("https://www.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, plain.ShortCode, byOrig.ShortCode)
+
+		record, err := store.GetByShortCode("future")
+		require.NoError(t, err)
+		require.NotNil(t, record.ExpiresAt)
+		assert.WithinDuration(t, now.Add(time.Hour), *record.ExpiresAt, time.Millisecond)
+
+		// 按过期时间顺序返回，未过期和不过期的链接不返回
+		expired, err := store.ListExpired(now, 10)
+		require.NoError(t, err)
+		require.Len(t, expired, 2)
+		assert.Equal(t, "first", expired[0].ShortCode)
+		assert.Equal(t, "later", expired[1].ShortCode)
+
+		expired, err = store.ListExpired(now, 1)
+		require.NoError(t, err)
+		require.Len(t, expired, 1)
+		assert.Equal(t, "first", expired[0].ShortCode)
+
+		// 删除后不再出现在过期列表中
+		require.NoError(t, store.Delete("first"))
+		expired, err = store.ListExpired(now, 10)
+		require.NoError(t, err)
+		require.Len(t, expired, 1)
+		assert.Equal(t, "later", expired[0].ShortCode)
+
+		// 按条件删除：列出之后被延期的记录不删除，未过期和不存在的记录同样不删除
+		extended := expired[0].Clone()
+		extendedAt := now.Add(time.Hour)
+		extended.ExpiresAt = &extendedAt
+		_, err = store.Update(extended)
+		require.NoError(t, err)
+		assert.Equal(t, ErrNotDue, store.DeleteIfDue("later", now))
+		assert.Equal(t, ErrNotDue, store.DeleteIfDue(plain.ShortCode, now))
+		assert.Equal(t, ErrURLNotFound, store.DeleteIfDue("missing", now))
+		_, err = store.GetByShortCode("later")
+		require.NoError(t, err)
+
+		require.NoError(t, store.DeleteIfDue("later", now.Add(2*time.Hour)))
+		_, err = store.GetByShortCode("later")
+		assert.Equal(t, ErrURLNotFound, err)
+
+		// 已删除的短码记下删除原因
+		for _, shortCode := range []string{"first", "later"} {
+			reason, err := store.DeletionReason(shortCode)
+			require.NoError(t, err)
+			assert.Equal(t, DeletionExpired, reason, shortCode)
+		}
+		_, err = store.DeletionReason("future")
+		assert.Equal(t, ErrURLNotFound, err)
+	})
+
+	t.Run("Trash and disabled links", func(t *testing.T) {
+		store := newStore(t)
+
+		trashed, err := saveURL(store, "https://www.example.com/spam")
+		require.NoError(t, err)
+		disabled, err := saveURL(store, "https://www.example.com/abuse")
+		require.NoError(t, err)
+
+		now := time.Now()
+		purgeAt := now.Add(-time.Minute)
+		trash := trashed.Clone()
+		trash.DeletedAt = &now
+		trash.PurgeAt = &purgeAt
+		_, err = store.Update(trash)
+		require.NoError(t, err)
+
+		disable := disabled.Clone()
+		disable.DisabledAt = &now
+		disable.DisabledReason = "phishing"
+		_, err = store.Update(disable)
+		require.NoError(t, err)
+
+		record, err := store.GetByShortCode(disabled.ShortCode)
+		require.NoError(t, err)
+		require.NotNil(t, record.DisabledAt)
+		assert.Equal(t, "phishing", record.DisabledReason)
+
+		stats, err := store.GetStats()
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, stats["total_urls"])
+		assert.EqualValues(t, 1, stats["trashed_urls"])
+		assert.EqualValues(t, 1, stats["disabled_urls"])
+		assert.EqualValues(t, 0, stats["deleted_codes"])
+
+		// 回收站中到期的记录和过期记录一起交给清理任务
+		expired, err := store.ListExpired(now, 10)
+		require.NoError(t, err)
+		require.Len(t, expired, 1)
+		assert.Equal(t, trashed.ShortCode, expired[0].ShortCode)
+		require.NotNil(t, expired[0].PurgeAt)
+
+		// 永久删除后短码不会再被分配
+		require.NoError(t, store.Delete(trashed.ShortCode))
+		_, err = store.Save(&models.URL{
+			ID:          trashed.ID + 100,
+			OriginalURL: "https://www.example.com/other",
+			ShortCode:   trashed.ShortCode,
+			CreatedAt:   now,
+		})
+		assert.Equal(t, ErrCodeExists, err)
+		reason, err := store.DeletionReason(trashed.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, DeletionPurged, reason)
+
+		require.NoError(t, store.Delete(disabled.ShortCode))
+		reason, err = store.DeletionReason(disabled.ShortCode)
+		require.NoError(t, err)
+		assert.Equal(t, DeletionRemoved, reason)
+
+		stats, err = store.GetStats()
+		require.NoError(t, err)
+		assert.EqualValues(t, 0, stats["total_urls"])
+		assert.EqualValues(t, 0, stats["trashed_urls"])
+		assert.EqualValues(t, 2, stats["deleted_codes"])
+	})
+
+	t.Run("Click limit", func(t *testing.T) {
+		store := newStore(t)
+
+		plain, err := saveURL(store, "https://www.example.com")
+		require.NoError(t, err)
+
+		id, err := store.NextID()
+		require.NoError(t, err)
+		limited, err := store.Save(&models.URL{
+			ID:          id,
+			OriginalURL: "https://www.example.com",
+			ShortCode:   "limited",
+			CreatedAt:   time.Now(),
+			MaxClicks:   3,
+		})
+		require.NoError(t, err)
+		assert.NotEqual(t, plain.ShortCode, limited.ShortCode)
+
+		// 并发访问不会超过次数限制
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		succeeded := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := store.IncrementAccessCount("limited")
+				if err == nil {
+					mutex.Lock()
+					succeeded++
+					mutex.Unlock()
+					return
+				}
+				assert.Equal(t, ErrClickLimitReached, err)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 3, succeeded)
+
+		record, err := store.GetByShortCode("limited")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), record.AccessCount)
+		assert.Equal(t, uint64(3), record.MaxClicks)
+		assert.True(t, record.IsExhausted())
+
+		// 批量累加同样不会超过限制
+		require.NoError(t, store.AddAccessCounts(map[string]uint64{"limited": 5}))
+		record, err = store.GetByShortCode("limited")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), record.AccessCount)
+	})
+
+	t.Run("Link settings round trip", func(t *testing.T) {
+		store := newStore(t)
+
+		activateAt := time.Now().Add(time.Hour)
+		deactivateAt := activateAt.Add(time.Hour)
+		id, err := store.NextID()
+		require.NoError(t, err)
+		_, err = store.Save(&models.URL{
+			ID:           id,
+			OriginalURL:  "https://www.example.com",
+			ShortCode:    "embargo",
+			CreatedAt:    time.Now(),
+			ActivateAt:   &activateAt,
+			DeactivateAt: &deactivateAt,
+			FallbackURL:  "https://www.example.com/soon",
+			PasswordHash: "$2a$04$hash",
+			RedirectType: 307,
+
+			QueryPassthrough: models.QueryOverride,
+			PathPassthrough:  true,
+			Template:         true,
+			Rules: []models.RedirectRule{
+				{OS: "ios", URL: "https://apps.apple.com/app/id1"},
+				{Device: "mobile", Language: "zh", URL: "https://m.example.com/zh"},
+			},
+		})
+		require.NoError(t, err)
+
+		record, err := store.GetByShortCode("embargo")
+		require.NoError(t, err)
+		require.NotNil(t, record.ActivateAt)
+		require.NotNil(t, record.DeactivateAt)
+		assert.WithinDuration(t, activateAt, *record.ActivateAt, time.Millisecond)
+		assert.WithinDuration(t, deactivateAt, *record.DeactivateAt, time.Millisecond)
+		assert.Equal(t, "https://www.example.com/soon", record.FallbackURL)
+		assert.Equal(t, "$2a$04$hash", record.PasswordHash)
+		assert.Equal(t, 307, record.RedirectType)
+		assert.Equal(t, models.QueryOverride, record.QueryPassthrough)
+		assert.True(t, record.PathPassthrough)
+		assert.True(t, record.Template)
+		assert.Equal(t, []models.RedirectRule{
+			{OS: "ios", URL: "https://apps.apple.com/app/id1"},
+			{Device: "mobile", Language: "zh", URL: "https://m.example.com/zh"},
+		}, record.Rules)
+
+		// 带额外设置的链接不参与去重
+		_, err = store.GetByOriginalURL("https://www.example.com")
+		assert.Equal(t, ErrURLNotFound, err)
+	})
+
+	t.Run("Stats and listing", func(t *testing.T) {
+		store := newStore(t)
+
+		for i := 0; i < 3; i++ {
+			_, err := saveURL(store, fmt.Sprintf("https://www.example%d.com", i))
+			require.NoError(t, err)
+		}
+
+		stats, err := store.GetStats()
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, stats["total_urls"])
+
+		urls, err := store.GetAllURLs()
+		require.NoError(t, err)
+		assert.Len(t, urls, 3)
+	})
+}
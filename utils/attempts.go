@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// AttemptLimiter 按键限制一段时间内的失败次数（固定窗口）。
+// 窗口从第一次失败开始计时，失败次数达到上限后直到窗口结束都拒绝尝试。
+// 记录保存在容量有限的 LRU 中，大量不同的键不会让内存无限增长。
+type AttemptLimiter struct {
+	maxFailures int
+	window      time.Duration
+	mutex       sync.Mutex
+	failures    *LRU[string, *attemptWindow]
+	now         func() time.Time
+}
+
+// attemptWindow 一个键在当前窗口内的失败情况
+type attemptWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// NewAttemptLimiter 创建限制器，每个键在 window 内最多失败 maxFailures 次，最多跟踪 capacity 个键
+func NewAttemptLimiter(maxFailures int, window time.Duration, capacity int) *AttemptLimiter {
+	if maxFailures <= 0 {
+		maxFailures = 1
+	}
+
+	return &AttemptLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		failures:    NewLRU[string, *attemptWindow](capacity),
+		now:         time.Now,
+	}
+}
+
+// Allow 检查是否允许再次尝试，不允许时返回距离窗口结束的时间
+func (l *AttemptLimiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current, ok := l.failures.Get(key)
+	if !ok || current.count < l.maxFailures {
+		return true, 0
+	}
+
+	retryAfter := current.resetAt.Sub(l.now())
+	if retryAfter <= 0 {
+		return true, 0
+	}
+	return false, retryAfter
+}
+
+// Fail 记录一次失败
+func (l *AttemptLimiter) Fail(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	current, ok := l.failures.Get(key)
+	if !ok || !now.Before(current.resetAt) {
+		l.failures.Add(key, &attemptWindow{count: 1, resetAt: now.Add(l.window)}, l.window)
+		return
+	}
+	current.count++
+}
+
+// Reset 清除键的失败记录，在尝试成功后调用
+func (l *AttemptLimiter) Reset(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.failures.Remove(key)
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	limiter := NewAttemptLimiter(3, time.Minute, 100)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("code")
+		assert.True(t, allowed)
+		limiter.Fail("code")
+	}
+
+	allowed, retryAfter := limiter.Allow("code")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	// 其他键不受影响
+	allowed, _ = limiter.Allow("other")
+	assert.True(t, allowed)
+
+	// 窗口结束后重新允许
+	limiter.now = func() time.Time { return now.Add(time.Minute) }
+	allowed, _ = limiter.Allow("code")
+	assert.True(t, allowed)
+
+	limiter.now = func() time.Time { return now }
+	limiter.Reset("code")
+	allowed, _ = limiter.Allow("code")
+	assert.True(t, allowed)
+}
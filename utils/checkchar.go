@@ -0,0 +1,68 @@
+package utils
+
+import "strings"
+
+// 校验字符采用 Luhn mod 62 算法：能发现任意单个字符的替换错误，以及绝大多数相邻字符的交换。
+// 只有 Base62 字符参与计算，别名中的 - 和 _ 等字符会被跳过。
+
+// AppendCheckChar 在短码末尾追加校验字符
+func AppendCheckChar(code string) string {
+	sum := luhn62Sum(code, 2)
+	return code + string(base62Chars[(base-sum%base)%base])
+}
+
+// VerifyCheckChar 检查短码末尾的校验字符是否正确
+func VerifyCheckChar(code string) bool {
+	if len(code) < 2 || strings.IndexByte(base62Chars, code[len(code)-1]) < 0 {
+		return false
+	}
+	return luhn62Sum(code, 1)%base == 0
+}
+
+// SuggestCorrections 返回只替换一个字符就能通过校验的所有短码，按位置顺序排列。
+// 用于猜测输错了一个字符的短码原本是什么。
+func SuggestCorrections(code string) []string {
+	var suggestions []string
+
+	candidate := []byte(code)
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(base62Chars, code[i]) < 0 {
+			continue
+		}
+
+		for j := 0; j < base; j++ {
+			if base62Chars[j] == code[i] {
+				continue
+			}
+			candidate[i] = base62Chars[j]
+			if VerifyCheckChar(string(candidate)) {
+				suggestions = append(suggestions, string(candidate))
+			}
+		}
+		candidate[i] = code[i]
+	}
+
+	return suggestions
+}
+
+// luhn62Sum 从右向左计算 Luhn mod 62 的加权和，factor 为最右侧字符的权重
+func luhn62Sum(code string, factor int) int {
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		value := strings.IndexByte(base62Chars, code[i])
+		if value < 0 {
+			continue
+		}
+
+		addend := factor * value
+		addend = addend/base + addend%base
+		sum += addend
+
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+	}
+	return sum
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckChar(t *testing.T) {
+	codes := []string{"1", "Z", "10", "abc123XYZ", "launch-2026", "a_b"}
+
+	for _, code := range codes {
+		withCheck := AppendCheckChar(code)
+		assert.Len(t, withCheck, len(code)+1)
+		assert.True(t, VerifyCheckChar(withCheck), "%s should pass verification", withCheck)
+	}
+
+	assert.False(t, VerifyCheckChar(""))
+	assert.False(t, VerifyCheckChar("a"))
+	assert.False(t, VerifyCheckChar("ab-"))
+}
+
+func TestCheckCharDetectsSubstitution(t *testing.T) {
+	code := AppendCheckChar("abc123")
+
+	// 任意位置替换任意一个字符都能被发现
+	for i := 0; i < len(code); i++ {
+		for j := 0; j < len(base62Chars); j++ {
+			if base62Chars[j] == code[i] {
+				continue
+			}
+			typo := []byte(code)
+			typo[i] = base62Chars[j]
+			assert.False(t, VerifyCheckChar(string(typo)), "%s should fail verification", typo)
+		}
+	}
+}
+
+func TestSuggestCorrections(t *testing.T) {
+	code := AppendCheckChar("abc123")
+	typo := []byte(code)
+	typo[2] = 'x'
+
+	suggestions := SuggestCorrections(string(typo))
+	assert.Contains(t, suggestions, code)
+
+	// 每个位置恰好有一个字符能让校验通过
+	assert.Len(t, suggestions, len(code))
+	for _, suggestion := range suggestions {
+		assert.True(t, VerifyCheckChar(suggestion))
+	}
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// CodeGenerator 短码生成策略。
+// id 为存储为本次保存分配的 ID，url 为规范化后的原始 URL，
+// attempt 从 0 开始，生成的短码已被占用时会以递增的 attempt 重新调用。
+type CodeGenerator interface {
+	Generate(id uint64, url string, attempt int) (string, error)
+}
+
+// SequentialGenerator 直接编码 ID，短码随 ID 递增。
+// 每次重试都会分配新的 ID，因此被占用的短码会被跳过。
+type SequentialGenerator struct {
+	obfuscator *IDObfuscator // 不为 nil 时先混淆 ID 再编码
+}
+
+// NewSequentialGenerator 创建顺序短码生成器，obfuscator 可以为 nil
+func NewSequentialGenerator(obfuscator *IDObfuscator) *SequentialGenerator {
+	return &SequentialGenerator{obfuscator: obfuscator}
+}
+
+// Generate 生成短码
+func (g *SequentialGenerator) Generate(id uint64, url string, attempt int) (string, error) {
+	if g.obfuscator != nil {
+		return g.obfuscator.Encode(id), nil
+	}
+	return EncodeBase62(id), nil
+}
+
+// RandomGenerator 使用密码学安全的随机数生成定长短码
+type RandomGenerator struct {
+	length int
+}
+
+// NewRandomGenerator 创建随机短码生成器
+func NewRandomGenerator(length int) *RandomGenerator {
+	return &RandomGenerator{length: length}
+}
+
+// Generate 生成短码，与 ID 和 URL 无关
+func (g *RandomGenerator) Generate(id uint64, url string, attempt int) (string, error) {
+	limit := big.NewInt(base)
+	code := make([]byte, g.length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		code[i] = base62Chars[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// hashURLAttempts 哈希短码只由 URL 决定的尝试次数，之后的尝试把 ID 加入哈希输入
+const hashURLAttempts = 3
+
+// HashGenerator 对规范化后的 URL 做哈希，同一个 URL 总是得到相同的短码。
+// 发生碰撞时把 attempt 加入哈希输入，得到另一个确定的短码；
+// 前 hashURLAttempts 次都被占用时（同一 URL 的多个不去重链接、已删除的短码）再加入每次都不同的 ID。
+type HashGenerator struct {
+	length int
+}
+
+// NewHashGenerator 创建哈希短码生成器，length 最大为 11
+func NewHashGenerator(length int) *HashGenerator {
+	return &HashGenerator{length: length}
+}
+
+// Generate 生成短码
+func (g *HashGenerator) Generate(id uint64, url string, attempt int) (string, error) {
+	input := url
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+	if attempt >= hashURLAttempts {
+		input += "#" + strconv.FormatUint(id, 10)
+	}
+
+	sum := sha256.Sum256([]byte(input))
+	code := EncodeBase62(binary.BigEndian.Uint64(sum[:8]))
+
+	// 64 位数值的 Base62 编码最长 11 位，不足时左侧补 0 保证定长
+	if len(code) < 11 {
+		code = strings.Repeat("0", 11-len(code)) + code
+	}
+	if g.length > 0 && g.length < len(code) {
+		code = code[:g.length]
+	}
+	return code, nil
+}
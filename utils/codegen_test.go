@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequentialGenerator(t *testing.T) {
+	code, err := NewSequentialGenerator(nil).Generate(62, "https://www.example.com", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "10", code)
+
+	obfuscator := NewIDObfuscator("secret", 11)
+	code, err = NewSequentialGenerator(obfuscator).Generate(62, "https://www.example.com", 0)
+	require.NoError(t, err)
+	assert.Equal(t, obfuscator.Encode(62), code)
+}
+
+func TestRandomGenerator(t *testing.T) {
+	generator := NewRandomGenerator(8)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := generator.Generate(1, "https://www.example.com", 0)
+		require.NoError(t, err)
+		assert.Len(t, code, 8)
+		assert.True(t, IsValidBase62(code))
+		assert.False(t, seen[code], "duplicate code %s", code)
+		seen[code] = true
+	}
+}
+
+func TestHashGenerator(t *testing.T) {
+	generator := NewHashGenerator(8)
+
+	first, err := generator.Generate(1, "https://www.example.com", 0)
+	require.NoError(t, err)
+	assert.Len(t, first, 8)
+	assert.True(t, IsValidBase62(first))
+
+	// 与 ID 无关，同一个 URL 总是得到相同的短码
+	again, err := generator.Generate(2, "https://www.example.com", 0)
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	// 重试时得到不同的短码
+	retry, err := generator.Generate(1, "https://www.example.com", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, retry)
+
+	other, err := generator.Generate(1, "https://www.example.org", 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+
+	// 只由 URL 决定的短码都被占用后，不同的 ID 得到不同的短码
+	late, err := generator.Generate(1, "https://www.example.com", hashURLAttempts)
+	require.NoError(t, err)
+	lateOther, err := generator.Generate(2, "https://www.example.com", hashURLAttempts)
+	require.NoError(t, err)
+	assert.NotEqual(t, late, lateOther)
+}
@@ -0,0 +1,507 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+)
+
+// MaxMind DB 格式见 https://maxmind.github.io/MaxMind-DB/ ：
+// 文件由二叉搜索树、16 字节的分隔、数据区和末尾的元数据组成，
+// 按 IP 地址的每一位沿搜索树走到叶子，叶子指向数据区中的一条记录。
+// 这里只实现按 IP 查询国家和大洲需要的部分，GeoLite2-Country 和 GeoLite2-City 都可以使用。
+
+// ErrInvalidGeoDB 文件不是有效的 MaxMind DB
+var ErrInvalidGeoDB = errors.New("invalid MaxMind DB file")
+
+// mmdbMetadataMarker 元数据开始的标记，元数据位于文件末尾
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// 数据区中的数据类型
+const (
+	mmdbExtended = 0
+	mmdbPointer  = 1
+	mmdbString   = 2
+	mmdbDouble   = 3
+	mmdbBytes    = 4
+	mmdbUint16   = 5
+	mmdbUint32   = 6
+	mmdbMap      = 7
+	mmdbInt32    = 8
+	mmdbUint64   = 9
+	mmdbUint128  = 10
+	mmdbArray    = 11
+	mmdbBoolean  = 14
+	mmdbFloat    = 15
+)
+
+// mmdbMaxDepth 解码时嵌套和指针跳转的最大深度，防止损坏的文件造成无限递归
+const mmdbMaxDepth = 32
+
+// GeoLocation IP 地址所在的国家和大洲，查不到的字段为空
+type GeoLocation struct {
+	Country   string // ISO 3166-1 两位国家代码，如 CN、US
+	Continent string // 两位大洲代码：AF、AN、AS、EU、NA、OC、SA
+}
+
+// GeoDB 读入内存的只读 MaxMind DB，可以并发查询
+type GeoDB struct {
+	tree       []byte
+	data       mmdbDecoder
+	nodeCount  uint
+	recordSize uint // 每条记录的位数：24、28 或 32
+	ipVersion  uint
+	ipv4Start  uint // IPv6 地址库中 IPv4 地址（::/96）开始查找的节点
+}
+
+// OpenGeoDB 读取并解析 .mmdb 文件
+func OpenGeoDB(path string) (*GeoDB, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewGeoDB(buffer)
+}
+
+// NewGeoDB 解析内存中的 MaxMind DB
+func NewGeoDB(buffer []byte) (*GeoDB, error) {
+	markerAt := bytes.LastIndex(buffer, mmdbMetadataMarker)
+	if markerAt < 0 {
+		return nil, ErrInvalidGeoDB
+	}
+
+	metadata := mmdbDecoder{buffer: buffer[markerAt+len(mmdbMetadataMarker):]}
+	value, _, err := metadata.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidGeoDB, err)
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidGeoDB
+	}
+
+	nodeCount, ok1 := fields["node_count"].(uint64)
+	recordSize, ok2 := fields["record_size"].(uint64)
+	ipVersion, ok3 := fields["ip_version"].(uint64)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, ErrInvalidGeoDB
+	}
+	if major, ok := fields["binary_format_major_version"].(uint64); ok && major != 2 {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidGeoDB, major)
+	}
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidGeoDB, recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, ErrInvalidGeoDB
+	}
+
+	// 搜索树之后是 16 字节的分隔，然后是数据区，数据区中的指针都相对于数据区开头。
+	// 先限制节点数再计算树的大小，损坏的 node_count 不能让乘法溢出
+	if markerAt < 16 || nodeCount > uint64(markerAt-16)*4/recordSize {
+		return nil, fmt.Errorf("%w: node count %d exceeds the file size", ErrInvalidGeoDB, nodeCount)
+	}
+	treeSize := nodeCount * recordSize / 4
+
+	db := &GeoDB{
+		tree:       buffer[:treeSize],
+		data:       mmdbDecoder{buffer: buffer[treeSize+16 : markerAt]},
+		nodeCount:  uint(nodeCount),
+		recordSize: uint(recordSize),
+		ipVersion:  uint(ipVersion),
+	}
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+// Lookup 查询 IP 地址所在的国家和大洲，地址库中没有该地址时 found 为 false
+func (db *GeoDB) Lookup(ip net.IP) (location GeoLocation, found bool, err error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = db.ipv4Start
+	} else if len(ip) != net.IPv6len || db.ipVersion == 4 {
+		return GeoLocation{}, false, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return GeoLocation{}, false, nil
+	}
+
+	value, _, err := db.data.decode(node-db.nodeCount-16, 0)
+	if err != nil {
+		return GeoLocation{}, false, fmt.Errorf("%w: %v", ErrInvalidGeoDB, err)
+	}
+	record, _ := value.(map[string]interface{})
+
+	location.Country = nestedString(record, "country", "iso_code")
+	if location.Country == "" {
+		location.Country = nestedString(record, "registered_country", "iso_code")
+	}
+	location.Continent = nestedString(record, "continent", "code")
+
+	return location, location.Country != "" || location.Continent != "", nil
+}
+
+// record 读取节点的左（bit 为 0）或右记录
+func (db *GeoDB) record(node, bit uint) uint {
+	b := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		// 中间的字节高 4 位属于左记录，低 4 位属于右记录
+		if bit == 0 {
+			return (uint(b[3])&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return (uint(b[3])&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// nestedString 读取嵌套 map 中的字符串，如 record["country"]["iso_code"]
+func nestedString(record map[string]interface{}, outer, inner string) string {
+	nested, _ := record[outer].(map[string]interface{})
+	value, _ := nested[inner].(string)
+	return value
+}
+
+// mmdbDecoder 解码数据区，整数统一解码为 uint64 或 int64
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+// decode 解码 offset 处的值，返回值和下一个值的偏移
+func (d *mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	if offset >= uint(len(d.buffer)) {
+		return nil, 0, errors.New("offset out of range")
+	}
+
+	control := d.buffer[offset]
+	offset++
+	kind := uint(control >> 5)
+
+	// 指针指向数据区中的另一个值，解码后从指针之后继续
+	if kind == mmdbPointer {
+		size := uint(control>>3) & 0x3
+		raw, err := d.bytes(offset, size+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		pointer := uint(control & 0x7)
+		switch size {
+		case 0:
+			pointer = pointer<<8 | uint(raw[0])
+		case 1:
+			pointer = (pointer<<16 | uint(raw[0])<<8 | uint(raw[1])) + 2048
+		case 2:
+			pointer = (pointer<<24 | uint(raw[0])<<16 | uint(raw[1])<<8 | uint(raw[2])) + 526336
+		default:
+			pointer = uint(binary.BigEndian.Uint32(raw))
+		}
+
+		value, _, err := d.decode(pointer, depth+1)
+		return value, offset + size + 1, err
+	}
+
+	if kind == mmdbExtended {
+		if offset >= uint(len(d.buffer)) {
+			return nil, 0, errors.New("offset out of range")
+		}
+		kind = 7 + uint(d.buffer[offset])
+		offset++
+	}
+
+	// 长度 29 到 31 表示后面还有 1 到 3 个字节的长度
+	size := uint(control & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		raw, err := d.bytes(offset, extra)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + uint(raw[0])
+		case 2:
+			size = 285 + (uint(raw[0])<<8 | uint(raw[1]))
+		default:
+			size = 65821 + (uint(raw[0])<<16 | uint(raw[1])<<8 | uint(raw[2]))
+		}
+	}
+
+	// 每个元素至少占一个字节，元素个数超过剩余的字节数说明文件已损坏，不按它分配内存
+	if (kind == mmdbMap || kind == mmdbArray) && size > uint(len(d.buffer))-offset {
+		return nil, 0, errors.New("container size out of range")
+	}
+
+	switch kind {
+	case mmdbMap:
+		result := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[name] = value
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbArray:
+		result := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbBoolean:
+		return size != 0, offset, nil
+	}
+
+	raw, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+
+	switch kind {
+	case mmdbString:
+		return string(raw), offset, nil
+	case mmdbBytes:
+		return raw, offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var value uint64
+		for _, b := range raw {
+			value = value<<8 | uint64(b)
+		}
+		return value, offset, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var value uint32
+		for _, b := range raw {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), offset, nil
+	case mmdbUint128:
+		// 国家查询用不到 128 位整数，保留原始字节
+		return raw, offset, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown data type %d", kind)
+}
+
+// bytes 返回 offset 开始的 n 个字节
+func (d *mmdbDecoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buffer)) {
+		return nil, errors.New("offset out of range")
+	}
+	return d.buffer[offset : offset+n], nil
+}
+
+// BuildGeoDB 生成只包含国家和大洲的 IPv6 MaxMind DB，IPv4 网段放在 ::/96 之下。
+// 用于测试，或者为内网地址段生成自定义的地址库；网段之间不能重叠。
+func BuildGeoDB(networks map[string]GeoLocation) ([]byte, error) {
+	type trieNode struct {
+		children [2]*trieNode
+		leaf     bool
+		data     uint // 叶子指向的记录在数据区中的偏移
+		number   uint
+	}
+
+	var data bytes.Buffer
+	offsets := make(map[GeoLocation]uint)
+	root := &trieNode{}
+
+	// 按网段排序，保证同样的输入生成同样的文件
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ones, bits := network.Mask.Size()
+		ip := network.IP.To16()
+		if bits == 32 {
+			ip = append(make(net.IP, 12), network.IP.To4()...)
+			ones += 96
+		}
+
+		location := networks[cidr]
+		offset, ok := offsets[location]
+		if !ok {
+			offset = uint(data.Len())
+			offsets[location] = offset
+			fields := make(map[string]interface{})
+			if location.Country != "" {
+				fields["country"] = map[string]interface{}{"iso_code": location.Country}
+			}
+			if location.Continent != "" {
+				fields["continent"] = map[string]interface{}{"code": location.Continent}
+			}
+			encodeMMDB(&data, fields)
+		}
+
+		node := root
+		for i := 0; i < ones; i++ {
+			if node.leaf {
+				return nil, fmt.Errorf("network %s overlaps another network", cidr)
+			}
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &trieNode{}
+			}
+			node = node.children[bit]
+		}
+		if node.leaf || node.children[0] != nil || node.children[1] != nil {
+			return nil, fmt.Errorf("network %s overlaps another network", cidr)
+		}
+		node.leaf = true
+		node.data = offset
+	}
+
+	// 按广度优先为内部节点编号，根节点为 0
+	nodes := []*trieNode{root}
+	for i := 0; i < len(nodes); i++ {
+		nodes[i].number = uint(i)
+		for _, child := range nodes[i].children {
+			if child != nil && !child.leaf {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+
+	nodeCount := uint(len(nodes))
+	var tree bytes.Buffer
+	for _, node := range nodes {
+		for _, child := range node.children {
+			record := nodeCount // 没有数据
+			if child != nil && child.leaf {
+				record = nodeCount + 16 + child.data
+			} else if child != nil {
+				record = child.number
+			}
+			tree.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+
+	var file bytes.Buffer
+	file.Write(tree.Bytes())
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.Write(mmdbMetadataMarker)
+	encodeMMDB(&file, map[string]interface{}{
+		"node_count":                  uint64(nodeCount),
+		"record_size":                 uint64(24),
+		"ip_version":                  uint64(6),
+		"binary_format_major_version": uint64(2),
+		"binary_format_minor_version": uint64(0),
+		"database_type":               "Custom-Country",
+	})
+
+	return file.Bytes(), nil
+}
+
+// encodeMMDB 按 MaxMind DB 数据区格式编码 BuildGeoDB 用到的值：字符串、uint64 和 map
+func encodeMMDB(buffer *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		writeMMDBControl(buffer, mmdbString, uint(len(v)))
+		buffer.WriteString(v)
+	case uint64:
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, v)
+		raw = bytes.TrimLeft(raw, "\x00")
+		writeMMDBControl(buffer, mmdbUint64, uint(len(raw)))
+		buffer.Write(raw)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeMMDBControl(buffer, mmdbMap, uint(len(v)))
+		for _, key := range keys {
+			encodeMMDB(buffer, key)
+			encodeMMDB(buffer, v[key])
+		}
+	}
+}
+
+// writeMMDBControl 写入类型和长度的控制字节
+func writeMMDBControl(buffer *bytes.Buffer, kind, size uint) {
+	var extra []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		extra = []byte{byte(size - 29)}
+		size = 29
+	case size < 65821:
+		extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+		size = 30
+	default:
+		extra = []byte{byte((size - 65821) >> 16), byte((size - 65821) >> 8), byte(size - 65821)}
+		size = 31
+	}
+
+	if kind > 7 {
+		buffer.Write([]byte{byte(size), byte(kind - 7)})
+	} else {
+		buffer.WriteByte(byte(kind<<5 | size))
+	}
+	buffer.Write(extra)
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoDB_Lookup(t *testing.T) {
+	buffer, err := BuildGeoDB(map[string]GeoLocation{
+		"1.0.0.0/24":    {Country: "AU", Continent: "OC"},
+		"8.8.8.0/24":    {Country: "US", Continent: "NA"},
+		"81.2.69.0/25":  {Country: "GB", Continent: "EU"},
+		"2001:db8::/32": {Country: "DE", Continent: "EU"},
+		"10.0.0.0/8":    {Continent: "AS"},
+	})
+	require.NoError(t, err)
+
+	db, err := NewGeoDB(buffer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip       string
+		expected GeoLocation
+		found    bool
+	}{
+		{"1.0.0.1", GeoLocation{Country: "AU", Continent: "OC"}, true},
+		{"8.8.8.8", GeoLocation{Country: "US", Continent: "NA"}, true},
+		{"81.2.69.100", GeoLocation{Country: "GB", Continent: "EU"}, true},
+		{"81.2.69.200", GeoLocation{}, false},
+		{"10.1.2.3", GeoLocation{Continent: "AS"}, true},
+		{"2001:db8::1", GeoLocation{Country: "DE", Continent: "EU"}, true},
+		{"::ffff:8.8.8.8", GeoLocation{Country: "US", Continent: "NA"}, true},
+		{"2001:db9::1", GeoLocation{}, false},
+		{"127.0.0.1", GeoLocation{}, false},
+	}
+
+	for _, tt := range tests {
+		location, found, err := db.Lookup(net.ParseIP(tt.ip))
+		require.NoError(t, err, tt.ip)
+		assert.Equal(t, tt.found, found, tt.ip)
+		assert.Equal(t, tt.expected, location, tt.ip)
+	}
+
+	_, found, err := db.Lookup(nil)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestOpenGeoDB(t *testing.T) {
+	buffer, err := BuildGeoDB(map[string]GeoLocation{"8.8.8.0/24": {Country: "US", Continent: "NA"}})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.WriteFile(path, buffer, 0o644))
+
+	db, err := OpenGeoDB(path)
+	require.NoError(t, err)
+	location, found, err := db.Lookup(net.ParseIP("8.8.8.8"))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "US", location.Country)
+
+	_, err = OpenGeoDB(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
+
+func TestNewGeoDB_Invalid(t *testing.T) {
+	_, err := NewGeoDB([]byte("not a database"))
+	assert.ErrorIs(t, err, ErrInvalidGeoDB)
+
+	// 元数据中的节点数超出文件大小
+	buffer, err := BuildGeoDB(map[string]GeoLocation{"8.8.8.0/24": {Country: "US"}})
+	require.NoError(t, err)
+	_, err = NewGeoDB(buffer[100:])
+	assert.ErrorIs(t, err, ErrInvalidGeoDB)
+
+	// node_count 乘以记录大小后溢出，不能因此通过大小检查
+	var file bytes.Buffer
+	file.Write([]byte{0, 0, 0, 5, 0, 0, 0, 5})
+	file.Write(make([]byte, 16))
+	file.Write(mmdbMetadataMarker)
+	encodeMMDB(&file, map[string]interface{}{
+		"node_count":  uint64(1)<<61 + 1,
+		"record_size": uint64(32),
+		"ip_version":  uint64(4),
+	})
+	_, err = NewGeoDB(file.Bytes())
+	assert.ErrorIs(t, err, ErrInvalidGeoDB)
+}
+
+// FuzzNewGeoDB 损坏的地址库只能返回错误，不能在解析或查询时 panic
+func FuzzNewGeoDB(f *testing.F) {
+	buffer, err := BuildGeoDB(map[string]GeoLocation{
+		"8.8.8.0/24":    {Country: "US", Continent: "NA"},
+		"2001:db8::/32": {Country: "DE", Continent: "EU"},
+	})
+	require.NoError(f, err)
+	f.Add(buffer)
+	f.Add(buffer[100:])
+	f.Add([]byte("not a database"))
+
+	ips := []net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("1.2.3.4"), net.ParseIP("2001:db8::1"), net.ParseIP("::1")}
+	f.Fuzz(func(t *testing.T, buffer []byte) {
+		db, err := NewGeoDB(buffer)
+		if err != nil {
+			return
+		}
+		for _, ip := range ips {
+			_, _, _ = db.Lookup(ip)
+		}
+	})
+}
+
+func TestBuildGeoDB_Overlap(t *testing.T) {
+	_, err := BuildGeoDB(map[string]GeoLocation{
+		"8.8.0.0/16": {Country: "US"},
+		"8.8.8.0/24": {Country: "CA"},
+	})
+	assert.Error(t, err)
+
+	_, err = BuildGeoDB(map[string]GeoLocation{"not-a-network": {Country: "US"}})
+	assert.Error(t, err)
+}
+
+func TestMMDBDecoder(t *testing.T) {
+	// {"country": 指针, "flag": true, "n": int32 -1}，指针指向之后的 {"iso_code": "CN"}
+	buffer := []byte{
+		0xE3,                                                // map，3 个键
+		0x47, 'c', 'o', 'u', 'n', 't', 'r', 'y', 0x20, 0x00, // "country"，指针的偏移稍后填入
+		0x44, 'f', 'l', 'a', 'g', 0x01, 0x07, // "flag"，扩展类型 bool，值为 true
+		0x41, 'n', 0x04, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, // "n"，扩展类型 int32
+	}
+	buffer[10] = byte(len(buffer))
+	buffer = append(buffer, 0xE1, 0x48, 'i', 's', 'o', '_', 'c', 'o', 'd', 'e', 0x42, 'C', 'N')
+
+	decoder := mmdbDecoder{buffer: buffer}
+	value, _, err := decoder.decode(0, 0)
+	require.NoError(t, err)
+	record, ok := value.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "CN", nestedString(record, "country", "iso_code"))
+	assert.Equal(t, true, record["flag"])
+	assert.Equal(t, int64(-1), record["n"])
+
+	// 长度大于 28 的字符串使用额外的长度字节
+	long := strings.Repeat("x", 300)
+	var encoded bytes.Buffer
+	encodeMMDB(&encoded, long)
+	value, _, err = (&mmdbDecoder{buffer: encoded.Bytes()}).decode(0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, long, value)
+
+	// 指向自身的指针不会无限递归
+	_, _, err = (&mmdbDecoder{buffer: []byte{0x20, 0x00}}).decode(0, 0)
+	assert.Error(t, err)
+
+	// 截断的数据返回错误
+	_, _, err = (&mmdbDecoder{buffer: []byte{0x45, 'a'}}).decode(0, 0)
+	assert.Error(t, err)
+}
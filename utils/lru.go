@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU 并发安全、容量有限、支持过期时间的最近最少使用缓存
+type LRU[K comparable, V any] struct {
+	capacity int
+	mutex    sync.Mutex
+	items    map[K]*list.Element
+	order    *list.List // 队首为最近使用的元素
+	now      func() time.Time
+}
+
+// lruEntry 缓存中的一个元素
+type lruEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time // 零值表示永不过期
+}
+
+// NewLRU 创建指定容量的 LRU 缓存
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	if capacity <= 0 {
+		capacity = 1
+	}
+
+	return &LRU[K, V]{
+		capacity: capacity,
+		items:    make(map[K]*list.Element, capacity),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get 读取缓存，过期的元素视为不存在并被移除
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var zero V
+	element, exists := c.items[key]
+	if !exists {
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[K, V])
+	if !entry.expiresAt.IsZero() && c.now().After(entry.expiresAt) {
+		c.removeElement(element)
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Add 写入缓存，ttl 小于等于 0 表示永不过期；超出容量时淘汰最久未使用的元素
+func (c *LRU[K, V]) Add(key K, value V, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	if element, exists := c.items[key]; exists {
+		entry := element.Value.(*lruEntry[K, V])
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expiresAt: expiresAt})
+
+	if c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Remove 删除缓存中的元素
+func (c *LRU[K, V]) Remove(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, exists := c.items[key]; exists {
+		c.removeElement(element)
+	}
+}
+
+// Purge 清空缓存
+func (c *LRU[K, V]) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.items = make(map[K]*list.Element, c.capacity)
+	c.order.Init()
+}
+
+// Len 返回当前缓存的元素数量（可能包含尚未清理的过期元素）
+func (c *LRU[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+// Capacity 返回缓存容量
+func (c *LRU[K, V]) Capacity() int {
+	return c.capacity
+}
+
+// removeElement 删除元素，调用方需持有锁
+func (c *LRU[K, V]) removeElement(element *list.Element) {
+	entry := c.order.Remove(element).(*lruEntry[K, V])
+	delete(c.items, entry.key)
+}
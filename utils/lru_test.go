@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU_Eviction(t *testing.T) {
+	cache := NewLRU[string, int](2)
+
+	cache.Add("a", 1, 0)
+	cache.Add("b", 2, 0)
+
+	// 访问 a 后，b 成为最久未使用的元素
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	cache.Add("c", 3, 0)
+	assert.Equal(t, 2, cache.Len())
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+}
+
+func TestLRU_TTL(t *testing.T) {
+	cache := NewLRU[string, int](10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Add("short", 1, time.Second)
+	cache.Add("forever", 2, 0)
+
+	now = now.Add(2 * time.Second)
+
+	_, ok := cache.Get("short")
+	assert.False(t, ok, "expired entry should be treated as missing")
+	assert.Equal(t, 1, cache.Len())
+
+	_, ok = cache.Get("forever")
+	assert.True(t, ok)
+}
+
+func TestLRU_UpdateAndRemove(t *testing.T) {
+	cache := NewLRU[string, int](10)
+
+	cache.Add("a", 1, 0)
+	cache.Add("a", 2, 0)
+	value, _ := cache.Get("a")
+	assert.Equal(t, 2, value)
+	assert.Equal(t, 1, cache.Len())
+
+	cache.Remove("a")
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+
+	cache.Add("b", 1, 0)
+	cache.Add("c", 1, 0)
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// feistelRounds Feistel 网络的轮数
+const feistelRounds = 8
+
+// ErrInvalidCode 短码不是有效的 Base62 编码或超出 64 位范围
+var ErrInvalidCode = errors.New("invalid short code")
+
+// IDObfuscator 用带密钥的 Feistel 网络对 64 位 ID 做可逆置换后再 Base62 编码。
+// 连续的 ID 得到的短码看起来是随机的，无法据此遍历链接或估算数量，
+// 持有密钥时仍可以从短码还原出 ID。
+type IDObfuscator struct {
+	key       []byte
+	minLength int
+}
+
+// NewIDObfuscator 创建 ID 混淆器，minLength 为短码的最小长度，不足时左侧补 0
+func NewIDObfuscator(secret string, minLength int) *IDObfuscator {
+	key := sha256.Sum256([]byte(secret))
+	return &IDObfuscator{key: key[:], minLength: minLength}
+}
+
+// Encode 将 ID 编码为混淆后的短码
+func (o *IDObfuscator) Encode(id uint64) string {
+	code := EncodeBase62(o.Permute(id))
+	if len(code) < o.minLength {
+		code = strings.Repeat("0", o.minLength-len(code)) + code
+	}
+	return code
+}
+
+// Decode 从短码还原出 ID
+func (o *IDObfuscator) Decode(code string) (uint64, error) {
+	if code == "" {
+		return 0, ErrInvalidCode
+	}
+
+	var value uint64
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(base62Chars, code[i])
+		if digit < 0 {
+			return 0, ErrInvalidCode
+		}
+
+		// 检查 value*62+digit 是否溢出 64 位
+		if value > (^uint64(0)-uint64(digit))/base {
+			return 0, ErrInvalidCode
+		}
+		value = value*base + uint64(digit)
+	}
+
+	return o.Unpermute(value), nil
+}
+
+// Permute 对 ID 做一次带密钥的可逆置换
+func (o *IDObfuscator) Permute(id uint64) uint64 {
+	left, right := uint32(id>>32), uint32(id)
+	for round := 0; round < feistelRounds; round++ {
+		left, right = right, left^o.round(round, right)
+	}
+	return uint64(left)<<32 | uint64(right)
+}
+
+// Unpermute Permute 的逆运算
+func (o *IDObfuscator) Unpermute(value uint64) uint64 {
+	left, right := uint32(value>>32), uint32(value)
+	for round := feistelRounds - 1; round >= 0; round-- {
+		left, right = right^o.round(round, left), left
+	}
+	return uint64(left)<<32 | uint64(right)
+}
+
+// round Feistel 轮函数：以 HMAC-SHA256(key, 轮次 || 半块) 的前 4 字节作为输出
+func (o *IDObfuscator) round(round int, half uint32) uint32 {
+	var input [5]byte
+	input[0] = byte(round)
+	binary.BigEndian.PutUint32(input[1:], half)
+
+	mac := hmac.New(sha256.New, o.key)
+	mac.Write(input[:])
+	return binary.BigEndian.Uint32(mac.Sum(nil))
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDObfuscatorRoundTrip(t *testing.T) {
+	obfuscator := NewIDObfuscator("secret", 11)
+
+	testValues := []uint64{0, 1, 2, 62, 3844, 999999, 1 << 32, ^uint64(0)}
+
+	for _, value := range testValues {
+		code := obfuscator.Encode(value)
+		assert.Len(t, code, 11, "code for %d should have minimum length", value)
+		assert.True(t, IsValidBase62(code))
+
+		decoded, err := obfuscator.Decode(code)
+		require.NoError(t, err)
+		assert.Equal(t, value, decoded, "Round trip failed for value %d", value)
+	}
+}
+
+func TestIDObfuscatorHidesSequence(t *testing.T) {
+	obfuscator := NewIDObfuscator("secret", 11)
+
+	// 连续的 ID 不应得到相邻或重复的短码
+	seen := make(map[string]bool)
+	for id := uint64(1); id <= 1000; id++ {
+		code := obfuscator.Encode(id)
+		assert.False(t, seen[code], "duplicate code %s", code)
+		seen[code] = true
+	}
+	assert.NotEqual(t, EncodeBase62(obfuscator.Permute(1)+1), obfuscator.Encode(2))
+
+	// 不同密钥得到不同的短码
+	other := NewIDObfuscator("another secret", 11)
+	assert.NotEqual(t, obfuscator.Encode(1), other.Encode(1))
+}
+
+func TestIDObfuscatorDecodeInvalid(t *testing.T) {
+	obfuscator := NewIDObfuscator("secret", 11)
+
+	invalidCases := []string{"", "abc!", "zzzzzzzzzzzz"} // 最后一个超出 64 位
+
+	for _, code := range invalidCases {
+		_, err := obfuscator.Decode(code)
+		assert.Equal(t, ErrInvalidCode, err, "%s should be rejected", code)
+	}
+}
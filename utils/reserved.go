@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ReservedCodes 不能用作短码的保留字，比较时不区分大小写。
+// 包括与路由冲突的路径（整个短码相同才算命中）和屏蔽词（短码中包含即命中）。
+type ReservedCodes struct {
+	mutex sync.RWMutex
+	exact map[string]bool
+	words []string
+}
+
+// NewReservedCodes 创建空的保留字表
+func NewReservedCodes() *ReservedCodes {
+	return &ReservedCodes{exact: make(map[string]bool)}
+}
+
+// Add 添加需要整体匹配的保留字
+func (r *ReservedCodes) Add(codes ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, code := range codes {
+		r.exact[strings.ToLower(code)] = true
+	}
+}
+
+// AddWords 添加屏蔽词，包含屏蔽词的短码都不可用
+func (r *ReservedCodes) AddWords(words ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			r.words = append(r.words, word)
+		}
+	}
+}
+
+// LoadDenyList 从文件读取屏蔽词，每行一个，忽略空行和以 # 开头的注释
+func (r *ReservedCodes) LoadDenyList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	r.AddWords(words...)
+	return nil
+}
+
+// IsReserved 检查短码是否为保留字或包含屏蔽词
+func (r *ReservedCodes) IsReserved(code string) bool {
+	code = strings.ToLower(code)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.exact[code] {
+		return true
+	}
+	for _, word := range r.words {
+		if strings.Contains(code, word) {
+			return true
+		}
+	}
+	return false
+}
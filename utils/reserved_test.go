@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservedCodes(t *testing.T) {
+	reserved := NewReservedCodes()
+	reserved.Add("health", "info")
+	reserved.AddWords("bad")
+
+	reservedCases := []string{"health", "Health", "INFO", "bad", "xBADx", "abad1"}
+	for _, code := range reservedCases {
+		assert.True(t, reserved.IsReserved(code), "%s should be reserved", code)
+	}
+
+	allowedCases := []string{"healthy", "inform", "b4d", "abc123"}
+	for _, code := range allowedCases {
+		assert.False(t, reserved.IsReserved(code), "%s should be allowed", code)
+	}
+}
+
+func TestReservedCodes_LoadDenyList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n\nfoo\n  Bar  \n"), 0o600))
+
+	reserved := NewReservedCodes()
+	require.NoError(t, reserved.LoadDenyList(path))
+
+	assert.True(t, reserved.IsReserved("xfoox"))
+	assert.True(t, reserved.IsReserved("BAR"))
+	assert.False(t, reserved.IsReserved("comment"))
+
+	assert.Error(t, reserved.LoadDenyList(filepath.Join(t.TempDir(), "missing.txt")))
+}
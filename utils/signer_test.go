@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner("secret")
+	now := time.Now()
+	signer.now = func() time.Time { return now }
+
+	token := signer.Sign("abc", now.Add(time.Minute))
+	assert.True(t, signer.Verify("abc", token))
+
+	// 内容不同、密钥不同或被篡改的凭证都无效
+	assert.False(t, signer.Verify("abd", token))
+	assert.False(t, NewSigner("other").Verify("abc", token))
+	assert.False(t, signer.Verify("abc", token+"x"))
+	assert.False(t, signer.Verify("abc", "garbage"))
+
+	// 过期后无效
+	signer.now = func() time.Time { return now.Add(2 * time.Minute) }
+	assert.False(t, signer.Verify("abc", token))
+
+	// 未指定密钥时每次生成不同的随机密钥
+	assert.False(t, NewSigner("").Verify("abc", NewSigner("").Sign("abc", now.Add(time.Hour))))
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 设备类型
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// 操作系统
+const (
+	OSIOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+)
+
+// 浏览器
+const (
+	BrowserChrome  = "chrome"
+	BrowserSafari  = "safari"
+	BrowserFirefox = "firefox"
+	BrowserEdge    = "edge"
+	BrowserOpera   = "opera"
+	BrowserSamsung = "samsung"
+)
+
+// UserAgent 从 User-Agent 请求头识别出的客户端信息，无法识别的字段为空
+type UserAgent struct {
+	Device  string
+	OS      string
+	Browser string
+}
+
+// botMarkers 爬虫和命令行工具的 User-Agent 中常见的片段
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests", "go-http-client"}
+
+// ParseUserAgent 按常见的特征片段识别设备类型、操作系统和浏览器。
+// 只覆盖跳转规则需要区分的主流客户端，不追求完整；空的 User-Agent 视为桌面设备。
+func ParseUserAgent(header string) UserAgent {
+	ua := strings.ToLower(header)
+	var result UserAgent
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		result.OS = OSIOS
+	case strings.Contains(ua, "android"):
+		result.OS = OSAndroid
+	case strings.Contains(ua, "windows"):
+		result.OS = OSWindows
+	case strings.Contains(ua, "cros"):
+		result.OS = OSChromeOS
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		result.OS = OSMacOS
+	case strings.Contains(ua, "linux"):
+		result.OS = OSLinux
+	}
+
+	switch {
+	case containsAny(ua, botMarkers):
+		result.Device = DeviceBot
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		result.OS == OSAndroid && !strings.Contains(ua, "mobile"):
+		result.Device = DeviceTablet
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		result.Device = DeviceMobile
+	default:
+		result.Device = DeviceDesktop
+	}
+
+	// 大多数浏览器都会带上 Chrome 或 Safari 的标识，先检查更具体的
+	switch {
+	case strings.Contains(ua, "edg/"), strings.Contains(ua, "edge/"), strings.Contains(ua, "edgios/"), strings.Contains(ua, "edga/"):
+		result.Browser = BrowserEdge
+	case strings.Contains(ua, "opr/"), strings.Contains(ua, "opera"):
+		result.Browser = BrowserOpera
+	case strings.Contains(ua, "samsungbrowser/"):
+		result.Browser = BrowserSamsung
+	case strings.Contains(ua, "firefox/"), strings.Contains(ua, "fxios/"):
+		result.Browser = BrowserFirefox
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		result.Browser = BrowserChrome
+	case strings.Contains(ua, "safari/"):
+		result.Browser = BrowserSafari
+	}
+
+	return result
+}
+
+// containsAny 判断 s 是否包含任意一个片段
+func containsAny(s string, markers []string) bool {
+	for _, marker := range markers {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferredLanguage 返回 Accept-Language 请求头中权重最高的语言标签（小写），
+// 权重相同时取靠前的；忽略 * 和权重为 0 的语言，没有可用语言时返回空字符串
+func PreferredLanguage(header string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	languages := make([]language, 0)
+	for _, item := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				parsed = 0
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		languages = append(languages, language{tag: tag, quality: quality})
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+// MatchLanguage 判断语言标签 tag 是否属于 pattern：相同，或以 pattern 加 - 开头，如 zh 包含 zh-cn
+func MatchLanguage(pattern, tag string) bool {
+	return tag == pattern || strings.HasPrefix(tag, pattern+"-")
+}
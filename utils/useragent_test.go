@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected UserAgent
+	}{
+		{"iPhone Safari",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			UserAgent{Device: DeviceMobile, OS: OSIOS, Browser: BrowserSafari}},
+		{"iPhone Chrome",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/123.0.6312.52 Mobile/15E148 Safari/604.1",
+			UserAgent{Device: DeviceMobile, OS: OSIOS, Browser: BrowserChrome}},
+		{"iPad",
+			"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			UserAgent{Device: DeviceTablet, OS: OSIOS, Browser: BrowserSafari}},
+		{"Android phone",
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Mobile Safari/537.36",
+			UserAgent{Device: DeviceMobile, OS: OSAndroid, Browser: BrowserChrome}},
+		{"Android tablet Samsung",
+			"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Safari/537.36",
+			UserAgent{Device: DeviceTablet, OS: OSAndroid, Browser: BrowserSamsung}},
+		{"Windows Edge",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36 Edg/123.0.2420.65",
+			UserAgent{Device: DeviceDesktop, OS: OSWindows, Browser: BrowserEdge}},
+		{"macOS Firefox",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:124.0) Gecko/20100101 Firefox/124.0",
+			UserAgent{Device: DeviceDesktop, OS: OSMacOS, Browser: BrowserFirefox}},
+		{"Linux Opera",
+			"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36 OPR/108.0.0.0",
+			UserAgent{Device: DeviceDesktop, OS: OSLinux, Browser: BrowserOpera}},
+		{"ChromeOS",
+			"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36",
+			UserAgent{Device: DeviceDesktop, OS: OSChromeOS, Browser: BrowserChrome}},
+		{"Googlebot",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgent{Device: DeviceBot}},
+		{"curl", "curl/8.5.0", UserAgent{Device: DeviceBot}},
+		{"empty", "", UserAgent{Device: DeviceDesktop}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseUserAgent(tt.header))
+		})
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	assert.Equal(t, "zh-cn", PreferredLanguage("zh-CN,zh;q=0.9,en;q=0.8"))
+	assert.Equal(t, "en", PreferredLanguage("fr;q=0.5, en, de;q=0.9"))
+	assert.Equal(t, "de", PreferredLanguage("*, de;q=0.7"))
+	assert.Equal(t, "en-gb", PreferredLanguage("en-GB;q=0.8, en-US;q=0.8"))
+	assert.Equal(t, "", PreferredLanguage("fr;q=0"))
+	assert.Equal(t, "", PreferredLanguage(""))
+
+	assert.True(t, MatchLanguage("zh", "zh-cn"))
+	assert.True(t, MatchLanguage("zh-cn", "zh-cn"))
+	assert.False(t, MatchLanguage("zh-tw", "zh-cn"))
+	assert.False(t, MatchLanguage("en", "eng"))
+}